@@ -0,0 +1,243 @@
+package applications
+
+import (
+	"database/sql"
+	"github.com/lib/pq"
+	"github.com/mensurowary/juno/model"
+	"github.com/mensurowary/juno/resources/upload"
+	log "github.com/sirupsen/logrus"
+)
+
+func (r *Repository) GetApplications() ([]model.Application, error) {
+	rows, err := r.db.Query(`SELECT id, description, disabled, scopes, token_lifetime, created_on FROM applications ORDER BY id`)
+	if err != nil {
+		log.Errorf("Error occurred while trying to retrieve the applications : %v", err)
+		return nil, ErrCouldNotRetrieveResults
+	}
+	defer rows.Close()
+
+	var apps []model.Application
+	for rows.Next() {
+		app, err := scanApplication(rows)
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, app)
+	}
+	return apps, nil
+}
+
+func (r *Repository) GetApplication(appID string) (model.Application, error) {
+	row := r.db.QueryRow(`SELECT id, description, disabled, scopes, token_lifetime, created_on FROM applications WHERE id = $1`, appID)
+	app, err := scanApplication(row)
+	if err == sql.ErrNoRows {
+		return model.Application{}, ErrApplicationNotFound
+	}
+	return app, err
+}
+
+func (r *Repository) CreateApplication(app model.Application, passwordHash string) error {
+	result, err := r.db.Exec(
+		`INSERT INTO applications(id, description, password, scopes, token_lifetime, disabled, created_on) VALUES ($1, $2, $3, $4, NULLIF($5, 0), false, current_timestamp) ON CONFLICT (id) DO NOTHING`,
+		app.ID, app.Description, passwordHash, pq.Array(app.Scopes), app.TokenLifetime)
+	if err != nil {
+		log.Errorf("Could not create the application [%s] : %v", app.ID, err)
+		return ErrCouldNotPersist
+	}
+	return expectSingleRow(result, ErrApplicationExists)
+}
+
+func (r *Repository) UpdateApplication(appID string, params UpdateApplicationParams) error {
+	result, err := r.db.Exec(
+		`UPDATE applications SET description = COALESCE($2, description), disabled = COALESCE($3, disabled), scopes = COALESCE($4, scopes),
+		token_lifetime = CASE WHEN $5::bigint IS NULL THEN token_lifetime ELSE NULLIF($5, 0) END WHERE id = $1`,
+		appID, params.Description, params.Disabled, pq.Array(params.Scopes), params.TokenLifetime)
+	if err != nil {
+		log.Errorf("Could not update the application [%s] : %v", appID, err)
+		return ErrCouldNotPersist
+	}
+	return expectSingleRow(result, ErrApplicationNotFound)
+}
+
+func (r *Repository) UpdatePassword(appID, passwordHash string) error {
+	result, err := r.db.Exec(`UPDATE applications SET password = $2 WHERE id = $1`, appID, passwordHash)
+	if err != nil {
+		log.Errorf("Could not update the password of the application [%s] : %v", appID, err)
+		return ErrCouldNotPersist
+	}
+	return expectSingleRow(result, ErrApplicationNotFound)
+}
+
+// IncrementTokenGeneration invalidates all the tokens issued to the application so far
+func (r *Repository) IncrementTokenGeneration(appID string) error {
+	result, err := r.db.Exec(`UPDATE applications SET token_generation = token_generation + 1 WHERE id = $1`, appID)
+	if err != nil {
+		log.Errorf("Could not revoke the tokens of the application [%s] : %v", appID, err)
+		return ErrCouldNotPersist
+	}
+	return expectSingleRow(result, ErrApplicationNotFound)
+}
+
+// DeleteApplication deletes the application along with all the resources it owns and returns the part files of its
+// unfinished uploads. The release function removes the stored files no other resource is stored in anymore before the
+// deletion is committed, while their locations are still locked. The files that could not be removed do not stop the
+// deletion, they are reported once committed.
+func (r *Repository) DeleteApplication(appID string, release func(StoredFile) error) ([]string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.Errorf("Could not start the transaction : %v", err)
+		return nil, ErrCouldNotPersist
+	}
+
+	files, err := storedFiles(tx, appID)
+	if err != nil {
+		return nil, rollback(tx, err)
+	}
+
+	// the uploads cascade with the application, their part files are only known from them
+	parts, err := partLocations(tx, appID)
+	if err != nil {
+		return nil, rollback(tx, err)
+	}
+
+	// the files are shared by the resources with the same content, possibly of other applications too
+	for _, file := range files {
+		if err := upload.LockLocation(tx, file.Storage, file.Location); err != nil {
+			log.Errorf("Could not lock the stored file [%s] : %v", file.Location, err)
+			return nil, rollback(tx, ErrCouldNotPersist)
+		}
+	}
+
+	// resource_relations rows cascade on both sides, but the resources themselves have to go explicitly
+	if _, err := tx.Exec(`DELETE FROM resources WHERE id IN (SELECT resource_id FROM resource_relations WHERE app_id = $1)`, appID); err != nil {
+		log.Errorf("Could not delete the resources of the application [%s] : %v", appID, err)
+		return nil, rollback(tx, ErrCouldNotPersist)
+	}
+
+	result, err := tx.Exec(`DELETE FROM applications WHERE id = $1`, appID)
+	if err != nil {
+		log.Errorf("Could not delete the application [%s] : %v", appID, err)
+		return nil, rollback(tx, ErrCouldNotPersist)
+	}
+
+	if err := expectSingleRow(result, ErrApplicationNotFound); err != nil {
+		return nil, rollback(tx, err)
+	}
+
+	var failed bool
+	for _, file := range files {
+		references, err := upload.CountReferences(tx, file.Storage, file.Location)
+		if err != nil {
+			log.Errorf("Could not count the references to the stored file [%s] : %v", file.Location, err)
+			return nil, rollback(tx, ErrCouldNotPersist)
+		}
+		if references == 0 && release(file) != nil {
+			failed = true
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Could not commit the deletion of the application [%s] : %v", appID, err)
+		return nil, ErrCouldNotPersist
+	}
+	if failed {
+		return parts, ErrCouldNotDeleteFiles
+	}
+	return parts, nil
+}
+
+// partLocations are the part files of the unfinished uploads of the application, the finished ones were moved already
+func partLocations(tx *sql.Tx, appID string) ([]string, error) {
+	rows, err := tx.Query(`SELECT part_location FROM uploads WHERE app_id = $1 AND resource_id IS NULL`, appID)
+	if err != nil {
+		log.Errorf("Could not retrieve the uploads of the application [%s] : %v", appID, err)
+		return nil, ErrCouldNotRetrieveResults
+	}
+	defer rows.Close()
+
+	var parts []string
+	for rows.Next() {
+		var part string
+		if err := rows.Scan(&part); err != nil {
+			log.Errorf("Error occurred while mapping the results to objects : %v", err)
+			return nil, ErrCouldNotRetrieveResults
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// storedFiles are ordered so that the concurrent deletions lock them in the same order
+func storedFiles(tx *sql.Tx, appID string) ([]StoredFile, error) {
+	rows, err := tx.Query(`SELECT saved_location, storage FROM resource_relations WHERE app_id = $1
+		GROUP BY saved_location, storage ORDER BY saved_location, storage`, appID)
+	if err != nil {
+		log.Errorf("Could not retrieve the resource locations of the application [%s] : %v", appID, err)
+		return nil, ErrCouldNotRetrieveResults
+	}
+	defer rows.Close()
+
+	var files []StoredFile
+	for rows.Next() {
+		var file StoredFile
+		if err := rows.Scan(&file.Location, &file.Storage); err != nil {
+			log.Errorf("Error occurred while mapping the results to objects : %v", err)
+			return nil, ErrCouldNotRetrieveResults
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanApplication(s scanner) (model.Application, error) {
+	var (
+		id          string
+		description sql.NullString
+		disabled    bool
+		scopes      []string
+		lifetime    sql.NullInt64
+		createdOn   sql.NullTime
+	)
+	if err := s.Scan(&id, &description, &disabled, pq.Array(&scopes), &lifetime, &createdOn); err != nil {
+		if err == sql.ErrNoRows {
+			return model.Application{}, err
+		}
+		log.Errorf("Error occurred while mapping the results to objects : %v", err)
+		return model.Application{}, ErrCouldNotRetrieveResults
+	}
+	return model.Application{
+		ID:            id,
+		Description:   description.String,
+		Disabled:      disabled,
+		Scopes:        scopes,
+		TokenLifetime: lifetime.Int64,
+		CreatedOn:     createdOn.Time,
+	}, nil
+}
+
+func expectSingleRow(result sql.Result, errWhenNone error) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		log.Errorf("Error occurred while reading the rows affected : %v", err)
+		return ErrCouldNotPersist
+	}
+	if affected == 0 {
+		return errWhenNone
+	}
+	if affected != 1 {
+		log.Errorf("Expected a single row to be affected, got %d", affected)
+		return ErrCouldNotPersist
+	}
+	return nil
+}
+
+func rollback(tx *sql.Tx, err error) error {
+	if err2 := tx.Rollback(); err2 != nil {
+		log.Errorf("Could not rollback! : %v", err2)
+	}
+	return err
+}
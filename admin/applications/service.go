@@ -0,0 +1,122 @@
+package applications
+
+import (
+	"github.com/mensurowary/juno/auth"
+	"github.com/mensurowary/juno/model"
+	"github.com/mensurowary/juno/resources/storage"
+	"github.com/mensurowary/juno/resources/tus"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+func (s *Service) GetApplications() ([]model.Application, error) {
+	apps, err := s.r.GetApplications()
+	if apps == nil {
+		apps = []model.Application{}
+	}
+	return apps, err
+}
+
+func (s *Service) GetApplication(appID string) (model.Application, error) {
+	return s.r.GetApplication(appID)
+}
+
+func (s *Service) CreateApplication(params CreateApplicationParams) (model.Application, error) {
+	appID := strings.TrimSpace(params.ID)
+	if appID == "" {
+		return model.Application{}, ErrInvalidApplicationID
+	}
+
+	if err := validateScopes(params.Scopes); err != nil {
+		return model.Application{}, err
+	}
+
+	if params.TokenLifetime < 0 {
+		return model.Application{}, ErrInvalidTokenLifetime
+	}
+
+	hash, err := auth.HashPassword(params.Password)
+	if err != nil {
+		log.Errorf("Could not hash the password of the application [%s] : %v", appID, err)
+		return model.Application{}, ErrCouldNotHashPassword
+	}
+
+	app := model.Application{
+		ID:            appID,
+		Description:   params.Description,
+		Scopes:        params.Scopes,
+		TokenLifetime: params.TokenLifetime,
+	}
+	if err := s.r.CreateApplication(app, hash); err != nil {
+		return model.Application{}, err
+	}
+	return s.r.GetApplication(app.ID)
+}
+
+func (s *Service) UpdateApplication(appID string, params UpdateApplicationParams) (model.Application, error) {
+	if err := validateScopes(params.Scopes); err != nil {
+		return model.Application{}, err
+	}
+
+	if params.TokenLifetime != nil && *params.TokenLifetime < 0 {
+		return model.Application{}, ErrInvalidTokenLifetime
+	}
+
+	if err := s.r.UpdateApplication(appID, params); err != nil {
+		return model.Application{}, err
+	}
+	return s.r.GetApplication(appID)
+}
+
+func (s *Service) ResetPassword(appID string, params ResetPasswordParams) error {
+	hash, err := auth.HashPassword(params.Password)
+	if err != nil {
+		log.Errorf("Could not hash the password of the application [%s] : %v", appID, err)
+		return ErrCouldNotHashPassword
+	}
+	return s.r.UpdatePassword(appID, hash)
+}
+
+// RevokeTokens revokes every token issued to the application, api keys are not affected
+func (s *Service) RevokeTokens(appID string) error {
+	return s.r.IncrementTokenGeneration(appID)
+}
+
+// DeleteApplication deletes the application, its resources, the files of those resources and the parts of its unfinished uploads
+func (s *Service) DeleteApplication(appID string) error {
+	parts, err := s.r.DeleteApplication(appID, s.deleteFile)
+	if err != nil && err != ErrCouldNotDeleteFiles {
+		return err
+	}
+
+	for _, part := range parts {
+		if err2 := tus.RemovePart(part); err2 != nil {
+			log.Errorf(`Error occurred while deleting the part file "%s" : %v`, part, err2)
+			err = ErrCouldNotDeleteFiles
+		}
+	}
+	return err
+}
+
+// deleteFile removes the stored file, the missing ones are already removed
+func (s *Service) deleteFile(file StoredFile) error {
+	driver, err := s.drivers.Get(file.Storage)
+	if err == nil {
+		err = driver.Delete(file.Location)
+	}
+	if err != nil && err != storage.ErrNotFound {
+		log.Errorf(`Error occurred while deleting the file "%s" of the %s storage : %v`, file.Location, file.Storage, err)
+		return err
+	}
+	return nil
+}
+
+func validateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !auth.IsKnownScope(scope) {
+			log.Infof("Unknown scope [%s] requested", scope)
+			return ErrUnknownScope
+		}
+	}
+	return nil
+}
@@ -0,0 +1,435 @@
+package applications
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mensurowary/juno/config"
+	"github.com/mensurowary/juno/model"
+	"github.com/mensurowary/juno/resources/storage"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var tmpDir = "./tmp"
+
+var columns = []string{"id", "description", "disabled", "scopes", "token_lifetime", "created_on"}
+
+func TestService_GetApplications(t *testing.T) {
+	t.Run("Successfully retrieves all the applications", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		createdOn := time.Now()
+		mock.ExpectQuery(`^SELECT id, description, disabled, scopes, token_lifetime, created_on FROM applications ORDER BY id`).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow("admin", "Admin", false, "{admin}", 3600, createdOn).
+				AddRow("test", nil, true, "{}", nil, nil))
+
+		apps, err := getService(db).GetApplications()
+
+		assert.Nil(t, err)
+		assert.Equal(t, []model.Application{
+			{ID: "admin", Description: "Admin", Scopes: []string{"admin"}, TokenLifetime: 3600, CreatedOn: createdOn},
+			{ID: "test", Disabled: true, Scopes: []string{}},
+		}, apps)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Response should be empty slice when the query fails", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(`^SELECT id, description, disabled, scopes, token_lifetime, created_on FROM applications*`).
+			WillReturnError(errors.New("query failed"))
+
+		apps, err := getService(db).GetApplications()
+
+		assert.Equal(t, ErrCouldNotRetrieveResults, err)
+		assert.NotNil(t, apps)
+		assert.Empty(t, apps)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestService_CreateApplication(t *testing.T) {
+	t.Run("Successfully creates the application with the hashed password", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectExec(`^INSERT INTO applications\(id, description, password, scopes, token_lifetime, disabled, created_on\)*`).
+			WithArgs("reports", "Reporting service", sqlmock.AnyArg(), `{"resources:read"}`, 0).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectQuery(`^SELECT id, description, disabled, scopes, token_lifetime, created_on FROM applications WHERE id = \$1`).
+			WithArgs("reports").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("reports", "Reporting service", false, "{resources:read}", nil, nil))
+
+		app, err := getService(db).CreateApplication(CreateApplicationParams{
+			ID:          " reports ",
+			Description: "Reporting service",
+			Password:    "secret",
+			Scopes:      []string{"resources:read"},
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, model.Application{ID: "reports", Description: "Reporting service", Scopes: []string{"resources:read"}}, app)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails when the application already exists", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectExec(`^INSERT INTO applications*`).
+			WithArgs("admin", "", sqlmock.AnyArg(), nil, 0).
+			WillReturnResult(sqlmock.NewResult(-1, 0))
+
+		_, err := getService(db).CreateApplication(CreateApplicationParams{
+			ID:       "admin",
+			Password: "secret",
+		})
+
+		assert.Equal(t, ErrApplicationExists, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails when the application id is blank", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		_, err := getService(db).CreateApplication(CreateApplicationParams{
+			ID:       "   ",
+			Password: "secret",
+		})
+
+		assert.Equal(t, ErrInvalidApplicationID, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestService_UpdateApplication(t *testing.T) {
+	t.Run("Successfully disables the application", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		disabled := true
+		mock.ExpectExec(`^UPDATE applications SET description = COALESCE*`).
+			WithArgs("test", nil, true, nil, nil).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectQuery(`^SELECT id, description, disabled, scopes, token_lifetime, created_on FROM applications WHERE id = \$1`).
+			WithArgs("test").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("test", nil, true, "{}", nil, nil))
+
+		app, err := getService(db).UpdateApplication("test", UpdateApplicationParams{Disabled: &disabled})
+
+		assert.Nil(t, err)
+		assert.True(t, app.Disabled)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails when the application does not exist", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectExec(`^UPDATE applications SET description = COALESCE*`).
+			WillReturnResult(sqlmock.NewResult(-1, 0))
+
+		_, err := getService(db).UpdateApplication("ghost", UpdateApplicationParams{})
+
+		assert.Equal(t, ErrApplicationNotFound, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestService_ValidatesParams(t *testing.T) {
+	t.Run("Creation fails with an unknown scope", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		_, err := getService(db).CreateApplication(CreateApplicationParams{
+			ID:       "reports",
+			Password: "secret",
+			Scopes:   []string{"resources:everything"},
+		})
+
+		assert.Equal(t, ErrUnknownScope, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Update fails with an unknown scope", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		_, err := getService(db).UpdateApplication("test", UpdateApplicationParams{Scopes: []string{"root"}})
+
+		assert.Equal(t, ErrUnknownScope, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Update fails with a negative token lifetime", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		lifetime := int64(-1)
+		_, err := getService(db).UpdateApplication("test", UpdateApplicationParams{TokenLifetime: &lifetime})
+
+		assert.Equal(t, ErrInvalidTokenLifetime, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestService_ResetPassword(t *testing.T) {
+	t.Run("Successfully resets the password", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectExec(`^UPDATE applications SET password = \$2 WHERE id = \$1`).
+			WithArgs("test", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+
+		err := getService(db).ResetPassword("test", ResetPasswordParams{Password: "new-secret"})
+
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestService_RevokeTokens(t *testing.T) {
+	t.Run("Bumps the token generation of the application", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectExec(`^UPDATE applications SET token_generation = token_generation \+ 1 WHERE id = \$1`).
+			WithArgs("test").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+
+		err := getService(db).RevokeTokens("test")
+
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestService_DeleteApplication(t *testing.T) {
+	t.Run("Deletes the application, its resources and their files", func(t *testing.T) {
+		filename := createDummyFile(t)
+		db, mock := getDbAndMock(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`^SELECT saved_location, storage FROM resource_relations WHERE app_id = \$1`).
+			WithArgs("test").
+			WillReturnRows(sqlmock.NewRows([]string{"saved_location", "storage"}).AddRow(filename, storage.LocalDriver))
+		expectParts(mock, "test")
+		expectLocationLock(mock, filename)
+		mock.ExpectExec(`^DELETE FROM resources WHERE id IN*`).
+			WithArgs("test").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectExec(`^DELETE FROM applications WHERE id = \$1`).
+			WithArgs("test").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		expectReferences(mock, filename, 0)
+		mock.ExpectCommit()
+
+		err := getService(db).DeleteApplication("test")
+
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+		_, statErr := os.Stat(filepath.Join(tmpDir, filename))
+		assert.True(t, os.IsNotExist(statErr))
+
+		t.Cleanup(func() {
+			_ = os.RemoveAll(tmpDir)
+			_ = db.Close()
+		})
+	})
+
+	t.Run("Keeps the files shared with the resources of other applications", func(t *testing.T) {
+		filename := createDummyFile(t)
+		db, mock := getDbAndMock(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`^SELECT saved_location, storage FROM resource_relations WHERE app_id = \$1`).
+			WithArgs("test").
+			WillReturnRows(sqlmock.NewRows([]string{"saved_location", "storage"}).AddRow(filename, storage.LocalDriver))
+		expectParts(mock, "test")
+		expectLocationLock(mock, filename)
+		mock.ExpectExec(`^DELETE FROM resources WHERE id IN*`).
+			WithArgs("test").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectExec(`^DELETE FROM applications WHERE id = \$1`).
+			WithArgs("test").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		expectReferences(mock, filename, 1)
+		mock.ExpectCommit()
+
+		err := getService(db).DeleteApplication("test")
+
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+		_, statErr := os.Stat(filepath.Join(tmpDir, filename))
+		assert.Nil(t, statErr)
+
+		t.Cleanup(func() {
+			_ = os.RemoveAll(tmpDir)
+			_ = db.Close()
+		})
+	})
+
+	t.Run("Removes the part files of the unfinished uploads", func(t *testing.T) {
+		createDummyFile(t)
+		part := filepath.Join(tmpDir, "abc.part")
+		assert.Nil(t, ioutil.WriteFile(part, []byte("hel"), 0600))
+		db, mock := getDbAndMock(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`^SELECT saved_location, storage FROM resource_relations WHERE app_id = \$1`).
+			WithArgs("test").
+			WillReturnRows(sqlmock.NewRows([]string{"saved_location", "storage"}))
+		expectParts(mock, "test", "abc.part", "gone.part")
+		mock.ExpectExec(`^DELETE FROM resources WHERE id IN*`).
+			WithArgs("test").
+			WillReturnResult(sqlmock.NewResult(-1, 0))
+		mock.ExpectExec(`^DELETE FROM applications WHERE id = \$1`).
+			WithArgs("test").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectCommit()
+
+		err := getService(db).DeleteApplication("test")
+
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+		_, statErr := os.Stat(part)
+		assert.True(t, os.IsNotExist(statErr))
+
+		t.Cleanup(func() {
+			_ = os.RemoveAll(tmpDir)
+			_ = db.Close()
+		})
+	})
+
+	t.Run("Commits the deletion even when the files could not be deleted", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`^SELECT saved_location, storage FROM resource_relations WHERE app_id = \$1`).
+			WithArgs("test").
+			WillReturnRows(sqlmock.NewRows([]string{"saved_location", "storage"}).AddRow("hello.txt", storage.S3Driver))
+		expectParts(mock, "test")
+		mock.ExpectExec(`^SELECT pg_advisory_xact_lock`).
+			WithArgs("location:" + storage.S3Driver + ":hello.txt").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`^DELETE FROM resources WHERE id IN*`).
+			WithArgs("test").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectExec(`^DELETE FROM applications WHERE id = \$1`).
+			WithArgs("test").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectQuery(`^SELECT count\(\*\) FROM resource_relations`).
+			WithArgs("hello.txt", storage.S3Driver).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectCommit()
+
+		// the s3 driver is not registered, so the file can not be deleted
+		err := getService(db).DeleteApplication("test")
+
+		assert.Equal(t, ErrCouldNotDeleteFiles, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rolls back when the application does not exist", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`^SELECT saved_location, storage FROM resource_relations*`).
+			WithArgs("ghost").
+			WillReturnRows(sqlmock.NewRows([]string{"saved_location", "storage"}))
+		expectParts(mock, "ghost")
+		mock.ExpectExec(`^DELETE FROM resources WHERE id IN*`).
+			WithArgs("ghost").
+			WillReturnResult(sqlmock.NewResult(-1, 0))
+		mock.ExpectExec(`^DELETE FROM applications WHERE id = \$1`).
+			WithArgs("ghost").
+			WillReturnResult(sqlmock.NewResult(-1, 0))
+		mock.ExpectRollback()
+
+		err := getService(db).DeleteApplication("ghost")
+
+		assert.Equal(t, ErrApplicationNotFound, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rolls back when the resources could not be deleted", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`^SELECT saved_location, storage FROM resource_relations*`).
+			WithArgs("test").
+			WillReturnRows(sqlmock.NewRows([]string{"saved_location", "storage"}))
+		expectParts(mock, "test")
+		mock.ExpectExec(`^DELETE FROM resources WHERE id IN*`).
+			WithArgs("test").
+			WillReturnError(errors.New("constraint violation"))
+		mock.ExpectRollback()
+
+		err := getService(db).DeleteApplication("test")
+
+		assert.Equal(t, ErrCouldNotPersist, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func getDbAndMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	return db, mock
+}
+
+// expectParts expects the part files of the unfinished uploads of the application to be looked up
+func expectParts(mock sqlmock.Sqlmock, appID string, parts ...string) {
+	rows := sqlmock.NewRows([]string{"part_location"})
+	for _, part := range parts {
+		rows.AddRow(part)
+	}
+	mock.ExpectQuery(`^SELECT part_location FROM uploads WHERE app_id = \$1 AND resource_id IS NULL`).
+		WithArgs(appID).
+		WillReturnRows(rows)
+}
+
+func expectLocationLock(mock sqlmock.Sqlmock, location string) {
+	mock.ExpectExec(`^SELECT pg_advisory_xact_lock`).
+		WithArgs("location:" + storage.LocalDriver + ":" + location).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func expectReferences(mock sqlmock.Sqlmock, location string, references int) {
+	mock.ExpectQuery(`^SELECT count\(\*\) FROM resource_relations`).
+		WithArgs(location, storage.LocalDriver).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(references))
+}
+
+func getService(db *sql.DB) *Service {
+	drivers, _ := storage.NewRegistry(storage.LocalDriver, storage.NewLocal(tmpDir))
+	return NewService(NewRepository(db), drivers)
+}
+
+func createDummyFile(t *testing.T) string {
+	config.Config.FileUploadDir = tmpDir
+	if _, err := os.Stat(tmpDir); os.IsNotExist(err) {
+		if err := os.Mkdir(tmpDir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handle, err := os.OpenFile(tmpDir+"/hello.txt", os.O_CREATE, os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+	return filepath.Base(handle.Name())
+}
@@ -0,0 +1,77 @@
+package applications
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/mensurowary/juno/model"
+	"github.com/mensurowary/juno/resources/storage"
+)
+
+var (
+	ErrApplicationNotFound     = errors.New("could not find the application")
+	ErrApplicationExists       = errors.New("application with the given id already exists")
+	ErrCouldNotRetrieveResults = errors.New("could not retrieve the results")
+	ErrCouldNotPersist         = errors.New("could not persist the given data to database")
+	ErrCouldNotHashPassword    = errors.New("could not hash the password")
+	ErrCouldNotDeleteFiles     = errors.New("could not delete the files of the application")
+	ErrUnknownScope            = errors.New("unknown scope")
+	ErrInvalidTokenLifetime    = errors.New("token lifetime can not be negative")
+	ErrInvalidApplicationID    = errors.New("application id can not be blank")
+)
+
+type repository interface {
+	GetApplications() ([]model.Application, error)
+	GetApplication(appID string) (model.Application, error)
+	CreateApplication(app model.Application, passwordHash string) error
+	UpdateApplication(appID string, params UpdateApplicationParams) error
+	UpdatePassword(appID, passwordHash string) error
+	IncrementTokenGeneration(appID string) error
+	DeleteApplication(appID string, release func(StoredFile) error) ([]string, error)
+}
+
+type Repository struct {
+	db *sql.DB
+}
+
+type Service struct {
+	r       repository
+	drivers *storage.Registry
+}
+
+// StoredFile is a file of the resources, held by the Storage driver under the Location
+type StoredFile struct {
+	Storage, Location string
+}
+
+// CreateApplicationParams represents the payload of the application creation
+type CreateApplicationParams struct {
+	ID          string   `json:"id" binding:"required"`
+	Description string   `json:"description"`
+	Password    string   `json:"password" binding:"required"`
+	Scopes      []string `json:"scopes"`
+	// TokenLifetime is in seconds, 0 means the default lifetime
+	TokenLifetime int64 `json:"token_lifetime"`
+}
+
+// UpdateApplicationParams represents the payload of the application update,
+// only the non-nil fields are updated
+type UpdateApplicationParams struct {
+	Description *string  `json:"description"`
+	Disabled    *bool    `json:"disabled"`
+	Scopes      []string `json:"scopes"`
+	// TokenLifetime is in seconds, 0 resets it to the default lifetime
+	TokenLifetime *int64 `json:"token_lifetime"`
+}
+
+// ResetPasswordParams represents the payload of the password reset
+type ResetPasswordParams struct {
+	Password string `json:"password" binding:"required"`
+}
+
+func NewService(r *Repository, drivers *storage.Registry) *Service {
+	return &Service{r, drivers}
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db}
+}
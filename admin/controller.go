@@ -0,0 +1,127 @@
+package admin
+
+import (
+	"github.com/mensurowary/juno/admin/applications"
+	"github.com/mensurowary/juno/commons"
+	"github.com/mensurowary/juno/util"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+func GetApplicationsHandler(wc *util.WebContext, handler applicationsHandler) {
+	if apps, err := handler.GetApplications(); err != nil {
+		respondWithError(wc, err)
+	} else {
+		wc.Ok(commons.MakeSuccessResponse("Successfully retrieved all the applications", apps))
+	}
+}
+
+func GetApplicationHandler(wc *util.WebContext, handler applicationsHandler) {
+	if app, err := handler.GetApplication(wc.Param("id")); err != nil {
+		respondWithError(wc, err)
+	} else {
+		wc.Ok(commons.MakeSuccessResponse("Successfully retrieved the application", app))
+	}
+}
+
+func CreateApplicationHandler(wc *util.WebContext, handler applicationsHandler) {
+	var params applications.CreateApplicationParams
+	if err := wc.BindJSON(&params); err != nil {
+		log.Errorf("Could not bind the application creation payload : %v", err)
+		wc.BadRequest(commons.MakeFailureResponse("Application id and password are required", http.StatusBadRequest))
+		return
+	}
+
+	if app, err := handler.CreateApplication(params); err != nil {
+		respondWithError(wc, err)
+	} else {
+		wc.Ok(commons.MakeSuccessResponse("Successfully created the application", app))
+	}
+}
+
+func UpdateApplicationHandler(wc *util.WebContext, handler applicationsHandler) {
+	var params applications.UpdateApplicationParams
+	if err := wc.BindJSON(&params); err != nil {
+		log.Errorf("Could not bind the application update payload : %v", err)
+		wc.BadRequest(commons.MakeFailureResponse("Malformed application update payload", http.StatusBadRequest))
+		return
+	}
+
+	if app, err := handler.UpdateApplication(wc.Param("id"), params); err != nil {
+		respondWithError(wc, err)
+	} else {
+		wc.Ok(commons.MakeSuccessResponse("Successfully updated the application", app))
+	}
+}
+
+func ResetApplicationPasswordHandler(wc *util.WebContext, handler applicationsHandler) {
+	var params applications.ResetPasswordParams
+	if err := wc.BindJSON(&params); err != nil {
+		log.Errorf("Could not bind the password reset payload : %v", err)
+		wc.BadRequest(commons.MakeFailureResponse("New password is required", http.StatusBadRequest))
+		return
+	}
+
+	if err := handler.ResetPassword(wc.Param("id"), params); err != nil {
+		respondWithError(wc, err)
+	} else {
+		wc.Ok(commons.MakeSuccessResponse("Successfully reset the password of the application", nil))
+	}
+}
+
+func RevokeApplicationTokensHandler(wc *util.WebContext, handler applicationsHandler) {
+	if err := handler.RevokeTokens(wc.Param("id")); err != nil {
+		respondWithError(wc, err)
+	} else {
+		wc.Ok(commons.MakeSuccessResponse("Successfully revoked all the tokens of the application", nil))
+	}
+}
+
+func DeleteApplicationHandler(wc *util.WebContext, handler applicationsHandler) {
+	appID := wc.Param("id")
+	if appID == wc.GetAppID() {
+		wc.UnprocessableEntity(commons.MakeFailureResponse("Application can not delete itself", http.StatusUnprocessableEntity))
+		return
+	}
+
+	if err := handler.DeleteApplication(appID); err != nil {
+		respondWithError(wc, err)
+	} else {
+		wc.Ok(commons.MakeSuccessResponse("Successfully deleted the application", nil))
+	}
+}
+
+func GetLockoutsHandler(wc *util.WebContext, handler lockoutsHandler) {
+	if states, err := handler.States(); err != nil {
+		wc.InternalServerError(commons.MakeFailureResponse("Could not retrieve the failed login attempts", http.StatusInternalServerError))
+	} else {
+		wc.Ok(commons.MakeSuccessResponse("Successfully retrieved the failed login attempts", states))
+	}
+}
+
+func ResetLockoutHandler(wc *util.WebContext, handler lockoutsHandler) {
+	if err := handler.Reset(wc.Param("key")); err != nil {
+		wc.InternalServerError(commons.MakeFailureResponse("Could not reset the failed login attempts", http.StatusInternalServerError))
+	} else {
+		wc.Ok(commons.MakeSuccessResponse("Successfully reset the failed login attempts", nil))
+	}
+}
+
+func respondWithError(wc *util.WebContext, err error) {
+	switch err {
+	case applications.ErrApplicationNotFound:
+		wc.NotFound(commons.MakeFailureResponse("Could not find the requested application", http.StatusNotFound))
+	case applications.ErrUnknownScope:
+		wc.BadRequest(commons.MakeFailureResponse("Unknown scope", http.StatusBadRequest))
+	case applications.ErrInvalidTokenLifetime:
+		wc.BadRequest(commons.MakeFailureResponse("Token lifetime can not be negative", http.StatusBadRequest))
+	case applications.ErrInvalidApplicationID:
+		wc.BadRequest(commons.MakeFailureResponse("Application id can not be blank", http.StatusBadRequest))
+	case applications.ErrApplicationExists:
+		wc.Conflict(commons.MakeFailureResponse("Application with the given id already exists", http.StatusConflict))
+	case applications.ErrCouldNotDeleteFiles:
+		wc.UnprocessableEntity(commons.MakeFailureResponse("Application was deleted but some of its files could not be deleted", http.StatusUnprocessableEntity))
+	default:
+		wc.InternalServerError(commons.MakeFailureResponse("Unknown error occurred", http.StatusInternalServerError))
+	}
+}
@@ -0,0 +1,96 @@
+package admin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/mensurowary/juno/admin/applications"
+	"github.com/mensurowary/juno/auth/lockout"
+	"github.com/mensurowary/juno/model"
+	"github.com/mensurowary/juno/util"
+)
+
+// GetApplications retrieves all the applications
+func GetApplications(handler applicationsHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		GetApplicationsHandler(wc, handler)
+	}
+}
+
+// GetApplication retrieves a single application
+func GetApplication(handler applicationsHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		GetApplicationHandler(wc, handler)
+	}
+}
+
+// CreateApplication registers a new application
+func CreateApplication(handler applicationsHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		CreateApplicationHandler(wc, handler)
+	}
+}
+
+// UpdateApplication updates the description or the disabled state of an application
+func UpdateApplication(handler applicationsHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		UpdateApplicationHandler(wc, handler)
+	}
+}
+
+// ResetApplicationPassword sets a new password for an application
+func ResetApplicationPassword(handler applicationsHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		ResetApplicationPasswordHandler(wc, handler)
+	}
+}
+
+// RevokeApplicationTokens revokes every token issued to an application
+func RevokeApplicationTokens(handler applicationsHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		RevokeApplicationTokensHandler(wc, handler)
+	}
+}
+
+// DeleteApplication deletes an application together with its resources
+func DeleteApplication(handler applicationsHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		DeleteApplicationHandler(wc, handler)
+	}
+}
+
+// GetLockouts lists the applications and the client ips with failed login attempts along with their lockouts
+func GetLockouts(handler lockoutsHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		GetLockoutsHandler(wc, handler)
+	}
+}
+
+// ResetLockout forgets the failed login attempts of an application or a client ip, e.g. app:test or ip:10.0.0.1
+func ResetLockout(handler lockoutsHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		ResetLockoutHandler(wc, handler)
+	}
+}
+
+type applicationsHandler interface {
+	GetApplications() ([]model.Application, error)
+	GetApplication(appID string) (model.Application, error)
+	CreateApplication(params applications.CreateApplicationParams) (model.Application, error)
+	UpdateApplication(appID string, params applications.UpdateApplicationParams) (model.Application, error)
+	ResetPassword(appID string, params applications.ResetPasswordParams) error
+	RevokeTokens(appID string) error
+	DeleteApplication(appID string) error
+}
+
+type lockoutsHandler interface {
+	States() ([]lockout.State, error)
+	Reset(key string) error
+}
@@ -0,0 +1,53 @@
+package apikeys
+
+import (
+	"github.com/mensurowary/juno/auth"
+	"github.com/mensurowary/juno/commons"
+	"github.com/mensurowary/juno/util"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+func GetAPIKeysHandler(wc *util.WebContext, handler apiKeysHandler) {
+	if keys, err := handler.GetAPIKeys(wc.GetAppID()); err != nil {
+		wc.InternalServerError(commons.MakeFailureResponse("Could not retrieve the api keys", http.StatusInternalServerError))
+	} else {
+		wc.Ok(commons.MakeSuccessResponse("Successfully retrieved all the api keys", keys))
+	}
+}
+
+func CreateAPIKeyHandler(wc *util.WebContext, handler apiKeysHandler) {
+	var params CreateAPIKeyParams
+	if err := wc.BindJSON(&params); err != nil {
+		log.Errorf("Could not bind the api key creation payload : %v", err)
+		wc.BadRequest(commons.MakeFailureResponse("Api key name and scopes are required", http.StatusBadRequest))
+		return
+	}
+
+	key, err := handler.CreateAPIKey(wc.GetApplication(), params)
+	switch err {
+	case nil:
+		wc.Ok(commons.MakeSuccessResponse("Successfully created the api key, it will not be shown again", key))
+	case ErrScopeNotGranted:
+		wc.Forbidden(commons.MakeFailureResponse("Api key can not be granted a scope the application lacks", http.StatusForbidden))
+	default:
+		wc.InternalServerError(commons.MakeFailureResponse("Could not create the api key", http.StatusInternalServerError))
+	}
+}
+
+func RevokeAPIKeyHandler(wc *util.WebContext, handler apiKeysHandler) {
+	switch err := handler.RevokeAPIKey(wc.Param("id"), wc.GetAppID()); err {
+	case nil:
+		wc.Ok(commons.MakeSuccessResponse("Successfully revoked the api key", nil))
+	case ErrAPIKeyNotFound:
+		wc.NotFound(commons.MakeFailureResponse("Could not find the requested api key", http.StatusNotFound))
+	default:
+		wc.InternalServerError(commons.MakeFailureResponse("Could not revoke the api key", http.StatusInternalServerError))
+	}
+}
+
+type apiKeysHandler interface {
+	GetAPIKeys(appID string) ([]APIKey, error)
+	CreateAPIKey(app *auth.Application, params CreateAPIKeyParams) (*CreatedAPIKey, error)
+	RevokeAPIKey(keyID, appID string) error
+}
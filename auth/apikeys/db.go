@@ -0,0 +1,98 @@
+package apikeys
+
+import (
+	"database/sql"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+func (r *Repository) GetAPIKeys(appID string) ([]APIKey, error) {
+	rows, err := r.db.Query(`
+		SELECT id, name, prefix, scopes, created_on, last_used_on, revoked_on
+		FROM api_keys
+		WHERE app_id = $1
+		ORDER BY created_on
+	`, appID)
+	if err != nil {
+		log.Errorf("Error occurred while trying to retrieve the api keys for the app: %s : %v", appID, err)
+		return nil, ErrCouldNotRetrieveResults
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		var (
+			key                   APIKey
+			lastUsedOn, revokedOn sql.NullTime
+		)
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.CreatedOn, &lastUsedOn, &revokedOn); err != nil {
+			log.Errorf("Error occurred while mapping the results to objects : %v", err)
+			return nil, ErrCouldNotRetrieveResults
+		}
+		key.LastUsedOn = timeOrNil(lastUsedOn)
+		key.RevokedOn = timeOrNil(revokedOn)
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (r *Repository) CreateAPIKey(key APIKey, appID, keyHash string) error {
+	result, err := r.db.Exec(
+		`INSERT INTO api_keys(id, app_id, name, prefix, key_hash, scopes, created_on) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		key.ID, appID, key.Name, key.Prefix, keyHash, pq.Array(key.Scopes), key.CreatedOn)
+	if err != nil {
+		log.Errorf("Could not create the api key for the app: %s : %v", appID, err)
+		return ErrCouldNotPersist
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected != 1 {
+		log.Errorf("Could not persist the api key : affected rows : %d, error : %v", affected, err)
+		return ErrCouldNotPersist
+	}
+	return nil
+}
+
+func (r *Repository) RevokeAPIKey(keyID, appID string) error {
+	result, err := r.db.Exec(
+		`UPDATE api_keys SET revoked_on = current_timestamp WHERE id = $1 AND app_id = $2 AND revoked_on IS NULL`,
+		keyID, appID)
+	if err != nil {
+		log.Errorf("Could not revoke the api key [%s] : %v", keyID, err)
+		return ErrCouldNotPersist
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		log.Errorf("Error occurred while reading the rows affected : %v", err)
+		return ErrCouldNotPersist
+	}
+	if affected != 1 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// UseAPIKey looks up an active key by its hash and records that it was used
+func (r *Repository) UseAPIKey(keyHash string) (*usedKey, error) {
+	var key usedKey
+	row := r.db.QueryRow(`
+		UPDATE api_keys k SET last_used_on = current_timestamp
+		FROM applications a
+		WHERE a.id = k.app_id AND k.key_hash = $1 AND k.revoked_on IS NULL
+		RETURNING k.app_id, k.scopes, a.scopes, a.disabled
+	`, keyHash)
+	if err := row.Scan(&key.AppID, pq.Array(&key.KeyScopes), pq.Array(&key.AppScopes), &key.AppDisabled); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidAPIKey
+		}
+		log.Errorf("Error occurred while looking up the api key : %v", err)
+		return nil, ErrCouldNotRetrieveResults
+	}
+	return &key, nil
+}
+
+func timeOrNil(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,103 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/google/uuid"
+	"github.com/mensurowary/juno/auth"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+func (s *Service) GetAPIKeys(appID string) ([]APIKey, error) {
+	keys, err := s.r.GetAPIKeys(appID)
+	if keys == nil {
+		keys = []APIKey{}
+	}
+	return keys, err
+}
+
+// CreateAPIKey creates a key for the application, the key can not be granted a scope the application lacks
+func (s *Service) CreateAPIKey(app *auth.Application, params CreateAPIKeyParams) (*CreatedAPIKey, error) {
+	for _, scope := range params.Scopes {
+		if !auth.IsKnownScope(scope) || !app.HasScope(scope) {
+			log.Infof("Application [%s] requested an api key with the scope [%s] it lacks", app.ID, scope)
+			return nil, ErrScopeNotGranted
+		}
+	}
+
+	key, err := generateKey()
+	if err != nil {
+		log.Errorf("Could not generate an api key : %v", err)
+		return nil, ErrCouldNotGenerateKey
+	}
+
+	apiKey := APIKey{
+		ID:        uuid.New().String(),
+		Name:      strings.TrimSpace(params.Name),
+		Prefix:    key[:len(keyPrefix)+6],
+		Scopes:    params.Scopes,
+		CreatedOn: time.Now(),
+	}
+
+	if err := s.r.CreateAPIKey(apiKey, app.ID, hashKey(key)); err != nil {
+		return nil, err
+	}
+
+	return &CreatedAPIKey{
+		APIKey: apiKey,
+		Key:    key,
+	}, nil
+}
+
+func (s *Service) RevokeAPIKey(keyID, appID string) error {
+	return s.r.RevokeAPIKey(keyID, appID)
+}
+
+// ResolveAPIKey finds the application the key belongs to,
+// the resolved application is granted only the key scopes the application still has
+func (s *Service) ResolveAPIKey(key string) (*auth.Application, error) {
+	if !strings.HasPrefix(key, keyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	used, err := s.r.UseAPIKey(hashKey(key))
+	if err != nil {
+		return nil, err
+	}
+
+	if used.AppDisabled {
+		log.Infof("Disabled application [%s] tried to use an api key", used.AppID)
+		return nil, ErrInvalidAPIKey
+	}
+
+	owner := &auth.Application{ID: used.AppID, Scopes: used.AppScopes}
+	scopes := make([]string, 0, len(used.KeyScopes))
+	for _, scope := range used.KeyScopes {
+		if owner.HasScope(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return &auth.Application{
+		ID:     used.AppID,
+		Scopes: scopes,
+	}, nil
+}
+
+func generateKey() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// hashKey hashes the key for storage, a plain digest suffices as the keys are random and long
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,162 @@
+package apikeys
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mensurowary/juno/auth"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestService_CreateAPIKey(t *testing.T) {
+	t.Run("Successfully creates a key with the scopes the application has", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectExec(`^INSERT INTO api_keys\(id, app_id, name, prefix, key_hash, scopes, created_on\)*`).
+			WithArgs(sqlmock.AnyArg(), "test", "batch", sqlmock.AnyArg(), sqlmock.AnyArg(), `{"resources:read"}`, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+
+		app := &auth.Application{ID: "test", Scopes: []string{auth.ScopeResourcesRead, auth.ScopeResourcesWrite}}
+		key, err := getService(db).CreateAPIKey(app, CreateAPIKeyParams{
+			Name:   " batch ",
+			Scopes: []string{auth.ScopeResourcesRead},
+		})
+
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(key.Key, keyPrefix))
+		assert.True(t, strings.HasPrefix(key.Key, key.Prefix))
+		assert.Equal(t, "batch", key.Name)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails when a scope the application lacks is requested", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		app := &auth.Application{ID: "test", Scopes: []string{auth.ScopeResourcesRead}}
+		key, err := getService(db).CreateAPIKey(app, CreateAPIKeyParams{
+			Name:   "batch",
+			Scopes: []string{auth.ScopeResourcesDelete},
+		})
+
+		assert.Nil(t, key)
+		assert.Equal(t, ErrScopeNotGranted, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestService_ResolveAPIKey(t *testing.T) {
+	columns := []string{"app_id", "key_scopes", "app_scopes", "disabled"}
+
+	t.Run("Resolves the application with the key scopes the application still has", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(`UPDATE api_keys k SET last_used_on = current_timestamp*`).
+			WithArgs(hashKey("juno_secret")).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow("test", "{resources:read,resources:delete}", "{resources:read}", false))
+
+		app, err := getService(db).ResolveAPIKey("juno_secret")
+
+		assert.Nil(t, err)
+		assert.Equal(t, &auth.Application{ID: "test", Scopes: []string{auth.ScopeResourcesRead}}, app)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails when the application is disabled", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(`UPDATE api_keys k SET last_used_on = current_timestamp*`).
+			WithArgs(hashKey("juno_secret")).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("test", "{resources:read}", "{resources:read}", true))
+
+		app, err := getService(db).ResolveAPIKey("juno_secret")
+
+		assert.Nil(t, app)
+		assert.Equal(t, ErrInvalidAPIKey, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails when the key is unknown or revoked", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(`UPDATE api_keys k SET last_used_on = current_timestamp*`).
+			WithArgs(hashKey("juno_revoked")).
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		app, err := getService(db).ResolveAPIKey("juno_revoked")
+
+		assert.Nil(t, app)
+		assert.Equal(t, ErrInvalidAPIKey, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails without hitting the database when the key is malformed", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		app, err := getService(db).ResolveAPIKey("Bearer something")
+
+		assert.Nil(t, app)
+		assert.Equal(t, ErrInvalidAPIKey, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestService_GetAPIKeys(t *testing.T) {
+	t.Run("Lists the keys of the application", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		createdOn := time.Now()
+		mock.ExpectQuery(`\s*SELECT id, name, prefix, scopes, created_on, last_used_on, revoked_on\s*FROM api_keys*`).
+			WithArgs("test").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "prefix", "scopes", "created_on", "last_used_on", "revoked_on"}).
+				AddRow("1", "batch", "juno_abcdef", "{resources:read}", createdOn, nil, createdOn))
+
+		keys, err := getService(db).GetAPIKeys("test")
+
+		assert.Nil(t, err)
+		assert.Equal(t, []APIKey{{
+			ID:        "1",
+			Name:      "batch",
+			Prefix:    "juno_abcdef",
+			Scopes:    []string{auth.ScopeResourcesRead},
+			CreatedOn: createdOn,
+			RevokedOn: &createdOn,
+		}}, keys)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestService_RevokeAPIKey(t *testing.T) {
+	t.Run("Fails when the key does not belong to the application or is already revoked", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectExec(`^UPDATE api_keys SET revoked_on = current_timestamp*`).
+			WithArgs("1", "test").
+			WillReturnResult(sqlmock.NewResult(-1, 0))
+
+		err := getService(db).RevokeAPIKey("1", "test")
+
+		assert.Equal(t, ErrAPIKeyNotFound, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func getDbAndMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	return db, mock
+}
+
+func getService(db *sql.DB) *Service {
+	return NewService(NewRepository(db))
+}
@@ -0,0 +1,73 @@
+package apikeys
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrAPIKeyNotFound          = errors.New("could not find the api key")
+	ErrInvalidAPIKey           = errors.New("api key is invalid, revoked or belongs to a disabled application")
+	ErrScopeNotGranted         = errors.New("scope is not granted to the application")
+	ErrCouldNotRetrieveResults = errors.New("could not retrieve the results")
+	ErrCouldNotPersist         = errors.New("could not persist the given data to database")
+	ErrCouldNotGenerateKey     = errors.New("could not generate the api key")
+)
+
+// keyPrefix makes juno keys recognizable, e.g. by secret scanners
+const keyPrefix = "juno_"
+
+type repository interface {
+	GetAPIKeys(appID string) ([]APIKey, error)
+	CreateAPIKey(key APIKey, appID, keyHash string) error
+	RevokeAPIKey(keyID, appID string) error
+	UseAPIKey(keyHash string) (*usedKey, error)
+}
+
+type Repository struct {
+	db *sql.DB
+}
+
+type Service struct {
+	r repository
+}
+
+// APIKey represents the stored information of an api key, the key itself is never stored
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedOn  time.Time  `json:"created_on"`
+	LastUsedOn *time.Time `json:"last_used_on"`
+	RevokedOn  *time.Time `json:"revoked_on"`
+}
+
+// CreatedAPIKey is returned only once, right after the creation, as it carries the key itself
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// CreateAPIKeyParams represents the payload of the api key creation
+type CreateAPIKeyParams struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+}
+
+// usedKey represents the key together with its application, as seen during authentication
+type usedKey struct {
+	AppID       string
+	KeyScopes   []string
+	AppScopes   []string
+	AppDisabled bool
+}
+
+func NewService(r *Repository) *Service {
+	return &Service{r}
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db}
+}
@@ -0,0 +1,30 @@
+package apikeys
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/mensurowary/juno/util"
+)
+
+// GetAPIKeys lists the api keys of the application
+func GetAPIKeys(handler apiKeysHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		GetAPIKeysHandler(wc, handler)
+	}
+}
+
+// CreateAPIKey creates a new api key for the application
+func CreateAPIKey(handler apiKeysHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		CreateAPIKeyHandler(wc, handler)
+	}
+}
+
+// RevokeAPIKey revokes an api key of the application
+func RevokeAPIKey(handler apiKeysHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		RevokeAPIKeyHandler(wc, handler)
+	}
+}
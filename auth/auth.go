@@ -2,10 +2,17 @@ package auth
 
 import (
 	jwt "github.com/appleboy/gin-jwt/v2"
+	jwtgo "github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/mensurowary/juno/auth/lockout"
 	"github.com/mensurowary/juno/commons"
 	"github.com/mensurowary/juno/config"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"math"
+	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -14,27 +21,48 @@ type login struct {
 	Password string `form:"password" json:"password" binding:"required"`
 }
 
-var identityKey = "app_id"
+var (
+	identityKey   = "app_id"
+	tokenIDKey    = "jti"
+	generationKey = "gen"
+	lifetimeKey   = "ttl"
+	revokedKey    = "juno_token_revoked"
+)
+
+// unknownApplicationHash is compared against when the application does not exist, it is of the cost of
+// auth.HashPassword so that the unknown applications take as long to fail as the known ones
+const unknownApplicationHash = "$2a$10$xJ.20K5FXLbQAW8huVj9W.t3oxYDTBwAOaOG.0WDEI1lNy53hyaOa"
 
 // Application represents the application/user of juno
 type Application struct {
-	ID string
+	ID, Description string
+	Scopes          []string
+	TokenGeneration int64
+	// TokenLifetime overrides the default lifetime of the tokens issued to the application when set
+	TokenLifetime time.Duration
+}
+
+// loginThrottler keeps track of the failed logins, see lockout.Limiter
+type loginThrottler interface {
+	Check(keys ...string) (time.Duration, error)
+	Failure(keys ...string)
+	Success(keys ...string)
 }
 
 // JwtMiddleware is the middleware that handles authentication and authorization
-func JwtMiddleware() *jwt.GinJWTMiddleware {
+func JwtMiddleware(r *Repository, keys *KeySet, throttler loginThrottler) *JWT {
 	authMiddleware, err := jwt.New(&jwt.GinJWTMiddleware{
 		Realm:           config.Config.JwtRealm,
 		Key:             []byte(config.Config.JwtSecret),
-		Timeout:         15 * time.Minute,
-		MaxRefresh:      15 * time.Minute,
+		Timeout:         config.Config.JwtTimeout,
+		MaxRefresh:      config.Config.JwtMaxRefresh,
 		IdentityKey:     identityKey,
 		PayloadFunc:     payloadHandler(),
 		IdentityHandler: identityHandler(),
-		Authenticator:   authenticator(),
-		Authorizator:    authorizer(),
+		Authenticator:   authenticator(r, throttler),
+		Authorizator:    authorizer(r),
 		Unauthorized:    unauthorized(),
-		TokenLookup:     "header: Authorization",
+		TokenLookup:     config.Config.JwtTokenLookup,
 		TokenHeadName:   "Bearer",
 		TimeFunc:        time.Now,
 	})
@@ -43,44 +71,100 @@ func JwtMiddleware() *jwt.GinJWTMiddleware {
 		log.Fatal("JWT Error:" + err.Error())
 	}
 
-	return authMiddleware
+	return &JWT{
+		GinJWTMiddleware: authMiddleware,
+		keys:             keys,
+	}
+}
+
+// KeysFromConfig creates the key set the tokens are signed and verified with
+func KeysFromConfig() *KeySet {
+	var (
+		keys *KeySet
+		err  error
+	)
+
+	if algorithm := config.Config.JwtSigningAlgorithm; algorithm == "HS256" {
+		keys, err = NewHMACKeySet(config.Config.JwtSecret)
+	} else {
+		keys, err = NewAsymmetricKeySet(algorithm, config.Config.JwtSigningKeyFile, config.Config.JwtVerificationKeyFiles)
+	}
 
+	if err != nil {
+		log.Fatal("JWT Error:" + err.Error())
+	}
+	return keys
 }
 
-func authorizer() func(data interface{}, c *gin.Context) bool {
+// authorizer makes sure the identity is resolved and the token is not revoked,
+// the scopes are enforced per route by RequireScopes
+func authorizer(checker tokenChecker) func(data interface{}, c *gin.Context) bool {
 	return func(data interface{}, c *gin.Context) bool {
-		if v, ok := data.(*Application); ok && v.ID == "admin" {
-			return true
+		app, ok := data.(*Application)
+		if !ok {
+			return false
 		}
 
-		return false
+		if err := checker.checkToken(app.ID, tokenID(jwt.ExtractClaims(c)), app.TokenGeneration); err != nil {
+			c.Set(revokedKey, true)
+			return false
+		}
+		return true
 	}
 }
 
-func authenticator() func(c *gin.Context) (interface{}, error) {
+// authenticator verifies the credentials, the applications and the clients failing too often are locked out
+func authenticator(finder credentialsFinder, throttler loginThrottler) func(c *gin.Context) (interface{}, error) {
 	return func(c *gin.Context) (interface{}, error) {
 		var loginValues login
 		if err := c.ShouldBind(&loginValues); err != nil {
 			return "", jwt.ErrMissingLoginValues
 		}
-		userID := loginValues.Username
-		password := loginValues.Password
 
-		if (userID == "admin" && password == "admin") || (userID == "test" && password == "test") {
-			return &Application{
-				ID: userID,
-			}, nil
+		attemptKeys := []string{lockout.AppKey(loginValues.Username), lockout.IPKey(c.ClientIP())}
+		if left, err := throttler.Check(attemptKeys...); err != nil {
+			log.Warnf("Locked out login attempt for the application [%s] from [%s]", loginValues.Username, c.ClientIP())
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(left.Seconds()))))
+			return nil, err
+		}
+
+		creds, err := finder.findCredentials(loginValues.Username)
+		if err != nil {
+			if err == ErrApplicationNotFound {
+				_ = bcrypt.CompareHashAndPassword([]byte(unknownApplicationHash), []byte(loginValues.Password))
+				throttler.Failure(attemptKeys...)
+			}
+			return nil, jwt.ErrFailedAuthentication
+		}
+
+		// the password is compared first, so that the disabled applications take as long to fail as the others
+		if err := bcrypt.CompareHashAndPassword([]byte(creds.PasswordHash), []byte(loginValues.Password)); err != nil {
+			log.Infof("Failed login attempt for the application [%s]", creds.ID)
+			throttler.Failure(attemptKeys...)
+			return nil, jwt.ErrFailedAuthentication
+		}
+
+		if creds.Disabled {
+			log.Infof("Disabled application [%s] tried to log in", creds.ID)
+			throttler.Failure(attemptKeys...)
+			return nil, jwt.ErrFailedAuthentication
 		}
 
-		return nil, jwt.ErrFailedAuthentication
+		// the client ip keeps its failures, otherwise a single known password would lift the lockout of the guesses on the others
+		throttler.Success(lockout.AppKey(creds.ID))
+
+		return creds.application(), nil
 	}
 }
 
 func identityHandler() func(c *gin.Context) interface{} {
 	return func(c *gin.Context) interface{} {
 		claims := jwt.ExtractClaims(c)
+		generation, _ := claims[generationKey].(float64)
 		return &Application{
-			ID: claims[identityKey].(string),
+			ID:              claims[identityKey].(string),
+			Scopes:          scopesFromClaim(claims[scopesKey]),
+			TokenGeneration: int64(generation),
 		}
 	}
 }
@@ -88,9 +172,16 @@ func identityHandler() func(c *gin.Context) interface{} {
 func payloadHandler() func(data interface{}) jwt.MapClaims {
 	return func(data interface{}) jwt.MapClaims {
 		if v, ok := data.(*Application); ok {
-			return jwt.MapClaims{
-				identityKey: v.ID,
+			claims := jwt.MapClaims{
+				identityKey:   v.ID,
+				scopesKey:     v.Scopes,
+				tokenIDKey:    uuid.New().String(),
+				generationKey: v.TokenGeneration,
+			}
+			if v.TokenLifetime > 0 {
+				claims[lifetimeKey] = int64(v.TokenLifetime / time.Second)
 			}
+			return claims
 		}
 		return jwt.MapClaims{}
 	}
@@ -98,8 +189,62 @@ func payloadHandler() func(data interface{}) jwt.MapClaims {
 
 func unauthorized() func(c *gin.Context, code int, message string) {
 	return func(c *gin.Context, code int, message string) {
+		if c.GetBool(revokedKey) {
+			code = http.StatusUnauthorized
+		}
 		c.JSON(code, commons.MakeFailureResponse(
 			"Unauthorized", uint16(code),
 		))
 	}
 }
+
+// LogoutHandler revokes the token the request was authenticated with,
+// it must be used after the middleware that validates the token
+func LogoutHandler(mw *JWT, revoker tokenRevoker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := jwt.ExtractClaims(c)
+		jti := tokenID(claims)
+		if jti == "" {
+			c.JSON(http.StatusUnprocessableEntity, commons.MakeFailureResponse(
+				"Token can not be revoked", http.StatusUnprocessableEntity,
+			))
+			return
+		}
+
+		// refreshed tokens share the jti, so it is kept until every token of the chain expires
+		until := mw.TimeFunc().Add(mw.lifetime(claims) + mw.MaxRefresh)
+		if err := revoker.revokeToken(jti, claims[identityKey].(string), until); err != nil {
+			c.JSON(http.StatusInternalServerError, commons.MakeFailureResponse(
+				"Could not revoke the token", http.StatusInternalServerError,
+			))
+			return
+		}
+
+		mw.LogoutHandler(c)
+	}
+}
+
+// RefreshHandler refreshes the token unless it has been revoked
+func RefreshHandler(mw *JWT, checker tokenChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// expired tokens are still refreshable, so the parsing error is not decisive here
+		if token, _ := mw.ParseToken(c); token != nil {
+			if claims, ok := token.Claims.(jwtgo.MapClaims); ok {
+				appID, _ := claims[identityKey].(string)
+				generation, _ := claims[generationKey].(float64)
+				if err := checker.checkToken(appID, tokenID(jwt.MapClaims(claims)), int64(generation)); err != nil {
+					c.Set(revokedKey, true)
+					mw.Unauthorized(c, http.StatusUnauthorized, err.Error())
+					return
+				}
+			}
+		}
+
+		mw.RefreshHandler(c)
+	}
+}
+
+func tokenID(claims jwt.MapClaims) string {
+	jti, _ := claims[tokenIDKey].(string)
+	return jti
+}
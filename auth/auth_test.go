@@ -0,0 +1,275 @@
+package auth
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/mensurowary/juno/auth/lockout"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthenticator(t *testing.T) {
+	columns := []string{"id", "description", "password", "disabled", "scopes", "token_generation", "token_lifetime"}
+
+	t.Run("Successfully authenticates an application with the correct password", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(`^SELECT id, description, password, disabled, scopes, token_generation, token_lifetime FROM applications*`).
+			WithArgs("test").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("test", "Test app", hash(t, "secret"), false, "{resources:read,resources:write}", 3, 3600))
+
+		data, err := authenticator(NewRepository(db), newTestLimiter())(loginContext("test", "secret"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, &Application{
+			ID:              "test",
+			Description:     "Test app",
+			Scopes:          []string{ScopeResourcesRead, ScopeResourcesWrite},
+			TokenGeneration: 3,
+			TokenLifetime:   time.Hour,
+		}, data)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails when the password does not match", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(`^SELECT id, description, password, disabled, scopes, token_generation, token_lifetime FROM applications*`).
+			WithArgs("test").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("test", nil, hash(t, "secret"), false, "{}", 0, nil))
+
+		data, err := authenticator(NewRepository(db), newTestLimiter())(loginContext("test", "not-secret"))
+
+		assert.Nil(t, data)
+		assert.Equal(t, jwt.ErrFailedAuthentication, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails when the application is disabled", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(`^SELECT id, description, password, disabled, scopes, token_generation, token_lifetime FROM applications*`).
+			WithArgs("test").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("test", nil, hash(t, "secret"), true, "{}", 0, nil))
+
+		data, err := authenticator(NewRepository(db), newTestLimiter())(loginContext("test", "secret"))
+
+		assert.Nil(t, data)
+		assert.Equal(t, jwt.ErrFailedAuthentication, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails when the application does not exist", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(`^SELECT id, description, password, disabled, scopes, token_generation, token_lifetime FROM applications*`).
+			WithArgs("ghost").
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		data, err := authenticator(NewRepository(db), newTestLimiter())(loginContext("ghost", "secret"))
+
+		assert.Nil(t, data)
+		assert.Equal(t, jwt.ErrFailedAuthentication, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Compares the password of an unknown application at the cost of the known ones", func(t *testing.T) {
+		hash, err := HashPassword("secret")
+		assert.Nil(t, err)
+		unknownCost, err := bcrypt.Cost([]byte(unknownApplicationHash))
+		assert.Nil(t, err)
+		knownCost, _ := bcrypt.Cost([]byte(hash))
+		assert.Equal(t, knownCost, unknownCost)
+	})
+
+	t.Run("Fails when the query fails", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(`^SELECT id, description, password, disabled, scopes, token_generation, token_lifetime FROM applications*`).
+			WithArgs("test").
+			WillReturnError(errors.New("connection is gone"))
+
+		data, err := authenticator(NewRepository(db), newTestLimiter())(loginContext("test", "secret"))
+
+		assert.Nil(t, data)
+		assert.Equal(t, jwt.ErrFailedAuthentication, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Locks the application out after too many failures", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		limiter := newTestLimiter()
+		for i := 0; i < 3; i++ {
+			mock.ExpectQuery(`^SELECT id, description, password, disabled, scopes, token_generation, token_lifetime FROM applications*`).
+				WithArgs("test").
+				WillReturnRows(sqlmock.NewRows(columns).AddRow("test", nil, hash(t, "secret"), false, "{}", 0, nil))
+			_, err := authenticator(NewRepository(db), limiter)(loginContext("test", "guess"))
+			assert.Equal(t, jwt.ErrFailedAuthentication, err)
+		}
+
+		c := loginContext("test", "secret")
+		data, err := authenticator(NewRepository(db), limiter)(c)
+
+		assert.Nil(t, data)
+		assert.Equal(t, lockout.ErrLockedOut, err)
+		assert.Equal(t, "60", c.Writer.Header().Get("Retry-After"))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails when the login values are missing", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		_, err := authenticator(NewRepository(db), newTestLimiter())(loginContext("", ""))
+
+		assert.Equal(t, jwt.ErrMissingLoginValues, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestAuthorizer(t *testing.T) {
+	columns := []string{"token_generation", "disabled", "revoked"}
+	app := &Application{ID: "test", TokenGeneration: 2}
+
+	tt := []struct {
+		Name     string
+		Row      []driver.Value
+		Expected bool
+	}{
+		{Name: "Authorizes a token of the current generation", Row: []driver.Value{2, false, false}, Expected: true},
+		{Name: "Rejects a logged out token", Row: []driver.Value{2, false, true}, Expected: false},
+		{Name: "Rejects a token of a previous generation", Row: []driver.Value{3, false, false}, Expected: false},
+		{Name: "Rejects a token of a disabled application", Row: []driver.Value{2, true, false}, Expected: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			db, mock := getDbAndMock(t)
+			defer db.Close()
+
+			mock.ExpectQuery(`\s*SELECT a.token_generation, a.disabled, EXISTS*`).
+				WithArgs("test", "token-id").
+				WillReturnRows(sqlmock.NewRows(columns).AddRow(tc.Row...))
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Set("JWT_PAYLOAD", jwt.MapClaims{tokenIDKey: "token-id"})
+
+			assert.Equal(t, tc.Expected, authorizer(NewRepository(db))(app, c))
+			assert.Equal(t, !tc.Expected, c.GetBool(revokedKey))
+			assert.Nil(t, mock.ExpectationsWereMet())
+		})
+	}
+
+	t.Run("Rejects a token of a deleted application", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(`\s*SELECT a.token_generation, a.disabled, EXISTS*`).
+			WithArgs("test", "").
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+		assert.False(t, authorizer(NewRepository(db))(app, c))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestLogoutHandler(t *testing.T) {
+	mw := newTestJWT(t, &jwt.GinJWTMiddleware{
+		Timeout:    time.Minute,
+		MaxRefresh: time.Hour,
+	})
+
+	t.Run("Revokes the token until every token of its chain expires", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectExec(`^DELETE FROM revoked_tokens WHERE expires_on < current_timestamp`).
+			WillReturnResult(sqlmock.NewResult(-1, 0))
+		mock.ExpectExec(`^INSERT INTO revoked_tokens\(jti, app_id, expires_on\)*`).
+			WithArgs("token-id", "test", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Set("JWT_PAYLOAD", jwt.MapClaims{identityKey: "test", tokenIDKey: "token-id"})
+
+		LogoutHandler(mw, NewRepository(db))(c)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Tokens without an id can not be revoked", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Set("JWT_PAYLOAD", jwt.MapClaims{identityKey: "test"})
+
+		LogoutHandler(mw, NewRepository(db))(c)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func newTestJWT(t *testing.T, mw *jwt.GinJWTMiddleware) *JWT {
+	mw.Key = []byte("secret")
+	assert.Nil(t, mw.MiddlewareInit())
+
+	keys, err := NewHMACKeySet("secret")
+	assert.Nil(t, err)
+	return &JWT{GinJWTMiddleware: mw, keys: keys}
+}
+
+func newTestLimiter() *lockout.Limiter {
+	return lockout.NewLimiter(lockout.NewMemoryStore(), lockout.Policy{
+		Threshold: 3,
+		BaseDelay: time.Minute,
+		MaxDelay:  time.Hour,
+		Window:    time.Hour,
+	})
+}
+
+func loginContext(username, password string) *gin.Context {
+	form := url.Values{}
+	form.Set("username", username)
+	form.Set("password", password)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/auth/login", strings.NewReader(form.Encode()))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c
+}
+
+func hash(t *testing.T, password string) string {
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	assert.Nil(t, err)
+	return string(h)
+}
+
+func getDbAndMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	return db, mock
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+var (
+	ErrUnknownCertificate  = errors.New("client certificate does not map to any application")
+	ErrUnknownCertIdentity = errors.New("unknown client certificate identity, must be either subject or san")
+	ErrDisabledApplication = errors.New("application is disabled")
+)
+
+const (
+	// CertIdentitySubject maps the common name of the subject to the application id
+	CertIdentitySubject = "subject"
+	// CertIdentitySAN maps the first of the subject alternative names that is an application id
+	CertIdentitySAN = "san"
+)
+
+// CertificateResolver resolves the application a verified client certificate belongs to
+type CertificateResolver struct {
+	finder   credentialsFinder
+	identity string
+}
+
+func NewCertificateResolver(r *Repository, identity string) (*CertificateResolver, error) {
+	if identity != CertIdentitySubject && identity != CertIdentitySAN {
+		return nil, ErrUnknownCertIdentity
+	}
+	return &CertificateResolver{
+		finder:   r,
+		identity: identity,
+	}, nil
+}
+
+// ResolveCertificate returns the application the certificate is issued to
+func (r *CertificateResolver) ResolveCertificate(cert *x509.Certificate) (*Application, error) {
+	for _, appID := range r.candidates(cert) {
+		creds, err := r.finder.findCredentials(appID)
+		if err == ErrApplicationNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if creds.Disabled {
+			log.Infof("Disabled application [%s] tried to authenticate with a client certificate", creds.ID)
+			return nil, ErrDisabledApplication
+		}
+		return creds.application(), nil
+	}
+	return nil, ErrUnknownCertificate
+}
+
+func (r *CertificateResolver) candidates(cert *x509.Certificate) []string {
+	if r.identity == CertIdentitySubject {
+		return nonEmpty(cert.Subject.CommonName)
+	}
+
+	var names []string
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	return nonEmpty(names...)
+}
+
+func nonEmpty(values ...string) []string {
+	var result []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func TestCertificateResolver(t *testing.T) {
+	columns := []string{"id", "description", "password", "disabled", "scopes", "token_generation", "token_lifetime"}
+	query := `^SELECT id, description, password, disabled, scopes, token_generation, token_lifetime FROM applications*`
+
+	t.Run("Maps the common name of the subject", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(query).
+			WithArgs("reports").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("reports", nil, "", false, "{resources:read}", 0, nil))
+
+		resolver, err := NewCertificateResolver(NewRepository(db), CertIdentitySubject)
+		assert.Nil(t, err)
+		app, err := resolver.ResolveCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "reports"}})
+
+		assert.Nil(t, err)
+		assert.Equal(t, &Application{ID: "reports", Scopes: []string{ScopeResourcesRead}}, app)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Maps the first subject alternative name that is an application", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(query).
+			WithArgs("spiffe://corp/reports").
+			WillReturnRows(sqlmock.NewRows(columns))
+		mock.ExpectQuery(query).
+			WithArgs("reports.internal").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("reports.internal", nil, "", false, "{}", 0, nil))
+
+		resolver, err := NewCertificateResolver(NewRepository(db), CertIdentitySAN)
+		assert.Nil(t, err)
+		uri, _ := url.Parse("spiffe://corp/reports")
+		app, err := resolver.ResolveCertificate(&x509.Certificate{
+			Subject:  pkix.Name{CommonName: "ignored"},
+			URIs:     []*url.URL{uri},
+			DNSNames: []string{"reports.internal", "other.internal"},
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "reports.internal", app.ID)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rejects the disabled applications", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(query).
+			WithArgs("reports").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("reports", nil, "", true, "{}", 0, nil))
+
+		resolver, _ := NewCertificateResolver(NewRepository(db), CertIdentitySubject)
+		_, err := resolver.ResolveCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "reports"}})
+
+		assert.Equal(t, ErrDisabledApplication, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails when nothing maps to an application", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		resolver, _ := NewCertificateResolver(NewRepository(db), CertIdentitySAN)
+		_, err := resolver.ResolveCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "reports"}})
+
+		assert.Equal(t, ErrUnknownCertificate, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails with an unknown identity", func(t *testing.T) {
+		_, err := NewCertificateResolver(nil, "issuer")
+		assert.Equal(t, ErrUnknownCertIdentity, err)
+	})
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+var (
+	ErrApplicationNotFound  = errors.New("could not find the application")
+	ErrCouldNotRetrieveData = errors.New("could not retrieve the application data")
+	ErrTokenRevoked         = errors.New("token has been revoked")
+	ErrCouldNotRevokeToken  = errors.New("could not revoke the token")
+)
+
+// Repository is the data access layer of the applications
+type Repository struct {
+	db *sql.DB
+}
+
+// credentials represents the stored login information of an application
+type credentials struct {
+	ID, Description, PasswordHash string
+	Disabled                      bool
+	Scopes                        []string
+	TokenGeneration               int64
+	TokenLifetime                 time.Duration
+}
+
+// application is the identity the credentials authenticate as
+func (c *credentials) application() *Application {
+	return &Application{
+		ID:              c.ID,
+		Description:     c.Description,
+		Scopes:          c.Scopes,
+		TokenGeneration: c.TokenGeneration,
+		TokenLifetime:   c.TokenLifetime,
+	}
+}
+
+type credentialsFinder interface {
+	findCredentials(appID string) (*credentials, error)
+}
+
+type tokenChecker interface {
+	checkToken(appID, tokenID string, generation int64) error
+}
+
+type tokenRevoker interface {
+	revokeToken(tokenID, appID string, until time.Time) error
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db}
+}
+
+// findCredentials retrieves the stored credentials of the application with the given id
+func (r *Repository) findCredentials(appID string) (*credentials, error) {
+	var (
+		id, passwordHash string
+		description      sql.NullString
+		disabled         bool
+		scopes           []string
+		generation       int64
+		lifetime         sql.NullInt64
+	)
+
+	row := r.db.QueryRow(`SELECT id, description, password, disabled, scopes, token_generation, token_lifetime FROM applications WHERE id = $1`, appID)
+	if err := row.Scan(&id, &description, &passwordHash, &disabled, pq.Array(&scopes), &generation, &lifetime); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrApplicationNotFound
+		}
+		log.Errorf("Error occurred while retrieving the application [%s] : %v", appID, err)
+		return nil, ErrCouldNotRetrieveData
+	}
+
+	return &credentials{
+		ID:              id,
+		Description:     description.String,
+		PasswordHash:    passwordHash,
+		Disabled:        disabled,
+		Scopes:          scopes,
+		TokenGeneration: generation,
+		TokenLifetime:   time.Duration(lifetime.Int64) * time.Second,
+	}, nil
+}
+
+// checkToken makes sure the token was neither logged out nor issued before all the tokens of the application got revoked
+func (r *Repository) checkToken(appID, tokenID string, generation int64) error {
+	var (
+		current           int64
+		disabled, revoked bool
+	)
+
+	row := r.db.QueryRow(`
+		SELECT a.token_generation, a.disabled, EXISTS(SELECT 1 FROM revoked_tokens t WHERE t.jti = $2)
+		FROM applications a
+		WHERE a.id = $1
+	`, appID, tokenID)
+	if err := row.Scan(&current, &disabled, &revoked); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrTokenRevoked
+		}
+		log.Errorf("Error occurred while checking the token of the application [%s] : %v", appID, err)
+		return ErrCouldNotRetrieveData
+	}
+
+	if disabled || revoked || current != generation {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+func (r *Repository) revokeToken(tokenID, appID string, until time.Time) error {
+	// the entries are useless once all the tokens they refer to are expired
+	if _, err := r.db.Exec(`DELETE FROM revoked_tokens WHERE expires_on < current_timestamp`); err != nil {
+		log.Errorf("Could not clean up the revoked tokens : %v", err)
+	}
+
+	_, err := r.db.Exec(
+		`INSERT INTO revoked_tokens(jti, app_id, expires_on) VALUES ($1, $2, $3) ON CONFLICT (jti) DO NOTHING`,
+		tokenID, appID, until)
+	if err != nil {
+		log.Errorf("Could not revoke the token of the application [%s] : %v", appID, err)
+		return ErrCouldNotRevokeToken
+	}
+	return nil
+}
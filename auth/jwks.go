@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"math/big"
+	"net/http"
+	"sort"
+)
+
+// JWK is the JSON web key representation of a public key
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is the JSON web key set other services verify the tokens with
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set, the shared secrets are never published
+func (k *KeySet) JWKS() JWKS {
+	keys := make([]JWK, 0, len(k.keys))
+	for _, key := range k.keys {
+		if jwk, ok := key.jwk(); ok {
+			keys = append(keys, jwk)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Kid < keys[j].Kid
+	})
+	return JWKS{keys}
+}
+
+// JWKSHandler publishes the key set, e.g. under /.well-known/jwks.json
+func JWKSHandler(keys *KeySet) gin.HandlerFunc {
+	jwks := keys.JWKS()
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, jwks)
+	}
+}
+
+func (s *signingKey) jwk() (JWK, bool) {
+	if !s.isPublic() {
+		return JWK{}, false
+	}
+
+	jwk := JWK{
+		Use: "sig",
+		Alg: s.Method.Alg(),
+		Kid: s.ID,
+	}
+
+	switch key := s.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encode(key.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = key.Curve.Params().Name
+		jwk.X = encode(padded(key.X.Bytes(), size))
+		jwk.Y = encode(padded(key.Y.Bytes(), size))
+	}
+	return jwk, true
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// padded left pads the coordinate to the curve size, as required by RFC 7518
+func padded(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	result := make([]byte, size)
+	copy(result[size-len(b):], b)
+	return result
+}
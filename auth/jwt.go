@@ -0,0 +1,200 @@
+package auth
+
+import (
+	jwt "github.com/appleboy/gin-jwt/v2"
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/mensurowary/juno/auth/lockout"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// JWT is the gin-jwt middleware whose tokens are signed and verified with the key set,
+// gin-jwt still holds the configuration, the callbacks and the responses
+type JWT struct {
+	*jwt.GinJWTMiddleware
+	keys *KeySet
+}
+
+// LoginHandler issues a token to the authenticated application
+func (j *JWT) LoginHandler(c *gin.Context) {
+	j.login(c, j.Authenticator)
+}
+
+// login issues a token to the application the authenticator resolves
+func (j *JWT) login(c *gin.Context, authenticator func(c *gin.Context) (interface{}, error)) {
+	data, err := authenticator(c)
+	if err != nil {
+		code := http.StatusUnauthorized
+		if err == lockout.ErrLockedOut {
+			code = http.StatusTooManyRequests
+		}
+		j.unauthorized(c, code, j.HTTPStatusMessageFunc(err, c))
+		return
+	}
+
+	token, expire, err := j.TokenGenerator(data)
+	if err != nil {
+		j.unauthorized(c, http.StatusUnauthorized, j.HTTPStatusMessageFunc(jwt.ErrFailedTokenCreation, c))
+		return
+	}
+
+	j.LoginResponse(c, http.StatusOK, token, expire)
+}
+
+// TokenGenerator creates a signed token with the payload of the given identity
+func (j *JWT) TokenGenerator(data interface{}) (string, time.Time, error) {
+	claims := jwtgo.MapClaims{}
+	if j.PayloadFunc != nil {
+		for key, value := range j.PayloadFunc(data) {
+			claims[key] = value
+		}
+	}
+	return j.signWithExpiry(claims)
+}
+
+// MiddlewareFunc validates the token and resolves the identity
+func (j *JWT) MiddlewareFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := j.ParseToken(c)
+		if err != nil {
+			j.unauthorized(c, http.StatusUnauthorized, j.HTTPStatusMessageFunc(err, c))
+			return
+		}
+
+		claims := jwt.MapClaims(token.Claims.(jwtgo.MapClaims))
+		if _, ok := claims["exp"].(float64); !ok {
+			j.unauthorized(c, http.StatusBadRequest, j.HTTPStatusMessageFunc(jwt.ErrMissingExpField, c))
+			return
+		}
+
+		c.Set("JWT_PAYLOAD", claims)
+		identity := j.IdentityHandler(c)
+		if identity != nil {
+			c.Set(j.IdentityKey, identity)
+		}
+
+		if !j.Authorizator(identity, c) {
+			j.unauthorized(c, http.StatusForbidden, j.HTTPStatusMessageFunc(jwt.ErrForbidden, c))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RefreshHandler issues a new token for a token that is still within the refresh window
+func (j *JWT) RefreshHandler(c *gin.Context) {
+	token, err := j.ParseToken(c)
+	if err != nil {
+		// expired tokens can still be refreshed within the refresh window
+		validationErr, ok := err.(*jwtgo.ValidationError)
+		if !ok || validationErr.Errors != jwtgo.ValidationErrorExpired {
+			j.unauthorized(c, http.StatusUnauthorized, j.HTTPStatusMessageFunc(err, c))
+			return
+		}
+	}
+
+	claims := token.Claims.(jwtgo.MapClaims)
+	origIat, _ := claims["orig_iat"].(float64)
+	if int64(origIat) < j.TimeFunc().Add(-j.MaxRefresh).Unix() {
+		j.unauthorized(c, http.StatusUnauthorized, j.HTTPStatusMessageFunc(jwt.ErrExpiredToken, c))
+		return
+	}
+
+	newClaims := jwtgo.MapClaims{}
+	for key, value := range claims {
+		newClaims[key] = value
+	}
+
+	tokenString, expire, err := j.signWithExpiry(newClaims)
+	if err != nil {
+		j.unauthorized(c, http.StatusUnauthorized, j.HTTPStatusMessageFunc(jwt.ErrFailedTokenCreation, c))
+		return
+	}
+
+	j.RefreshResponse(c, http.StatusOK, tokenString, expire)
+}
+
+// ParseToken parses the token found in the request, expired tokens are returned along with the error
+func (j *JWT) ParseToken(c *gin.Context) (*jwtgo.Token, error) {
+	tokenString, err := j.lookupToken(c)
+	if err != nil {
+		return nil, err
+	}
+	return j.keys.parse(tokenString)
+}
+
+func (j *JWT) signWithExpiry(claims jwtgo.MapClaims) (string, time.Time, error) {
+	expire := j.TimeFunc().Add(j.lifetime(claims))
+	claims["exp"] = expire.Unix()
+	claims["orig_iat"] = j.TimeFunc().Unix()
+
+	tokenString, err := j.keys.sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenString, expire, nil
+}
+
+// lifetime is the lifetime the application has been granted, if any, or the default one
+func (j *JWT) lifetime(claims map[string]interface{}) time.Duration {
+	switch seconds := claims[lifetimeKey].(type) {
+	case int64:
+		return time.Duration(seconds) * time.Second
+	case float64:
+		return time.Duration(seconds) * time.Second
+	}
+	return j.Timeout
+}
+
+// lookupToken looks for the token in the places listed in TokenLookup, in order
+func (j *JWT) lookupToken(c *gin.Context) (string, error) {
+	err := jwt.ErrEmptyAuthHeader
+	for _, method := range strings.Split(j.TokenLookup, ",") {
+		parts := strings.SplitN(strings.TrimSpace(method), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		source, key := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+		var token string
+		switch source {
+		case "header":
+			token, err = j.tokenFromHeader(c, key)
+		case "query":
+			if token = c.Query(key); token == "" {
+				err = jwt.ErrEmptyQueryToken
+			}
+		case "cookie":
+			if token, _ = c.Cookie(key); token == "" {
+				err = jwt.ErrEmptyCookieToken
+			}
+		}
+
+		if token != "" {
+			return token, nil
+		}
+	}
+	return "", err
+}
+
+func (j *JWT) tokenFromHeader(c *gin.Context, key string) (string, error) {
+	header := c.GetHeader(key)
+	if header == "" {
+		return "", jwt.ErrEmptyAuthHeader
+	}
+
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || parts[0] != j.TokenHeadName {
+		return "", jwt.ErrInvalidAuthHeader
+	}
+	return parts[1], nil
+}
+
+func (j *JWT) unauthorized(c *gin.Context, code int, message string) {
+	c.Header("WWW-Authenticate", "JWT realm="+j.Realm)
+	c.Abort()
+	j.Unauthorized(c, code, message)
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	jwt "github.com/appleboy/gin-jwt/v2"
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJWT_TokenGenerator(t *testing.T) {
+	now := time.Date(2020, time.July, 1, 12, 0, 0, 0, time.UTC)
+	mw := newTestJWT(t, &jwt.GinJWTMiddleware{
+		Timeout:     15 * time.Minute,
+		PayloadFunc: payloadHandler(),
+		TimeFunc: func() time.Time {
+			return now
+		},
+	})
+
+	t.Run("Uses the default lifetime", func(t *testing.T) {
+		_, expire, err := mw.TokenGenerator(&Application{ID: "test"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, now.Add(15*time.Minute), expire)
+	})
+
+	t.Run("Uses the lifetime of the application when set", func(t *testing.T) {
+		token, expire, err := mw.TokenGenerator(&Application{ID: "test", TokenLifetime: 2 * time.Hour})
+
+		assert.Nil(t, err)
+		assert.Equal(t, now.Add(2*time.Hour), expire)
+
+		parsed, _ := mw.keys.parse(token)
+		assert.Equal(t, 2*time.Hour, mw.lifetime(parsed.Claims.(jwtgo.MapClaims)))
+	})
+}
+
+func TestJWT_lookupToken(t *testing.T) {
+	mw := newTestJWT(t, &jwt.GinJWTMiddleware{
+		TokenLookup: "header: Authorization, query: token, cookie: jwt",
+	})
+
+	tt := []struct {
+		Name    string
+		Prepare func(r *http.Request)
+	}{
+		{Name: "From the header", Prepare: func(r *http.Request) { r.Header.Set("Authorization", "Bearer abc") }},
+		{Name: "From the query", Prepare: func(r *http.Request) { r.URL.RawQuery = "token=abc" }},
+		{Name: "From the cookie", Prepare: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "jwt", Value: "abc"}) }},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			tc.Prepare(c.Request)
+
+			token, err := mw.lookupToken(c)
+
+			assert.Nil(t, err)
+			assert.Equal(t, "abc", token)
+		})
+	}
+
+	t.Run("Fails when the token is nowhere", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
+		_, err := mw.lookupToken(c)
+
+		assert.NotNil(t, err)
+	})
+}
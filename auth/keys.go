@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrUnknownSigningKey       = errors.New("token was signed with an unknown key")
+	ErrUnsupportedAlgorithm    = errors.New("unsupported signing algorithm, must be one of HS256, RS256 or ES256")
+	ErrMissingSigningKey       = errors.New("signing key is required")
+	ErrInvalidSigningAlgorithm = errors.New("token was signed with an unexpected algorithm")
+)
+
+// signingKey is a single key of the key set, the private part is absent for the retiring keys
+type signingKey struct {
+	ID         string
+	Method     jwtgo.SigningMethod
+	PrivateKey interface{}
+	PublicKey  interface{}
+}
+
+// KeySet holds the key the tokens are signed with and all the keys the tokens are verified with
+type KeySet struct {
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+// NewHMACKeySet creates a key set that signs and verifies with the shared secret
+func NewHMACKeySet(secret string) (*KeySet, error) {
+	if secret == "" {
+		return nil, ErrMissingSigningKey
+	}
+	key := &signingKey{
+		Method:     jwtgo.SigningMethodHS256,
+		PrivateKey: []byte(secret),
+		PublicKey:  []byte(secret),
+	}
+	return &KeySet{
+		active: key,
+		keys:   map[string]*signingKey{},
+	}, nil
+}
+
+// NewAsymmetricKeySet creates a key set that signs with the private key in the signing key file
+// and additionally verifies with the keys in the verification key files.
+// The ids of the keys are the file names without the extensions.
+func NewAsymmetricKeySet(algorithm, signingKeyFile string, verificationKeyFiles []string) (*KeySet, error) {
+	method := jwtgo.GetSigningMethod(algorithm)
+	if method != jwtgo.SigningMethodRS256 && method != jwtgo.SigningMethodES256 {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	if signingKeyFile == "" {
+		return nil, ErrMissingSigningKey
+	}
+
+	active, err := loadKey(method, signingKeyFile, true)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &KeySet{
+		active: active,
+		keys:   map[string]*signingKey{active.ID: active},
+	}
+
+	for _, file := range verificationKeyFiles {
+		key, err := loadKey(method, file, false)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := set.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate key id %s", key.ID)
+		}
+		set.keys[key.ID] = key
+	}
+	return set, nil
+}
+
+func (k *KeySet) sign(claims jwtgo.MapClaims) (string, error) {
+	token := jwtgo.NewWithClaims(k.active.Method, claims)
+	if k.active.ID != "" {
+		token.Header["kid"] = k.active.ID
+	}
+	return token.SignedString(k.active.PrivateKey)
+}
+
+func (k *KeySet) parse(tokenString string) (*jwtgo.Token, error) {
+	return jwtgo.Parse(tokenString, k.keyFunc)
+}
+
+func (k *KeySet) keyFunc(token *jwtgo.Token) (interface{}, error) {
+	key := k.active
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		if key, ok = k.keys[kid]; !ok {
+			return nil, ErrUnknownSigningKey
+		}
+	} else if k.active.ID != "" {
+		// asymmetric tokens are always issued with a kid
+		return nil, ErrUnknownSigningKey
+	}
+
+	if token.Method != key.Method {
+		return nil, ErrInvalidSigningAlgorithm
+	}
+	return key.PublicKey, nil
+}
+
+func loadKey(method jwtgo.SigningMethod, file string, private bool) (*signingKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the key file %s : %v", file, err)
+	}
+
+	key := &signingKey{
+		ID:     strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)),
+		Method: method,
+	}
+
+	if private {
+		err = key.parsePrivate(data)
+	} else if err = key.parsePublic(data); err != nil {
+		// a retiring key can just as well be given with its private part
+		err = key.parsePrivate(data)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the key file %s : %v", file, err)
+	}
+	return key, nil
+}
+
+func (s *signingKey) parsePrivate(data []byte) error {
+	if s.Method == jwtgo.SigningMethodRS256 {
+		key, err := jwtgo.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return err
+		}
+		s.PrivateKey, s.PublicKey = key, &key.PublicKey
+		return nil
+	}
+
+	key, err := jwtgo.ParseECPrivateKeyFromPEM(data)
+	if err != nil {
+		return err
+	}
+	s.PrivateKey, s.PublicKey = key, &key.PublicKey
+	return nil
+}
+
+func (s *signingKey) parsePublic(data []byte) error {
+	var (
+		key interface{}
+		err error
+	)
+	if s.Method == jwtgo.SigningMethodRS256 {
+		key, err = jwtgo.ParseRSAPublicKeyFromPEM(data)
+	} else {
+		key, err = jwtgo.ParseECPublicKeyFromPEM(data)
+	}
+	if err != nil {
+		return err
+	}
+	s.PublicKey = key
+	return nil
+}
+
+// isPublic tells whether the key can be published, which is never the case for the shared secrets
+func (s *signingKey) isPublic() bool {
+	switch s.PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return true
+	}
+	return false
+}
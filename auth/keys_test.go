@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAsymmetricKeySet(t *testing.T) {
+	dir := tempDir(t)
+	claims := func() jwtgo.MapClaims {
+		return jwtgo.MapClaims{identityKey: "test", "exp": time.Now().Add(time.Minute).Unix()}
+	}
+
+	t.Run("Signs with the kid of the active key and verifies it", func(t *testing.T) {
+		keys, err := NewAsymmetricKeySet("ES256", writeECKey(t, dir, "2020-07"), nil)
+		assert.Nil(t, err)
+
+		tokenString, err := keys.sign(claims())
+		assert.Nil(t, err)
+
+		token, err := keys.parse(tokenString)
+		assert.Nil(t, err)
+		assert.Equal(t, "2020-07", token.Header["kid"])
+		assert.Equal(t, "ES256", token.Header["alg"])
+	})
+
+	t.Run("Tokens of the retiring key keep validating after the rotation", func(t *testing.T) {
+		oldKey := writeRSAKey(t, dir, "old")
+		oldKeys, err := NewAsymmetricKeySet("RS256", oldKey, nil)
+		assert.Nil(t, err)
+		tokenString, err := oldKeys.sign(claims())
+		assert.Nil(t, err)
+
+		rotated, err := NewAsymmetricKeySet("RS256", writeRSAKey(t, dir, "new"), []string{oldKey})
+		assert.Nil(t, err)
+
+		token, err := rotated.parse(tokenString)
+		assert.Nil(t, err)
+		assert.True(t, token.Valid)
+
+		newToken, err := rotated.sign(claims())
+		assert.Nil(t, err)
+		parsed, _ := rotated.parse(newToken)
+		assert.Equal(t, "new", parsed.Header["kid"])
+	})
+
+	t.Run("Rejects the tokens of the removed keys", func(t *testing.T) {
+		removed, err := NewAsymmetricKeySet("RS256", writeRSAKey(t, dir, "removed"), nil)
+		assert.Nil(t, err)
+		tokenString, err := removed.sign(claims())
+		assert.Nil(t, err)
+
+		keys, err := NewAsymmetricKeySet("RS256", writeRSAKey(t, dir, "current"), nil)
+		assert.Nil(t, err)
+
+		_, err = keys.parse(tokenString)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Rejects the tokens signed with the shared secret", func(t *testing.T) {
+		hmac, err := NewHMACKeySet("secret")
+		assert.Nil(t, err)
+		tokenString, err := hmac.sign(claims())
+		assert.Nil(t, err)
+
+		keys, err := NewAsymmetricKeySet("RS256", writeRSAKey(t, dir, "strict"), nil)
+		assert.Nil(t, err)
+
+		_, err = keys.parse(tokenString)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Fails with an unsupported algorithm", func(t *testing.T) {
+		_, err := NewAsymmetricKeySet("PS512", writeRSAKey(t, dir, "pss"), nil)
+		assert.Equal(t, ErrUnsupportedAlgorithm, err)
+	})
+
+	t.Run("Fails when the key does not match the algorithm", func(t *testing.T) {
+		_, err := NewAsymmetricKeySet("RS256", writeECKey(t, dir, "mismatch"), nil)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestKeySet_JWKS(t *testing.T) {
+	dir := tempDir(t)
+
+	t.Run("Publishes the public parts of all the keys", func(t *testing.T) {
+		keys, err := NewAsymmetricKeySet("ES256", writeECKey(t, dir, "b"), []string{writeECKey(t, dir, "a")})
+		assert.Nil(t, err)
+
+		jwks := keys.JWKS()
+
+		assert.Len(t, jwks.Keys, 2)
+		assert.Equal(t, "a", jwks.Keys[0].Kid)
+		assert.Equal(t, "b", jwks.Keys[1].Kid)
+		for _, key := range jwks.Keys {
+			assert.Equal(t, "EC", key.Kty)
+			assert.Equal(t, "P-256", key.Crv)
+			assert.Equal(t, "ES256", key.Alg)
+			assert.Len(t, key.X, 43)
+			assert.Len(t, key.Y, 43)
+		}
+	})
+
+	t.Run("Never publishes the shared secret", func(t *testing.T) {
+		keys, err := NewHMACKeySet("secret")
+		assert.Nil(t, err)
+
+		assert.Empty(t, keys.JWKS().Keys)
+	})
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "juno-keys")
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+	return dir
+}
+
+func writeRSAKey(t *testing.T, dir, kid string) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	return writePEM(t, dir, kid, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+}
+
+func writeECKey(t *testing.T, dir, kid string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	return writePEM(t, dir, kid, "EC PRIVATE KEY", der)
+}
+
+func writePEM(t *testing.T, dir, kid, blockType string, der []byte) string {
+	file := filepath.Join(dir, kid+".pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	assert.Nil(t, ioutil.WriteFile(file, data, 0600))
+	return file
+}
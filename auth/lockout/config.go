@@ -0,0 +1,27 @@
+package lockout
+
+import (
+	"database/sql"
+	"github.com/mensurowary/juno/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// FromConfig creates the limiter with the store and the policy in the config
+func FromConfig(db *sql.DB) *Limiter {
+	var store Store
+	switch config.Config.LoginLockoutStore {
+	case "memory":
+		store = NewMemoryStore()
+	case "postgres":
+		store = NewPostgresStore(db)
+	default:
+		log.Fatal(ErrUnknownStore)
+	}
+
+	return NewLimiter(store, Policy{
+		Threshold: config.Config.LoginLockoutThreshold,
+		BaseDelay: config.Config.LoginLockoutBaseDelay,
+		MaxDelay:  config.Config.LoginLockoutMaxDelay,
+		Window:    config.Config.LoginLockoutWindow,
+	})
+}
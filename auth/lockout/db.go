@@ -0,0 +1,77 @@
+package lockout
+
+import (
+	"database/sql"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// PostgresStore keeps the attempts in the database, so the lockouts are shared between the replicas
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db}
+}
+
+func (p *PostgresStore) RecordFailure(key string, at, forgetBefore time.Time) (Attempts, error) {
+	if _, err := p.db.Exec(`DELETE FROM login_failures WHERE last_failure < $1`, forgetBefore); err != nil {
+		log.Errorf("Could not clean up the login failures : %v", err)
+	}
+
+	attempts := Attempts{Key: key}
+	row := p.db.QueryRow(`
+		INSERT INTO login_failures(key, failures, last_failure) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_failures.last_failure < $3 THEN 1 ELSE login_failures.failures + 1 END,
+			last_failure = $2
+		RETURNING failures, last_failure
+	`, key, at, forgetBefore)
+	if err := row.Scan(&attempts.Failures, &attempts.LastFailure); err != nil {
+		log.Errorf("Could not record the login failure of [%s] : %v", key, err)
+		return Attempts{}, ErrCouldNotPersist
+	}
+	return attempts, nil
+}
+
+func (p *PostgresStore) Get(key string) (Attempts, error) {
+	attempts := Attempts{Key: key}
+	row := p.db.QueryRow(`SELECT failures, last_failure FROM login_failures WHERE key = $1`, key)
+	if err := row.Scan(&attempts.Failures, &attempts.LastFailure); err != nil {
+		if err == sql.ErrNoRows {
+			return Attempts{}, nil
+		}
+		log.Errorf("Could not retrieve the login failures of [%s] : %v", key, err)
+		return Attempts{}, ErrCouldNotRetrieveResults
+	}
+	return attempts, nil
+}
+
+func (p *PostgresStore) List() ([]Attempts, error) {
+	rows, err := p.db.Query(`SELECT key, failures, last_failure FROM login_failures ORDER BY key`)
+	if err != nil {
+		log.Errorf("Could not retrieve the login failures : %v", err)
+		return nil, ErrCouldNotRetrieveResults
+	}
+	defer rows.Close()
+
+	var all []Attempts
+	for rows.Next() {
+		var attempts Attempts
+		if err := rows.Scan(&attempts.Key, &attempts.Failures, &attempts.LastFailure); err != nil {
+			log.Errorf("Error occurred while mapping the results to objects : %v", err)
+			return nil, ErrCouldNotRetrieveResults
+		}
+		all = append(all, attempts)
+	}
+	return all, nil
+}
+
+func (p *PostgresStore) Reset(key string) error {
+	if _, err := p.db.Exec(`DELETE FROM login_failures WHERE key = $1`, key); err != nil {
+		log.Errorf("Could not reset the login failures of [%s] : %v", key, err)
+		return ErrCouldNotPersist
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package lockout
+
+import (
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// Check returns ErrLockedOut along with the time left if any of the keys is locked out
+func (l *Limiter) Check(keys ...string) (time.Duration, error) {
+	now := l.now()
+	var longest time.Duration
+	for _, key := range keys {
+		attempts, err := l.store.Get(key)
+		if err != nil {
+			// failing closed would let the attackers lock everyone out by breaking the store
+			log.Errorf("Could not check the lockout of [%s] : %v", key, err)
+			continue
+		}
+		if until := l.lockedUntil(attempts); until != nil && until.After(now) {
+			if left := until.Sub(now); left > longest {
+				longest = left
+			}
+		}
+	}
+
+	if longest > 0 {
+		return longest, ErrLockedOut
+	}
+	return 0, nil
+}
+
+// Failure records a failed attempt for each of the keys
+func (l *Limiter) Failure(keys ...string) {
+	now := l.now()
+	for _, key := range keys {
+		attempts, err := l.store.RecordFailure(key, now, now.Add(-l.policy.Window))
+		if err != nil {
+			log.Errorf("Could not record the failed attempt of [%s] : %v", key, err)
+			continue
+		}
+		if until := l.lockedUntil(attempts); until != nil {
+			log.Warnf("[%s] is locked out until %s after %d failed attempts", key, until.Format(time.RFC3339), attempts.Failures)
+		}
+	}
+}
+
+// Success forgets the failed attempts of the keys
+func (l *Limiter) Success(keys ...string) {
+	for _, key := range keys {
+		if err := l.store.Reset(key); err != nil {
+			log.Errorf("Could not reset the failed attempts of [%s] : %v", key, err)
+		}
+	}
+}
+
+// States lists the keys with failed attempts along with their lockouts
+func (l *Limiter) States() ([]State, error) {
+	all, err := l.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	forgetBefore := l.now().Add(-l.policy.Window)
+	states := make([]State, 0, len(all))
+	for _, attempts := range all {
+		if attempts.LastFailure.Before(forgetBefore) {
+			continue
+		}
+		states = append(states, State{
+			Attempts:    attempts,
+			LockedUntil: l.lockedUntil(attempts),
+		})
+	}
+	return states, nil
+}
+
+// Reset lifts the lockout of the key
+func (l *Limiter) Reset(key string) error {
+	return l.store.Reset(key)
+}
+
+func (l *Limiter) lockedUntil(attempts Attempts) *time.Time {
+	if attempts.Failures < l.policy.Threshold || attempts.LastFailure.Before(l.now().Add(-l.policy.Window)) {
+		return nil
+	}
+
+	delay := l.policy.BaseDelay
+	for i := l.policy.Threshold; i < attempts.Failures && delay < l.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > l.policy.MaxDelay {
+		delay = l.policy.MaxDelay
+	}
+
+	until := attempts.LastFailure.Add(delay)
+	return &until
+}
@@ -0,0 +1,174 @@
+package lockout
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var policy = Policy{
+	Threshold: 3,
+	BaseDelay: time.Minute,
+	MaxDelay:  5 * time.Minute,
+	Window:    time.Hour,
+}
+
+func TestLimiter(t *testing.T) {
+	t.Run("Locks the key out once the threshold is reached", func(t *testing.T) {
+		limiter, clock := newTestLimiter()
+
+		limiter.Failure("app:test", "ip:10.0.0.1")
+		limiter.Failure("app:test", "ip:10.0.0.1")
+		_, err := limiter.Check("app:test", "ip:10.0.0.1")
+		assert.Nil(t, err)
+
+		limiter.Failure("app:test", "ip:10.0.0.1")
+		left, err := limiter.Check("app:test")
+		assert.Equal(t, ErrLockedOut, err)
+		assert.Equal(t, time.Minute, left)
+
+		*clock = clock.Add(time.Minute)
+		_, err = limiter.Check("app:test")
+		assert.Nil(t, err)
+	})
+
+	t.Run("Doubles the lockout with every further failure up to the maximum", func(t *testing.T) {
+		limiter, _ := newTestLimiter()
+
+		expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+		for i := 0; i < policy.Threshold-1; i++ {
+			limiter.Failure("ip:10.0.0.1")
+		}
+		for _, delay := range expected {
+			limiter.Failure("ip:10.0.0.1")
+			left, err := limiter.Check("ip:10.0.0.1")
+			assert.Equal(t, ErrLockedOut, err)
+			assert.Equal(t, delay, left)
+		}
+	})
+
+	t.Run("Forgets the failures outside of the window", func(t *testing.T) {
+		limiter, clock := newTestLimiter()
+
+		limiter.Failure("app:test")
+		limiter.Failure("app:test")
+		*clock = clock.Add(2 * time.Hour)
+		limiter.Failure("app:test")
+
+		_, err := limiter.Check("app:test")
+		assert.Nil(t, err)
+		states, _ := limiter.States()
+		assert.Equal(t, 1, states[0].Failures)
+	})
+
+	t.Run("Success and reset lift the lockout", func(t *testing.T) {
+		limiter, _ := newTestLimiter()
+		for i := 0; i < policy.Threshold; i++ {
+			limiter.Failure("app:test", "ip:10.0.0.1")
+		}
+
+		limiter.Success("app:test")
+		_, err := limiter.Check("app:test")
+		assert.Nil(t, err)
+
+		assert.Nil(t, limiter.Reset("ip:10.0.0.1"))
+		_, err = limiter.Check("ip:10.0.0.1")
+		assert.Nil(t, err)
+	})
+
+	t.Run("Lists the states with their lockouts", func(t *testing.T) {
+		limiter, clock := newTestLimiter()
+		for i := 0; i < policy.Threshold; i++ {
+			limiter.Failure("app:test")
+		}
+		limiter.Failure("ip:10.0.0.1")
+
+		states, err := limiter.States()
+
+		assert.Nil(t, err)
+		lockedUntil := clock.Add(time.Minute)
+		assert.Equal(t, []State{
+			{Attempts: Attempts{Key: "app:test", Failures: 3, LastFailure: *clock}, LockedUntil: &lockedUntil},
+			{Attempts: Attempts{Key: "ip:10.0.0.1", Failures: 1, LastFailure: *clock}},
+		}, states)
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	t.Run("Evicts the oldest entries when the ones remembered fill the store", func(t *testing.T) {
+		store := NewMemoryStore()
+		now := time.Now()
+		forgetBefore := now.Add(-policy.Window)
+
+		for i := 0; i < maxMemoryEntries; i++ {
+			_, err := store.RecordFailure(fmt.Sprintf("ip:%d", i), now.Add(time.Duration(i)*time.Millisecond), forgetBefore)
+			assert.Nil(t, err)
+		}
+		_, err := store.RecordFailure("ip:flood", now.Add(time.Hour), forgetBefore)
+		assert.Nil(t, err)
+
+		all, _ := store.List()
+		assert.Equal(t, maxMemoryEntries*9/10+1, len(all))
+		oldest, _ := store.Get("ip:0")
+		assert.Equal(t, 0, oldest.Failures)
+		newest, _ := store.Get(fmt.Sprintf("ip:%d", maxMemoryEntries-1))
+		assert.Equal(t, 1, newest.Failures)
+		flood, _ := store.Get("ip:flood")
+		assert.Equal(t, 1, flood.Failures)
+	})
+}
+
+func TestPostgresStore(t *testing.T) {
+	now := time.Now()
+
+	t.Run("Records the failure", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectExec(`^DELETE FROM login_failures WHERE last_failure < \$1`).
+			WithArgs(now.Add(-time.Hour)).
+			WillReturnResult(sqlmock.NewResult(-1, 0))
+		mock.ExpectQuery(`^INSERT INTO login_failures\(key, failures, last_failure\) VALUES \(\$1, 1, \$2\)*`).
+			WithArgs("app:test", now, now.Add(-time.Hour)).
+			WillReturnRows(sqlmock.NewRows([]string{"failures", "last_failure"}).AddRow(4, now))
+
+		attempts, err := NewPostgresStore(db).RecordFailure("app:test", now, now.Add(-time.Hour))
+
+		assert.Nil(t, err)
+		assert.Equal(t, Attempts{Key: "app:test", Failures: 4, LastFailure: now}, attempts)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Returns no attempts for an unknown key", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(`^SELECT failures, last_failure FROM login_failures WHERE key = \$1`).
+			WithArgs("ip:10.0.0.1").
+			WillReturnRows(sqlmock.NewRows([]string{"failures", "last_failure"}))
+
+		attempts, err := NewPostgresStore(db).Get("ip:10.0.0.1")
+
+		assert.Nil(t, err)
+		assert.Equal(t, Attempts{}, attempts)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func newTestLimiter() (*Limiter, *time.Time) {
+	clock := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(NewMemoryStore(), policy)
+	limiter.now = func() time.Time {
+		return clock
+	}
+	return limiter, &clock
+}
+
+func getDbAndMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	return db, mock
+}
@@ -0,0 +1,91 @@
+package lockout
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxMemoryEntries is the size the store is pruned at, so a flood of random keys can not exhaust the memory.
+// The forgotten entries go first, then the ones that failed the longest ago until a tenth of the room is free again.
+const maxMemoryEntries = 10000
+
+// MemoryStore keeps the attempts in memory, suitable only for the single node deployments
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]Attempts
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		attempts: map[string]Attempts{},
+	}
+}
+
+func (m *MemoryStore) RecordFailure(key string, at, forgetBefore time.Time) (Attempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.attempts) >= maxMemoryEntries {
+		m.prune(forgetBefore)
+	}
+
+	attempts, ok := m.attempts[key]
+	if !ok || attempts.LastFailure.Before(forgetBefore) {
+		attempts = Attempts{Key: key}
+	}
+	attempts.Failures++
+	attempts.LastFailure = at
+	m.attempts[key] = attempts
+	return attempts, nil
+}
+
+func (m *MemoryStore) Get(key string) (Attempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.attempts[key], nil
+}
+
+func (m *MemoryStore) List() ([]Attempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	all := make([]Attempts, 0, len(m.attempts))
+	for _, attempts := range m.attempts {
+		all = append(all, attempts)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Key < all[j].Key
+	})
+	return all, nil
+}
+
+func (m *MemoryStore) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.attempts, key)
+	return nil
+}
+
+func (m *MemoryStore) prune(forgetBefore time.Time) {
+	for key, attempts := range m.attempts {
+		if attempts.LastFailure.Before(forgetBefore) {
+			delete(m.attempts, key)
+		}
+	}
+	if len(m.attempts) < maxMemoryEntries {
+		return
+	}
+
+	// the flood is within the window, evicting its oldest entries may lift their lockouts early
+	oldest := make([]Attempts, 0, len(m.attempts))
+	for _, attempts := range m.attempts {
+		oldest = append(oldest, attempts)
+	}
+	sort.Slice(oldest, func(i, j int) bool {
+		return oldest[i].LastFailure.Before(oldest[j].LastFailure)
+	})
+	for _, attempts := range oldest[:len(oldest)-maxMemoryEntries*9/10] {
+		delete(m.attempts, attempts.Key)
+	}
+}
@@ -0,0 +1,72 @@
+package lockout
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrLockedOut               = errors.New("too many failed attempts, try again later")
+	ErrCouldNotRetrieveResults = errors.New("could not retrieve the results")
+	ErrCouldNotPersist         = errors.New("could not persist the given data to database")
+	ErrUnknownStore            = errors.New("unknown lockout store, must be either memory or postgres")
+)
+
+// Store keeps track of the failed attempts
+type Store interface {
+	// RecordFailure counts a failure for the key, the failures before the given time are forgotten first
+	RecordFailure(key string, at, forgetBefore time.Time) (Attempts, error)
+	Get(key string) (Attempts, error)
+	List() ([]Attempts, error)
+	Reset(key string) error
+}
+
+// Attempts represents the failed attempts of a key, e.g. of an application or a client ip
+type Attempts struct {
+	Key         string    `json:"key"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+}
+
+// State is the attempts together with the lockout they result in
+type State struct {
+	Attempts
+	LockedUntil *time.Time `json:"locked_until"`
+}
+
+// Policy describes when and for how long the keys are locked out
+type Policy struct {
+	// Threshold is the number of failures the lockout starts after
+	Threshold int
+	// BaseDelay is the first lockout, doubled with every further failure
+	BaseDelay time.Duration
+	// MaxDelay caps the lockout
+	MaxDelay time.Duration
+	// Window is how long the failures are remembered for
+	Window time.Duration
+}
+
+// Limiter locks the keys out with an exponential backoff once they fail too often
+type Limiter struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+func NewLimiter(store Store, policy Policy) *Limiter {
+	return &Limiter{
+		store:  store,
+		policy: policy,
+		now:    time.Now,
+	}
+}
+
+// AppKey is the key the failures of an application are tracked with
+func AppKey(appID string) string {
+	return "app:" + appID
+}
+
+// IPKey is the key the failures of a client ip are tracked with
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/x509"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/mensurowary/juno/commons"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// APIKeyHeader is the header machine clients pass their api keys in
+const APIKeyHeader = "X-Api-Key"
+
+type apiKeyResolver interface {
+	ResolveAPIKey(key string) (*Application, error)
+}
+
+type certificateResolver interface {
+	ResolveCertificate(cert *x509.Certificate) (*Application, error)
+}
+
+// Middleware authenticates the request with the api key, the bearer token or the verified client certificate,
+// in that order. The resolved identity is exposed the same way in all cases so GetAppID keeps working
+func Middleware(mw *JWT, keys apiKeyResolver, certs certificateResolver) gin.HandlerFunc {
+	bearer := mw.MiddlewareFunc()
+	return func(c *gin.Context) {
+		if key := strings.TrimSpace(c.GetHeader(APIKeyHeader)); key != "" {
+			app, err := keys.ResolveAPIKey(key)
+			if err != nil {
+				log.Infof("Could not authenticate with the api key : %v", err)
+				abortUnauthorized(c)
+				return
+			}
+			setIdentity(c, app)
+			c.Next()
+			return
+		}
+
+		cert := clientCertificate(c)
+		if _, err := mw.lookupToken(c); err == nil || cert == nil {
+			bearer(c)
+			return
+		}
+
+		app, err := certs.ResolveCertificate(cert)
+		if err != nil {
+			log.Infof("Could not authenticate with the client certificate [%s] : %v", cert.Subject, err)
+			abortUnauthorized(c)
+			return
+		}
+		setIdentity(c, app)
+		c.Next()
+	}
+}
+
+// clientCertificate returns the client certificate the TLS handshake has verified, if any
+func clientCertificate(c *gin.Context) *x509.Certificate {
+	state := c.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+func abortUnauthorized(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusUnauthorized, commons.MakeFailureResponse(
+		"Unauthorized", http.StatusUnauthorized,
+	))
+}
+
+func setIdentity(c *gin.Context, app *Application) {
+	c.Set("JWT_PAYLOAD", jwt.MapClaims{
+		identityKey: app.ID,
+		scopesKey:   app.Scopes,
+	})
+	c.Set(identityKey, app)
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	mw := newTestJWT(t, &jwt.GinJWTMiddleware{
+		IdentityKey:     identityKey,
+		PayloadFunc:     payloadHandler(),
+		IdentityHandler: identityHandler(),
+		Unauthorized: func(c *gin.Context, code int, message string) {
+			c.AbortWithStatus(code)
+		},
+	})
+
+	resolver := mockResolver{
+		"juno_valid": &Application{ID: "test", Scopes: []string{ScopeResourcesRead}},
+	}
+
+	serve := func(req *http.Request) (*httptest.ResponseRecorder, string) {
+		var appID string
+		recorder := httptest.NewRecorder()
+		_, engine := gin.CreateTestContext(recorder)
+		engine.GET("/", Middleware(mw, resolver, mockCertResolver{}), RequireScopes(ScopeResourcesRead), func(c *gin.Context) {
+			appID = GetAppID(c)
+		})
+		engine.ServeHTTP(recorder, req)
+		return recorder, appID
+	}
+
+	t.Run("Resolves the same identity from a valid api key", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(APIKeyHeader, "juno_valid")
+
+		recorder, appID := serve(req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "test", appID)
+	})
+
+	t.Run("Rejects an invalid api key", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(APIKeyHeader, "juno_invalid")
+
+		recorder, _ := serve(req)
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+
+	t.Run("Resolves the identity from a valid bearer token", func(t *testing.T) {
+		token, _, err := mw.TokenGenerator(&Application{ID: "bearer", Scopes: []string{ScopeResourcesRead}})
+		assert.Nil(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		recorder, appID := serve(req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "bearer", appID)
+	})
+
+	t.Run("Falls back to the bearer token when no api key is passed", func(t *testing.T) {
+		recorder, _ := serve(httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+
+	t.Run("Resolves the identity from a verified client certificate", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.TLS = verifiedTLS("reports")
+
+		recorder, appID := serve(req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "reports", appID)
+	})
+
+	t.Run("Rejects a client certificate of an unknown application", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.TLS = verifiedTLS("ghost")
+
+		recorder, _ := serve(req)
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+
+	t.Run("Prefers the bearer token over the client certificate", func(t *testing.T) {
+		token, _, err := mw.TokenGenerator(&Application{ID: "bearer", Scopes: []string{ScopeResourcesRead}})
+		assert.Nil(t, err)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.TLS = verifiedTLS("reports")
+
+		recorder, appID := serve(req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "bearer", appID)
+	})
+
+	t.Run("Ignores the client certificates that are not verified", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "reports"}}}}
+
+		recorder, _ := serve(req)
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+}
+
+func verifiedTLS(commonName string) *tls.ConnectionState {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	return &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+}
+
+type mockResolver map[string]*Application
+
+func (m mockResolver) ResolveAPIKey(key string) (*Application, error) {
+	if app, ok := m[key]; ok {
+		return app, nil
+	}
+	return nil, errors.New("invalid key")
+}
+
+type mockCertResolver struct{}
+
+func (mockCertResolver) ResolveCertificate(cert *x509.Certificate) (*Application, error) {
+	if cert.Subject.CommonName == "reports" {
+		return &Application{ID: "reports", Scopes: []string{ScopeResourcesRead}}, nil
+	}
+	return nil, ErrUnknownCertificate
+}
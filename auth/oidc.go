@@ -0,0 +1,52 @@
+package auth
+
+import (
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type oidcLogin struct {
+	IDToken string `form:"id_token" json:"id_token" binding:"required"`
+}
+
+// idTokenVerifier verifies the id tokens of an identity provider, see oidc.Provider
+type idTokenVerifier interface {
+	Verify(rawIDToken string) (string, error)
+}
+
+// OIDCLoginHandler issues a token in exchange for an id token of the identity provider,
+// the id token is mapped to the application with the configured claim
+func OIDCLoginHandler(mw *JWT, verifier idTokenVerifier, finder credentialsFinder) gin.HandlerFunc {
+	authenticate := oidcAuthenticator(verifier, finder)
+	return func(c *gin.Context) {
+		mw.login(c, authenticate)
+	}
+}
+
+func oidcAuthenticator(verifier idTokenVerifier, finder credentialsFinder) func(c *gin.Context) (interface{}, error) {
+	return func(c *gin.Context) (interface{}, error) {
+		var loginValues oidcLogin
+		if err := c.ShouldBind(&loginValues); err != nil {
+			return nil, jwt.ErrMissingLoginValues
+		}
+
+		appID, err := verifier.Verify(loginValues.IDToken)
+		if err != nil {
+			return nil, jwt.ErrFailedAuthentication
+		}
+
+		creds, err := finder.findCredentials(appID)
+		if err != nil {
+			log.Infof("Id token was mapped to the unknown application [%s]", appID)
+			return nil, jwt.ErrFailedAuthentication
+		}
+
+		if creds.Disabled {
+			log.Infof("Disabled application [%s] tried to log in with an id token", creds.ID)
+			return nil, jwt.ErrFailedAuthentication
+		}
+
+		return creds.application(), nil
+	}
+}
@@ -0,0 +1,17 @@
+package oidc
+
+import (
+	"github.com/mensurowary/juno/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// FromConfig creates the provider of the issuer in the config, nil when no issuer is configured
+func FromConfig() *Provider {
+	if config.Config.OidcIssuer == "" {
+		return nil
+	}
+	if config.Config.OidcClientID == "" {
+		log.Fatal("OIDC Error: client id is required along with the issuer")
+	}
+	return NewProvider(config.Config.OidcIssuer, config.Config.OidcClientID, config.Config.OidcAppClaim, config.Config.OidcJwksCacheTTL)
+}
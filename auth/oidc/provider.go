@@ -0,0 +1,199 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/mensurowary/juno/auth"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidIDToken    = errors.New("invalid id token")
+	ErrMissingAppClaim   = errors.New("id token does not carry the application claim")
+	ErrDiscoveryFailed   = errors.New("could not discover the keys of the issuer")
+	ErrUnknownSigningKey = errors.New("id token was signed with an unknown key")
+)
+
+// minRefreshInterval keeps the tokens with made up key ids from hammering the issuer
+const minRefreshInterval = time.Minute
+
+// Provider verifies the id tokens of an OpenID Connect issuer with the keys it publishes
+type Provider struct {
+	issuer   string
+	audience string
+	claim    string
+	cacheTTL time.Duration
+	client   *http.Client
+	now      func() time.Time
+
+	mu          sync.Mutex
+	jwksURI     string
+	keys        map[string]interface{}
+	fetchedOn   time.Time
+	attemptedOn time.Time
+}
+
+// NewProvider creates a provider for the issuer, the tokens must be issued to the audience
+// and the application they belong to is read from the claim
+func NewProvider(issuer, audience, claim string, cacheTTL time.Duration) *Provider {
+	return &Provider{
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		audience: audience,
+		claim:    claim,
+		cacheTTL: cacheTTL,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		now:      time.Now,
+	}
+}
+
+// Verify validates the id token and returns the application id it is mapped to
+func (p *Provider) Verify(rawIDToken string) (string, error) {
+	parser := &jwtgo.Parser{ValidMethods: []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}}
+	token, err := parser.Parse(rawIDToken, p.keyFunc)
+	if err != nil {
+		log.Infof("Could not verify the id token : %v", err)
+		return "", ErrInvalidIDToken
+	}
+
+	claims := token.Claims.(jwtgo.MapClaims)
+	if err := p.validate(claims); err != nil {
+		log.Infof("Rejected the id token : %v", err)
+		return "", ErrInvalidIDToken
+	}
+
+	appID, _ := claims[p.claim].(string)
+	if appID = strings.TrimSpace(appID); appID == "" {
+		return "", ErrMissingAppClaim
+	}
+	return appID, nil
+}
+
+func (p *Provider) validate(claims jwtgo.MapClaims) error {
+	// the issuer is compared without its trailing slash, like the one the provider was created with
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != p.issuer {
+		return fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if !hasAudience(claims["aud"], p.audience) {
+		return fmt.Errorf("unexpected audience %v", claims["aud"])
+	}
+	if _, ok := claims["exp"].(float64); !ok {
+		return errors.New("missing expiry")
+	}
+	return nil
+}
+
+// hasAudience checks the audience, which is either a single string or a list of them
+func hasAudience(aud interface{}, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, item := range v {
+			if item == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *Provider) keyFunc(token *jwtgo.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := p.key(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if !matches(token.Method, key) {
+		return nil, fmt.Errorf("key %s can not verify %s", kid, token.Method.Alg())
+	}
+	return key, nil
+}
+
+// key returns the cached key, the keys are fetched again once the cache expires
+// or when the issuer has rotated to a key that is not known yet
+func (p *Provider) key(kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	key, ok := p.keys[kid]
+	expired := now.Sub(p.fetchedOn) > p.cacheTTL
+	if ok && !expired {
+		return key, nil
+	}
+
+	// the attempts are throttled whatever their outcome, so that an unreachable issuer is not hammered either
+	if now.Sub(p.attemptedOn) > minRefreshInterval {
+		p.attemptedOn = now
+		if err := p.refresh(); err != nil {
+			log.Errorf("Could not fetch the keys of [%s] : %v", p.issuer, err)
+			if !ok {
+				return nil, ErrDiscoveryFailed
+			}
+			// the issuer being unreachable should not lock everyone out while the key is known
+			return key, nil
+		}
+		p.fetchedOn = now
+	}
+
+	if key, ok = p.keys[kid]; !ok {
+		return nil, ErrUnknownSigningKey
+	}
+	return key, nil
+}
+
+func (p *Provider) refresh() error {
+	if p.jwksURI == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JwksURI string `json:"jwks_uri"`
+		}
+		if err := p.get(p.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+			return err
+		}
+		if strings.TrimSuffix(discovery.Issuer, "/") != p.issuer || discovery.JwksURI == "" {
+			return fmt.Errorf("unexpected discovery document for the issuer %s", discovery.Issuer)
+		}
+		p.jwksURI = discovery.JwksURI
+	}
+
+	var jwks auth.JWKS
+	if err := p.get(p.jwksURI, &jwks); err != nil {
+		return err
+	}
+
+	keys := make(map[string]interface{}, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := publicKey(jwk)
+		if err != nil {
+			log.Warnf("Skipping the key [%s] of [%s] : %v", jwk.Kid, p.issuer, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+	return nil
+}
+
+func (p *Provider) get(url string, v interface{}) error {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
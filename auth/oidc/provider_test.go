@@ -0,0 +1,215 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/mensurowary/juno/auth"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// mockIssuer is a local identity provider publishing its discovery document and keys
+type mockIssuer struct {
+	*httptest.Server
+	keys          map[string]*rsa.PrivateKey
+	jwksRequested int
+	down          bool
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	issuer := &mockIssuer{keys: map[string]*rsa.PrivateKey{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   issuer.URL,
+			"jwks_uri": issuer.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		issuer.jwksRequested++
+		if issuer.down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		jwks := auth.JWKS{Keys: []auth.JWK{}}
+		for kid, key := range issuer.keys {
+			jwks.Keys = append(jwks.Keys, auth.JWK{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: "RS256",
+				Kid: kid,
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		_ = json.NewEncoder(w).Encode(jwks)
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	issuer.rotate(t, "first")
+	return issuer
+}
+
+func (m *mockIssuer) rotate(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	m.keys[kid] = key
+}
+
+func (m *mockIssuer) token(t *testing.T, kid string, claims jwtgo.MapClaims) string {
+	token := jwtgo.NewWithClaims(jwtgo.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(m.keys[kid])
+	assert.Nil(t, err)
+	return signed
+}
+
+func (m *mockIssuer) claims() jwtgo.MapClaims {
+	return jwtgo.MapClaims{
+		"iss":  m.URL,
+		"aud":  "juno",
+		"sub":  "someone@example.com",
+		"juno": "reports",
+		"exp":  time.Now().Add(time.Minute).Unix(),
+		"iat":  time.Now().Unix(),
+	}
+}
+
+func TestProvider_Verify(t *testing.T) {
+	t.Run("Maps the id token to the application of the claim", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		provider := NewProvider(issuer.URL, "juno", "juno", time.Hour)
+
+		appID, err := provider.Verify(issuer.token(t, "first", issuer.claims()))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "reports", appID)
+	})
+
+	t.Run("Accepts the audience lists", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		provider := NewProvider(issuer.URL, "juno", "sub", time.Hour)
+		claims := issuer.claims()
+		claims["aud"] = []string{"other", "juno"}
+
+		appID, err := provider.Verify(issuer.token(t, "first", claims))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "someone@example.com", appID)
+	})
+
+	t.Run("Caches the keys", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		provider := NewProvider(issuer.URL, "juno", "juno", time.Hour)
+
+		for i := 0; i < 3; i++ {
+			_, err := provider.Verify(issuer.token(t, "first", issuer.claims()))
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, 1, issuer.jwksRequested)
+	})
+
+	t.Run("Fetches the keys again when the issuer rotates", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		provider := NewProvider(issuer.URL, "juno", "juno", time.Hour)
+		_, err := provider.Verify(issuer.token(t, "first", issuer.claims()))
+		assert.Nil(t, err)
+
+		issuer.rotate(t, "second")
+		provider.now = func() time.Time {
+			return time.Now().Add(2 * minRefreshInterval)
+		}
+
+		_, err = provider.Verify(issuer.token(t, "second", issuer.claims()))
+		assert.Nil(t, err)
+		assert.Equal(t, 2, issuer.jwksRequested)
+	})
+
+	t.Run("Does not hammer the issuer while it is unreachable", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		provider := NewProvider(issuer.URL, "juno", "juno", time.Minute)
+		_, err := provider.Verify(issuer.token(t, "first", issuer.claims()))
+		assert.Nil(t, err)
+
+		issuer.down = true
+		issuer.rotate(t, "second")
+		provider.now = func() time.Time {
+			return time.Now().Add(2 * minRefreshInterval)
+		}
+
+		for i := 0; i < 3; i++ {
+			_, err = provider.Verify(issuer.token(t, "second", issuer.claims()))
+			assert.Equal(t, ErrInvalidIDToken, err)
+		}
+		// the known key is still accepted although the cache has expired
+		_, err = provider.Verify(issuer.token(t, "first", issuer.claims()))
+		assert.Nil(t, err)
+		assert.Equal(t, 2, issuer.jwksRequested)
+	})
+
+	t.Run("Accepts the issuer with a trailing slash", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		provider := NewProvider(issuer.URL+"/", "juno", "juno", time.Hour)
+		claims := issuer.claims()
+		claims["iss"] = issuer.URL + "/"
+
+		appID, err := provider.Verify(issuer.token(t, "first", claims))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "reports", appID)
+	})
+
+	t.Run("Rejects the invalid tokens", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		provider := NewProvider(issuer.URL, "juno", "juno", time.Hour)
+
+		tt := []struct {
+			Name   string
+			Modify func(claims jwtgo.MapClaims)
+		}{
+			{"Another issuer", func(claims jwtgo.MapClaims) { claims["iss"] = "https://evil.example.com" }},
+			{"Another audience", func(claims jwtgo.MapClaims) { claims["aud"] = "other" }},
+			{"Expired", func(claims jwtgo.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() }},
+			{"Without expiry", func(claims jwtgo.MapClaims) { delete(claims, "exp") }},
+		}
+
+		for _, tc := range tt {
+			t.Run(tc.Name, func(t *testing.T) {
+				claims := issuer.claims()
+				tc.Modify(claims)
+
+				_, err := provider.Verify(issuer.token(t, "first", claims))
+				assert.Equal(t, ErrInvalidIDToken, err)
+			})
+		}
+	})
+
+	t.Run("Rejects the tokens signed with a shared secret", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		provider := NewProvider(issuer.URL, "juno", "juno", time.Hour)
+		token := jwtgo.NewWithClaims(jwtgo.SigningMethodHS256, issuer.claims())
+		token.Header["kid"] = "first"
+		signed, err := token.SignedString([]byte("secret"))
+		assert.Nil(t, err)
+
+		_, err = provider.Verify(signed)
+		assert.Equal(t, ErrInvalidIDToken, err)
+	})
+
+	t.Run("Fails when the token lacks the application claim", func(t *testing.T) {
+		issuer := newMockIssuer(t)
+		provider := NewProvider(issuer.URL, "juno", "juno", time.Hour)
+		claims := issuer.claims()
+		delete(claims, "juno")
+
+		_, err := provider.Verify(issuer.token(t, "first", claims))
+		assert.Equal(t, ErrMissingAppClaim, err)
+	})
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type mockVerifier struct {
+	AppID string
+	Err   error
+}
+
+func (m mockVerifier) Verify(string) (string, error) {
+	return m.AppID, m.Err
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	columns := []string{"id", "description", "password", "disabled", "scopes", "token_generation", "token_lifetime"}
+
+	t.Run("Authenticates the application the id token is mapped to", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(`^SELECT id, description, password, disabled, scopes, token_generation, token_lifetime FROM applications*`).
+			WithArgs("reports").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("reports", nil, hash(t, "secret"), false, "{resources:read}", 1, nil))
+
+		data, err := oidcAuthenticator(mockVerifier{AppID: "reports"}, NewRepository(db))(idTokenContext("token"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, &Application{ID: "reports", Scopes: []string{ScopeResourcesRead}, TokenGeneration: 1}, data)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails when the id token is invalid", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		_, err := oidcAuthenticator(mockVerifier{Err: errors.New("invalid")}, NewRepository(db))(idTokenContext("token"))
+
+		assert.Equal(t, jwt.ErrFailedAuthentication, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails when the application is disabled", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(`^SELECT id, description, password, disabled, scopes, token_generation, token_lifetime FROM applications*`).
+			WithArgs("reports").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("reports", nil, hash(t, "secret"), true, "{}", 0, nil))
+
+		_, err := oidcAuthenticator(mockVerifier{AppID: "reports"}, NewRepository(db))(idTokenContext("token"))
+
+		assert.Equal(t, jwt.ErrFailedAuthentication, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails when the id token is missing", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		_, err := oidcAuthenticator(mockVerifier{AppID: "reports"}, NewRepository(db))(idTokenContext(""))
+
+		assert.Equal(t, jwt.ErrMissingLoginValues, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func idTokenContext(idToken string) *gin.Context {
+	form := url.Values{}
+	form.Set("id_token", idToken)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/auth/oidc/login", strings.NewReader(form.Encode()))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/mensurowary/juno/commons"
+	"net/http"
+)
+
+// Scopes that can be granted to an application
+const (
+	ScopeResourcesRead   = "resources:read"
+	ScopeResourcesWrite  = "resources:write"
+	ScopeResourcesDelete = "resources:delete"
+	ScopeAdmin           = "admin"
+)
+
+var scopesKey = "scopes"
+
+var knownScopes = map[string]bool{
+	ScopeResourcesRead:   true,
+	ScopeResourcesWrite:  true,
+	ScopeResourcesDelete: true,
+	ScopeAdmin:           true,
+}
+
+// IsKnownScope checks whether the given scope is one that juno enforces
+func IsKnownScope(scope string) bool {
+	return knownScopes[scope]
+}
+
+// HasScope checks whether the application was granted the given scope, admin is granted every scope
+func (a *Application) HasScope(scope string) bool {
+	for _, s := range a.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScopes rejects the requests of the applications that lack any of the given scopes,
+// it must be used after the middleware that resolves the identity
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		app, ok := GetApplication(c)
+		if !ok {
+			abortForbidden(c)
+			return
+		}
+		for _, scope := range scopes {
+			if !app.HasScope(scope) {
+				abortForbidden(c)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// GetApplication retrieves the authenticated application from the gin context
+func GetApplication(c *gin.Context) (*Application, bool) {
+	identity, ok := c.Get(identityKey)
+	if !ok {
+		return nil, false
+	}
+	app, ok := identity.(*Application)
+	return app, ok
+}
+
+func abortForbidden(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusForbidden, commons.MakeFailureResponse(
+		"Forbidden", http.StatusForbidden,
+	))
+}
+
+func scopesFromClaim(claim interface{}) []string {
+	values, ok := claim.([]interface{})
+	if !ok {
+		return nil
+	}
+	scopes := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireScopes(t *testing.T) {
+	tt := []struct {
+		Name     string
+		Identity interface{}
+		Required []string
+		Expected int
+	}{
+		{
+			Name:     "Passes when the application has the required scope",
+			Identity: &Application{ID: "test", Scopes: []string{ScopeResourcesRead}},
+			Required: []string{ScopeResourcesRead},
+			Expected: http.StatusOK,
+		},
+		{
+			Name:     "Admin scope grants every other scope",
+			Identity: &Application{ID: "admin", Scopes: []string{ScopeAdmin}},
+			Required: []string{ScopeResourcesDelete},
+			Expected: http.StatusOK,
+		},
+		{
+			Name:     "Forbidden when the application lacks the required scope",
+			Identity: &Application{ID: "test", Scopes: []string{ScopeResourcesRead}},
+			Required: []string{ScopeResourcesRead, ScopeResourcesWrite},
+			Expected: http.StatusForbidden,
+		},
+		{
+			Name:     "Forbidden when the identity is not resolved",
+			Identity: nil,
+			Required: []string{ScopeResourcesRead},
+			Expected: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			_, engine := gin.CreateTestContext(recorder)
+			engine.GET("/", func(c *gin.Context) {
+				if tc.Identity != nil {
+					c.Set(identityKey, tc.Identity)
+				}
+			}, RequireScopes(tc.Required...), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(t, tc.Expected, recorder.Code)
+		})
+	}
+}
+
+func TestScopesFromClaim(t *testing.T) {
+	assert.Equal(t, []string{ScopeResourcesRead, ScopeAdmin}, scopesFromClaim([]interface{}{ScopeResourcesRead, ScopeAdmin}))
+	assert.Nil(t, scopesFromClaim(nil))
+}
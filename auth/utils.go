@@ -3,6 +3,7 @@ package auth
 import (
 	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // GetAppID extracts the AppID from the gin context
@@ -10,3 +11,12 @@ func GetAppID(c *gin.Context) string {
 	claims := jwt.ExtractClaims(c)
 	return claims["app_id"].(string)
 }
+
+// HashPassword creates the hash of the password to be stored in the database
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
@@ -2,22 +2,80 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Config is the general application config
 var Config = struct {
-	ApiVersion    string
-	FileUploadDir string
-	JwtRealm      string
-	JwtSecret     string
-	Port          string
+	ApiVersion              string
+	FileUploadDir           string
+	JwtRealm                string
+	JwtSecret               string
+	JwtSigningAlgorithm     string
+	JwtSigningKeyFile       string
+	JwtVerificationKeyFiles []string
+	JwtTimeout              time.Duration
+	JwtMaxRefresh           time.Duration
+	JwtTokenLookup          string
+	LoginLockoutStore       string
+	LoginLockoutThreshold   int
+	LoginLockoutBaseDelay   time.Duration
+	LoginLockoutMaxDelay    time.Duration
+	LoginLockoutWindow      time.Duration
+	OidcIssuer              string
+	OidcClientID            string
+	OidcAppClaim            string
+	OidcJwksCacheTTL        time.Duration
+	TlsCertFile             string
+	TlsKeyFile              string
+	TlsClientCAFile         string
+	TlsClientIdentity       string
+	CompressionCodec        string
+	StorageDriver           string
+	S3Endpoint              string
+	S3Region                string
+	S3Bucket                string
+	S3Prefix                string
+	S3AccessKey             string
+	S3SecretKey             string
+	S3UseSSL                bool
+	Port                    string
 }{
-	ApiVersion:    "v1",
-	FileUploadDir: getEnv("FILE_UPLOAD_DIRECTORY"),
-	JwtRealm:      getEnv("JWT_REALM"),
-	JwtSecret:     getEnv("JWT_SECRET"),
-	Port:          getEnv("APPLICATION_PORT"),
+	ApiVersion:              "v1",
+	FileUploadDir:           getFileUploadDir(),
+	JwtRealm:                getEnv("JWT_REALM"),
+	JwtSecret:               getEnvOrDefault("JWT_SECRET", ""),
+	JwtSigningAlgorithm:     getEnvOrDefault("JWT_SIGNING_ALGORITHM", "HS256"),
+	JwtSigningKeyFile:       getEnvOrDefault("JWT_SIGNING_KEY_FILE", ""),
+	JwtVerificationKeyFiles: getEnvList("JWT_VERIFICATION_KEY_FILES"),
+	JwtTimeout:              getEnvDuration("JWT_TIMEOUT", 15*time.Minute),
+	JwtMaxRefresh:           getEnvDuration("JWT_MAX_REFRESH", 24*time.Hour),
+	JwtTokenLookup:          getEnvOrDefault("JWT_TOKEN_LOOKUP", "header: Authorization"),
+	LoginLockoutStore:       getEnvOrDefault("LOGIN_LOCKOUT_STORE", "memory"),
+	LoginLockoutThreshold:   getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 5),
+	LoginLockoutBaseDelay:   getEnvDuration("LOGIN_LOCKOUT_BASE_DELAY", 30*time.Second),
+	LoginLockoutMaxDelay:    getEnvDuration("LOGIN_LOCKOUT_MAX_DELAY", 15*time.Minute),
+	LoginLockoutWindow:      getEnvDuration("LOGIN_LOCKOUT_WINDOW", time.Hour),
+	OidcIssuer:              getEnvOrDefault("OIDC_ISSUER", ""),
+	OidcClientID:            getEnvOrDefault("OIDC_CLIENT_ID", ""),
+	OidcAppClaim:            getEnvOrDefault("OIDC_APP_CLAIM", "sub"),
+	OidcJwksCacheTTL:        getEnvDuration("OIDC_JWKS_CACHE_TTL", time.Hour),
+	TlsCertFile:             getEnvOrDefault("TLS_CERT_FILE", ""),
+	TlsKeyFile:              getEnvOrDefault("TLS_KEY_FILE", ""),
+	TlsClientCAFile:         getEnvOrDefault("TLS_CLIENT_CA_FILE", ""),
+	TlsClientIdentity:       getEnvOrDefault("TLS_CLIENT_IDENTITY", "subject"),
+	CompressionCodec:        getEnvOrDefault("COMPRESSION_CODEC", "gzip"),
+	StorageDriver:           getEnvOrDefault("STORAGE_DRIVER", "local"),
+	S3Endpoint:              getEnvOrDefault("S3_ENDPOINT", ""),
+	S3Region:                getEnvOrDefault("S3_REGION", ""),
+	S3Bucket:                getEnvOrDefault("S3_BUCKET", ""),
+	S3Prefix:                getEnvOrDefault("S3_PREFIX", ""),
+	S3AccessKey:             getEnvOrDefault("S3_ACCESS_KEY", ""),
+	S3SecretKey:             getEnvOrDefault("S3_SECRET_KEY", ""),
+	S3UseSSL:                getEnvOrDefault("S3_USE_SSL", "true") == "true",
+	Port:                    getEnv("APPLICATION_PORT"),
 }
 
 // DatabaseConfig is the database specific config
@@ -40,3 +98,56 @@ func getEnv(key string) string {
 	}
 	return value
 }
+
+// getFileUploadDir is only optional with the memory storage, the uploads are then received into the temporary directory
+func getFileUploadDir() string {
+	if getEnvOrDefault("STORAGE_DRIVER", "local") == "memory" {
+		return getEnvOrDefault("FILE_UPLOAD_DIRECTORY", os.TempDir())
+	}
+	return getEnv("FILE_UPLOAD_DIRECTORY")
+}
+
+func getEnvOrDefault(key, defaultValue string) string {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvList splits the comma separated value of the key, empty items are skipped
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvDuration parses the value of the key as a duration such as 15m or 24h
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := getEnvOrDefault(key, "")
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		panic("Invalid duration for the key : " + key)
+	}
+	return duration
+}
+
+// getEnvInt parses the value of the key as a positive integer
+func getEnvInt(key string, defaultValue int) int {
+	value := getEnvOrDefault(key, "")
+	if value == "" {
+		return defaultValue
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		panic("Invalid number for the key : " + key)
+	}
+	return number
+}
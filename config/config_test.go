@@ -4,6 +4,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
+	"time"
 )
 
 func Test_GetEnv(t *testing.T) {
@@ -36,6 +37,122 @@ func Test_GetEnv(t *testing.T) {
 	})
 }
 
+func Test_GetEnvOrDefault(t *testing.T) {
+	key := "JUNO_RANDOM_KEY_ENV"
+
+	t.Run("Returns the trimmed value when the key exists", func(t *testing.T) {
+		failIfError(t, os.Setenv(key, " RS256 "))
+		assert.Equal(t, "RS256", getEnvOrDefault(key, "HS256"))
+		t.Cleanup(func() {
+			_ = os.Unsetenv(key)
+		})
+	})
+
+	t.Run("Returns the default value when the key does not exist", func(t *testing.T) {
+		failIfError(t, os.Unsetenv(key))
+		assert.Equal(t, "HS256", getEnvOrDefault(key, "HS256"))
+	})
+}
+
+func Test_GetEnvList(t *testing.T) {
+	key := "JUNO_RANDOM_KEY_ENV"
+
+	t.Run("Splits the value and skips the empty items", func(t *testing.T) {
+		failIfError(t, os.Setenv(key, " a.pem, ,b.pem,"))
+		assert.Equal(t, []string{"a.pem", "b.pem"}, getEnvList(key))
+		t.Cleanup(func() {
+			_ = os.Unsetenv(key)
+		})
+	})
+
+	t.Run("Returns nil when the key does not exist", func(t *testing.T) {
+		failIfError(t, os.Unsetenv(key))
+		assert.Nil(t, getEnvList(key))
+	})
+}
+
+func Test_GetEnvDuration(t *testing.T) {
+	key := "JUNO_RANDOM_KEY_ENV"
+
+	t.Run("Parses the duration", func(t *testing.T) {
+		failIfError(t, os.Setenv(key, "90m"))
+		assert.Equal(t, 90*time.Minute, getEnvDuration(key, time.Minute))
+		t.Cleanup(func() {
+			_ = os.Unsetenv(key)
+		})
+	})
+
+	t.Run("Returns the default value when the key does not exist", func(t *testing.T) {
+		failIfError(t, os.Unsetenv(key))
+		assert.Equal(t, time.Minute, getEnvDuration(key, time.Minute))
+	})
+
+	t.Run("Panics when the duration is invalid", func(t *testing.T) {
+		failIfError(t, os.Setenv(key, "forever"))
+		assert.Panics(t, func() {
+			getEnvDuration(key, time.Minute)
+		})
+		t.Cleanup(func() {
+			_ = os.Unsetenv(key)
+		})
+	})
+}
+
+func Test_GetEnvInt(t *testing.T) {
+	key := "JUNO_RANDOM_KEY_ENV"
+
+	t.Run("Parses the number", func(t *testing.T) {
+		failIfError(t, os.Setenv(key, " 10 "))
+		assert.Equal(t, 10, getEnvInt(key, 5))
+		t.Cleanup(func() {
+			_ = os.Unsetenv(key)
+		})
+	})
+
+	t.Run("Returns the default value when the key does not exist", func(t *testing.T) {
+		failIfError(t, os.Unsetenv(key))
+		assert.Equal(t, 5, getEnvInt(key, 5))
+	})
+
+	t.Run("Panics when the number is not positive", func(t *testing.T) {
+		failIfError(t, os.Setenv(key, "-1"))
+		assert.Panics(t, func() {
+			getEnvInt(key, 5)
+		})
+		t.Cleanup(func() {
+			_ = os.Unsetenv(key)
+		})
+	})
+}
+
+func Test_GetFileUploadDir(t *testing.T) {
+	dir, driver := os.Getenv("FILE_UPLOAD_DIRECTORY"), os.Getenv("STORAGE_DRIVER")
+	t.Cleanup(func() {
+		_ = os.Setenv("FILE_UPLOAD_DIRECTORY", dir)
+		_ = os.Setenv("STORAGE_DRIVER", driver)
+	})
+
+	t.Run("Panics when the directory is missing", func(t *testing.T) {
+		failIfError(t, os.Unsetenv("FILE_UPLOAD_DIRECTORY"))
+		failIfError(t, os.Unsetenv("STORAGE_DRIVER"))
+		assert.Panics(t, func() {
+			getFileUploadDir()
+		})
+	})
+
+	t.Run("Defaults to the temporary directory with the memory storage", func(t *testing.T) {
+		failIfError(t, os.Unsetenv("FILE_UPLOAD_DIRECTORY"))
+		failIfError(t, os.Setenv("STORAGE_DRIVER", "memory"))
+		assert.Equal(t, os.TempDir(), getFileUploadDir())
+	})
+
+	t.Run("Returns the directory when it is given", func(t *testing.T) {
+		failIfError(t, os.Setenv("FILE_UPLOAD_DIRECTORY", "__uploads__"))
+		failIfError(t, os.Setenv("STORAGE_DRIVER", "memory"))
+		assert.Equal(t, "__uploads__", getFileUploadDir())
+	})
+}
+
 func failIfError(t *testing.T, err error) {
 	if err != nil {
 		t.Fatalf("Failed with error : %v", err)
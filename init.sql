@@ -1,3 +1,9 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+DROP TABLE IF EXISTS uploads;
+DROP TABLE IF EXISTS login_failures;
+DROP TABLE IF EXISTS revoked_tokens;
+DROP TABLE IF EXISTS api_keys;
 DROP TABLE IF EXISTS tag_relations;
 DROP TABLE IF EXISTS resource_relations;
 DROP TABLE IF EXISTS applications;
@@ -7,7 +13,15 @@ create table resources(
     id          character varying not null,
     name        character varying not null,
     extension   character varying not null,
-    size        integer not null,
+    size        bigint not null,
+    version     integer not null default 1,
+    hidden      boolean not null default false,
+    codec       character varying not null default '',
+    hash        character varying,
+    md5         character varying,
+    metadata    jsonb not null default '{}',
+    mime_type   character varying not null default '',
+    revision    integer not null default 1,
     created_on  timestamp,
     PRIMARY KEY(id)
 );
@@ -15,6 +29,11 @@ create table applications(
     id              character varying not null,
     description     character varying,
     password        character varying not null,
+    disabled        boolean not null default false,
+    scopes          character varying[] not null default '{}',
+    token_generation bigint not null default 0,
+    token_lifetime  integer,
+    created_on      timestamp default current_timestamp,
     PRIMARY KEY (id)
 );
 create table resource_relations(
@@ -22,14 +41,74 @@ create table resource_relations(
     app_id              character varying not null,
     resource_id         character varying not null,
     saved_location      character varying not null,
+    storage             character varying not null default 'local',
     PRIMARY KEY (id),
     FOREIGN KEY (app_id) REFERENCES applications (id) ON DELETE CASCADE,
     FOREIGN KEY (resource_id) REFERENCES resources (id) ON DELETE CASCADE
 );
+create index resource_relations_app_id on resource_relations (app_id, resource_id);
+create index resources_name on resources (name, id);
+create index resources_size on resources (size, id);
+create index resources_created_on on resources (created_on, id);
+create index resources_search on resources using gin (to_tsvector('simple', name || ' ' || extension));
+create index resources_name_trgm on resources using gin (name gin_trgm_ops);
+create index resources_metadata on resources using gin (metadata);
+create index resources_metadata_search on resources using gin (jsonb_to_tsvector('simple', metadata, '["string"]'));
+create table api_keys(
+    id                  character varying not null,
+    app_id              character varying not null,
+    name                character varying not null,
+    prefix              character varying not null,
+    key_hash            character varying not null,
+    scopes              character varying[] not null default '{}',
+    created_on          timestamp not null,
+    last_used_on        timestamp,
+    revoked_on          timestamp,
+    PRIMARY KEY (id),
+    UNIQUE (key_hash),
+    FOREIGN KEY (app_id) REFERENCES applications (id) ON DELETE CASCADE
+);
+create table revoked_tokens(
+    jti                 character varying not null,
+    app_id              character varying not null,
+    expires_on          timestamp not null,
+    PRIMARY KEY (jti),
+    FOREIGN KEY (app_id) REFERENCES applications (id) ON DELETE CASCADE
+);
+create table uploads(
+    id                  character varying not null,
+    app_id              character varying not null,
+    upload_length       bigint not null,
+    upload_offset       bigint not null default 0,
+    name                character varying not null default '',
+    filename            character varying not null default '',
+    part_location       character varying not null,
+    resource_id         character varying,
+    created_on          timestamp not null,
+    PRIMARY KEY (id),
+    FOREIGN KEY (app_id) REFERENCES applications (id) ON DELETE CASCADE,
+    FOREIGN KEY (resource_id) REFERENCES resources (id) ON DELETE SET NULL
+);
+create table login_failures(
+    key                 character varying not null,
+    failures            integer not null,
+    last_failure        timestamp not null,
+    PRIMARY KEY (key)
+);
+create index login_failures_last_failure on login_failures (last_failure);
 create table tag_relations(
     id                  serial,
     resource_id         character varying not null,
     tag                 character varying not null,
     PRIMARY KEY (id),
+    UNIQUE (resource_id, tag),
     FOREIGN KEY (resource_id) REFERENCES resources (id) ON DELETE CASCADE
-);
\ No newline at end of file
+);
+create index tag_relations_tag on tag_relations (tag);
+create index tag_relations_search on tag_relations using gin (to_tsvector('simple', tag));
+create index tag_relations_tag_trgm on tag_relations using gin (tag gin_trgm_ops);
+
+-- default applications, passwords are bcrypt hashes of "admin" and "test" respectively
+INSERT INTO applications(id, description, password, scopes) VALUES
+    ('admin', 'Default administrator application', '$2a$10$cIvGzMcjjf5CnsfzSULNDOFCOpK8kTKbwzg9P2ToHzL0XnqufLi2O', '{admin}'),
+    ('test', 'Default test application', '$2a$10$C7WGWFvjYAxwbCHPL2fBSeYJ5By7ew0IXWZniXChstP7UQ3xDTd/W', '{resources:read,resources:write,resources:delete}');
\ No newline at end of file
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	_ "github.com/lib/pq"
 	"github.com/mensurowary/juno/config"
 	database "github.com/mensurowary/juno/db"
 	"github.com/mensurowary/juno/router"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
 )
 
 func main() {
@@ -12,5 +18,42 @@ func main() {
 	defer db.Close()
 
 	engine := router.Initialize(db)
-	_ = engine.Run(":" + config.Config.Port)
+	if config.Config.TlsCertFile == "" {
+		_ = engine.Run(":" + config.Config.Port)
+		return
+	}
+
+	tlsConfig, err := serverTLSConfig(config.Config.TlsClientCAFile)
+	if err != nil {
+		log.Fatal("TLS Error:" + err.Error())
+	}
+
+	server := &http.Server{
+		Addr:      ":" + config.Config.Port,
+		Handler:   engine,
+		TLSConfig: tlsConfig,
+	}
+	_ = server.ListenAndServeTLS(config.Config.TlsCertFile, config.Config.TlsKeyFile)
+}
+
+// serverTLSConfig verifies the client certificates against the CA bundle when one is given,
+// the clients without a certificate can still authenticate with their tokens or api keys
+func serverTLSConfig(clientCAFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	bundle, err := ioutil.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, errors.New("no certificates found in the client CA bundle")
+	}
+
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
 }
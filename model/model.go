@@ -1,6 +1,14 @@
 package model
 
+import "time"
+
 // Application represents a domain object application
 type Application struct {
-	ID, Name, Description string
+	ID          string   `json:"id"`
+	Description string   `json:"description"`
+	Scopes      []string `json:"scopes"`
+	Disabled    bool     `json:"disabled"`
+	// TokenLifetime is the lifetime of the issued tokens in seconds, 0 means the default lifetime
+	TokenLifetime int64     `json:"token_lifetime"`
+	CreatedOn     time.Time `json:"created_on"`
 }
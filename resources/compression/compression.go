@@ -0,0 +1,79 @@
+package compression
+
+import (
+	"compress/gzip"
+	"errors"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"strings"
+)
+
+// the codecs the files can be stored with, the names double as the Content-Encoding tokens
+const (
+	None = ""
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+var ErrUnknownCodec = errors.New("unknown compression codec, must be either gzip or zstd")
+
+// Parse resolves the compress value of an upload, empty or false stores the file as it is
+// and true picks the default codec
+func Parse(value, defaultCodec string) (string, error) {
+	switch value = strings.ToLower(strings.TrimSpace(value)); value {
+	case "", "false":
+		return None, nil
+	case "true":
+		value = defaultCodec
+	}
+	if value != Gzip && value != Zstd {
+		return None, ErrUnknownCodec
+	}
+	return value, nil
+}
+
+// NewWriter compresses what is written to dst, closing it flushes the remainder but leaves dst open
+func NewWriter(codec string, dst io.Writer) (io.WriteCloser, error) {
+	switch codec {
+	case Gzip:
+		return gzip.NewWriter(dst), nil
+	case Zstd:
+		return zstd.NewWriter(dst)
+	}
+	return nil, ErrUnknownCodec
+}
+
+// NewReader decompresses what is read from src
+func NewReader(codec string, src io.Reader) (io.ReadCloser, error) {
+	switch codec {
+	case Gzip:
+		return gzip.NewReader(src)
+	case Zstd:
+		decoder, err := zstd.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return nil, ErrUnknownCodec
+}
+
+// Encode returns the compressed content of src as it is being read,
+// closing it before the end stops the compression
+func Encode(codec string, src io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := NewWriter(codec, pw)
+		if err != nil {
+			_ = pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(w, src); err != nil {
+			_ = w.Close()
+			_ = pw.CloseWithError(err)
+			return
+		}
+		_ = pw.CloseWithError(w.Close())
+	}()
+	return pr
+}
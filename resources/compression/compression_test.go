@@ -0,0 +1,66 @@
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tt := []struct {
+		Value, Expected string
+		Err             error
+	}{
+		{Value: "", Expected: None},
+		{Value: "false", Expected: None},
+		{Value: "true", Expected: Zstd},
+		{Value: " GZIP ", Expected: Gzip},
+		{Value: "zstd", Expected: Zstd},
+		{Value: "brotli", Expected: None, Err: ErrUnknownCodec},
+	}
+
+	for _, tc := range tt {
+		codec, err := Parse(tc.Value, Zstd)
+		assert.Equal(t, tc.Expected, codec, tc.Value)
+		assert.Equal(t, tc.Err, err, tc.Value)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	content := strings.Repeat("juno stores the files compressed ", 1000)
+
+	for _, codec := range []string{Gzip, Zstd} {
+		t.Run("Round trips the content with "+codec, func(t *testing.T) {
+			encoded, err := ioutil.ReadAll(Encode(codec, strings.NewReader(content)))
+			assert.Nil(t, err)
+			assert.Less(t, len(encoded), len(content))
+
+			reader, err := NewReader(codec, bytes.NewReader(encoded))
+			assert.Nil(t, err)
+			defer reader.Close()
+
+			decoded, err := ioutil.ReadAll(reader)
+			assert.Nil(t, err)
+			assert.Equal(t, content, string(decoded))
+		})
+	}
+
+	t.Run("Fails when the source fails", func(t *testing.T) {
+		_, err := ioutil.ReadAll(Encode(Gzip, &failingReader{}))
+		assert.EqualError(t, err, "read failed")
+	})
+
+	t.Run("Fails with an unknown codec", func(t *testing.T) {
+		_, err := ioutil.ReadAll(Encode("brotli", strings.NewReader(content)))
+		assert.Equal(t, ErrUnknownCodec, err)
+	})
+}
+
+type failingReader struct{}
+
+func (f *failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
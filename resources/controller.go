@@ -1,31 +1,219 @@
 package resources
 
 import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"github.com/mensurowary/juno/commons"
+	"github.com/mensurowary/juno/config"
+	"github.com/mensurowary/juno/resources/compression"
 	"github.com/mensurowary/juno/resources/download"
 	"github.com/mensurowary/juno/resources/interactions"
+	"github.com/mensurowary/juno/resources/metadata"
+	"github.com/mensurowary/juno/resources/storage"
+	"github.com/mensurowary/juno/resources/tus"
 	"github.com/mensurowary/juno/resources/upload"
 	"github.com/mensurowary/juno/util"
 	log "github.com/sirupsen/logrus"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 )
 
 // UploadHandler handles the overall flow of the file uploading
 func UploadHandler(wc *util.WebContext, handler uploadHandler) {
-	file, err := wc.FormFile()
+	files, err := wc.FormFiles()
+	if err != nil || len(files) == 0 {
+		log.Errorf("Error occurred while retrieving the file from request : %v", err)
+		wc.UnprocessableEntity(commons.MakeFailureResponse(
+			"Could not retrieve the uploaded file from the request", http.StatusUnprocessableEntity,
+		))
+		return
+	}
+
+	if err := addHeaderMetadata(wc, wc.Form()); err != nil {
+		respondWithUploadResult(wc, upload.EmptyID, err)
+		return
+	}
+
+	if len(files) > 1 {
+		multiUpload(wc, handler, files)
+		return
+	}
+
+	file := files[0]
+
+	src, err := file.Open()
 	if err != nil {
-		log.Errorf("Error occurred while retrieving the file from request : %s", err)
+		log.Errorf("Error occurred while opening the uploaded file : %s", err)
 		wc.UnprocessableEntity(commons.MakeFailureResponse(
 			"Could not retrieve the uploaded file from the request", http.StatusUnprocessableEntity,
 		))
 		return
 	}
+	defer src.Close()
 
 	appID := wc.GetAppID()
 
-	ID, err := handler.HandleUpload(wc, file, appID, wc.Form())
-	if err == upload.ErrFileCouldNotBeUploaded || ID == upload.EmptyID {
+	ID, err := handler.HandleUpload(wc, src, file.Filename, appID, wc.Form())
+	respondWithUploadResult(wc, ID, err)
+}
+
+// multiUpload uploads all the files of the request, the response lists the result of each one
+func multiUpload(wc *util.WebContext, handler uploadHandler, files []*multipart.FileHeader) {
+	parts := make([]upload.Part, len(files))
+	for i, file := range files {
+		file := file
+		parts[i] = upload.Part{
+			Filename: file.Filename,
+			Open: func() (io.ReadCloser, error) {
+				return file.Open()
+			},
+		}
+	}
+
+	results, err := handler.HandleUploads(wc, parts, wc.GetAppID(), wc.Form())
+	switch err {
+	case upload.ErrUnknownUploadMode:
+		wc.BadRequest(commons.MakeFailureResponse("Unknown upload mode", http.StatusBadRequest))
+		return
+	case upload.ErrUnknownDuplicateStrategy:
+		wc.BadRequest(commons.MakeFailureResponse("Unknown duplicate strategy", http.StatusBadRequest))
+		return
+	case compression.ErrUnknownCodec:
+		wc.BadRequest(commons.MakeFailureResponse("Unknown compression codec", http.StatusBadRequest))
+		return
+	case upload.ErrInvalidTag:
+		wc.BadRequest(commons.MakeFailureResponse("Invalid tag", http.StatusBadRequest))
+		return
+	case metadata.ErrInvalidMetadata:
+		wc.BadRequest(commons.MakeFailureResponse("Invalid metadata", http.StatusBadRequest))
+		return
+	case metadata.ErrMetadataTooLarge:
+		wc.BadRequest(commons.MakeFailureResponse("Metadata too large", http.StatusBadRequest))
+		return
+	}
+
+	uploaded := 0
+	for _, result := range results {
+		if result.FileID != "" {
+			uploaded++
+		}
+	}
+
+	switch uploaded {
+	case len(results):
+		wc.Ok(commons.MakeSuccessResponse("Successfully uploaded the files", MultiUploadResult{Files: results}))
+	case 0:
+		wc.Respond(http.StatusUnprocessableEntity, commons.SuccessResponse{
+			Message: "Files could not be uploaded",
+			Code:    http.StatusUnprocessableEntity,
+			Data:    MultiUploadResult{Files: results},
+		})
+	default:
+		wc.Respond(http.StatusMultiStatus, commons.SuccessResponse{
+			Message: "Some of the files could not be uploaded",
+			Code:    http.StatusMultiStatus,
+			Data:    MultiUploadResult{Files: results},
+		})
+	}
+}
+
+// ResourceNameHeader overrides the name given in the path of the raw uploads
+const ResourceNameHeader = "X-Resource-Name"
+
+// StreamUploadHandler uploads the raw body of the request, the name and the extension are taken from the path
+// unless the name header is given. The options are passed as query parameters, the checksums as headers too.
+func StreamUploadHandler(wc *util.WebContext, handler uploadHandler) {
+	values := wc.Query()
+	if name := strings.TrimSpace(wc.Header(ResourceNameHeader)); name != "" {
+		values.Set("name", name)
+	}
+	if err := addHeaderChecksums(wc, values); err != nil {
+		respondWithUploadResult(wc, upload.EmptyID, err)
+		return
+	}
+	if err := addHeaderMetadata(wc, values); err != nil {
+		respondWithUploadResult(wc, upload.EmptyID, err)
+		return
+	}
+
+	ID, err := handler.HandleUpload(wc, wc.Body(), wc.Param("name"), wc.GetAppID(), values)
+	respondWithUploadResult(wc, ID, err)
+}
+
+// addHeaderChecksums adds the checksums given in the Content-MD5, Digest and Repr-Digest headers to the checksum values,
+// they describe the whole body so only the raw uploads honour them
+func addHeaderChecksums(wc *util.WebContext, values url.Values) error {
+	if header := wc.Header("Content-MD5"); header != "" {
+		checksum, err := upload.ParseContentMD5(header)
+		if err != nil {
+			return err
+		}
+		values.Add("checksum", checksum.String())
+	}
+	for _, name := range []string{"Digest", "Repr-Digest"} {
+		header := wc.Header(name)
+		if header == "" {
+			continue
+		}
+		checksums, err := upload.ParseDigest(header)
+		if err != nil {
+			return err
+		}
+		for _, checksum := range checksums {
+			values.Add("checksum", checksum.String())
+		}
+	}
+	return nil
+}
+
+// addHeaderMetadata adds the metadata given in the X-Juno-Meta-* headers to the metadata value,
+// the headers win over the keys of the value
+func addHeaderMetadata(wc *util.WebContext, values url.Values) error {
+	headers := metadata.FromHeaders(wc.Headers())
+	if len(headers) == 0 {
+		return nil
+	}
+	meta, err := metadata.Parse(values.Get("metadata"))
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		meta = metadata.Metadata{}
+	}
+	for key, value := range headers {
+		meta[key] = value
+	}
+	encoded, err := meta.Value()
+	if err != nil {
+		return metadata.ErrInvalidMetadata
+	}
+	values.Set("metadata", encoded.(string))
+	return nil
+}
+
+func respondWithUploadResult(wc *util.WebContext, ID string, err error) {
+	if err == upload.ErrUnknownDuplicateStrategy {
+		wc.BadRequest(commons.MakeFailureResponse("Unknown duplicate strategy", http.StatusBadRequest))
+	} else if err == compression.ErrUnknownCodec {
+		wc.BadRequest(commons.MakeFailureResponse("Unknown compression codec", http.StatusBadRequest))
+	} else if err == upload.ErrInvalidChecksum {
+		wc.BadRequest(commons.MakeFailureResponse("Malformed checksum", http.StatusBadRequest))
+	} else if err == upload.ErrChecksumMismatch {
+		wc.BadRequest(commons.MakeFailureResponse("Checksum of the file does not match", http.StatusBadRequest))
+	} else if err == upload.ErrInvalidTag {
+		wc.BadRequest(commons.MakeFailureResponse("Invalid tag", http.StatusBadRequest))
+	} else if err == metadata.ErrInvalidMetadata {
+		wc.BadRequest(commons.MakeFailureResponse("Invalid metadata", http.StatusBadRequest))
+	} else if err == metadata.ErrMetadataTooLarge {
+		wc.BadRequest(commons.MakeFailureResponse("Metadata too large", http.StatusBadRequest))
+	} else if err == upload.ErrDuplicateResource {
+		wc.Conflict(commons.MakeFailureResponse("A resource with the same name already exists", http.StatusConflict))
+	} else if err == upload.ErrFileCouldNotBeUploaded || ID == upload.EmptyID {
 		wc.UnprocessableEntity(commons.MakeFailureResponse(
 			"File could not be uploaded", http.StatusUnprocessableEntity,
 		))
@@ -58,12 +246,182 @@ func DeleteSingleAppResourceHandler(wc *util.WebContext, handler resourceInterac
 	}
 }
 
+// UpdateSingleAppResourceHandler renames a resource, changes the media type it is served with or hides it from the listings.
+// The changes are applied only when the If-Match header, if any, holds the current ETag of the resource.
+func UpdateSingleAppResourceHandler(wc *util.WebContext, handler resourceInteractionHandler) {
+	var params UpdateResourceRequest
+	if err := wc.BindJSON(&params); err != nil || (params.Name == nil && params.Extension == nil && params.MimeType == nil && params.Hidden == nil) {
+		log.Errorf("Could not bind the resource update payload : %v", err)
+		wc.BadRequest(commons.MakeFailureResponse("Malformed resource update payload", http.StatusBadRequest))
+		return
+	}
+
+	resource, err := handler.UpdateResource(interactions.UpdateResourceParameters{
+		ResourceID: wc.GetResourceID(),
+		AppID:      wc.GetAppID(),
+		Name:       params.Name,
+		Extension:  params.Extension,
+		MimeType:   params.MimeType,
+		Hidden:     params.Hidden,
+		Revisions:  interactions.ParseIfMatch(wc.Header("If-Match")),
+	})
+	switch err {
+	case nil:
+		wc.SetHeader("ETag", resource.ETag())
+		wc.Ok(commons.MakeSuccessResponse("Successfully updated the resource", resource))
+	case interactions.ErrInvalidUpdate:
+		wc.BadRequest(commons.MakeFailureResponse("Invalid resource update", http.StatusBadRequest))
+	case interactions.ErrCouldNotFind:
+		wc.NotFound(commons.MakeFailureResponse("Could not find the requested resource", http.StatusNotFound))
+	case interactions.ErrRevisionMismatch:
+		wc.Respond(http.StatusPreconditionFailed, commons.MakeFailureResponse("The resource was changed since it was read", http.StatusPreconditionFailed))
+	case interactions.ErrCouldNotUpdateData:
+		wc.UnprocessableEntity(commons.MakeFailureResponse("Could not update the resource information", http.StatusUnprocessableEntity))
+	default:
+		wc.InternalServerError(commons.MakeFailureResponse("Unknown error occurred", http.StatusInternalServerError))
+	}
+}
+
+// AddResourceTagsHandler tags a resource with the tags of the payload,
+// only when the If-Match header, if any, holds the current ETag of the resource
+func AddResourceTagsHandler(wc *util.WebContext, handler resourceInteractionHandler) {
+	tags, ok := bindTags(wc)
+	if !ok {
+		return
+	}
+	resource, err := handler.AddResourceTags(wc.GetResourceID(), wc.GetAppID(), tags, interactions.ParseIfMatch(wc.Header("If-Match")))
+	respondWithTagsResult(wc, resource, err)
+}
+
+// RemoveResourceTagsHandler removes the tags of the payload, or of the tag query parameters, from a resource,
+// only when the If-Match header, if any, holds the current ETag of the resource
+func RemoveResourceTagsHandler(wc *util.WebContext, handler resourceInteractionHandler) {
+	tags, ok := bindTags(wc)
+	if !ok {
+		return
+	}
+	resource, err := handler.RemoveResourceTags(wc.GetResourceID(), wc.GetAppID(), tags, interactions.ParseIfMatch(wc.Header("If-Match")))
+	respondWithTagsResult(wc, resource, err)
+}
+
+// bindTags reads the tags from the tag query parameters, or from the payload when there are none
+// since the bodies of the DELETE requests are dropped by some of the clients
+func bindTags(wc *util.WebContext) ([]string, bool) {
+	params := TagsRequest{Tags: wc.Query()["tag"]}
+	if len(params.Tags) == 0 {
+		if err := wc.BindJSON(&params); err != nil || len(params.Tags) == 0 {
+			log.Errorf("Could not bind the tags payload : %v", err)
+			wc.BadRequest(commons.MakeFailureResponse("Malformed tags payload", http.StatusBadRequest))
+			return nil, false
+		}
+	}
+	return params.Tags, true
+}
+
+func respondWithTagsResult(wc *util.WebContext, resource download.Resource, err error) {
+	switch err {
+	case nil:
+		wc.SetHeader("ETag", resource.ETag())
+		wc.Ok(commons.MakeSuccessResponse("Successfully updated the tags of the resource", resource))
+	case upload.ErrInvalidTag:
+		wc.BadRequest(commons.MakeFailureResponse("Invalid tag", http.StatusBadRequest))
+	case interactions.ErrCouldNotFind:
+		wc.NotFound(commons.MakeFailureResponse("Could not find the requested resource", http.StatusNotFound))
+	case interactions.ErrRevisionMismatch:
+		wc.Respond(http.StatusPreconditionFailed, commons.MakeFailureResponse("The resource was changed since it was read", http.StatusPreconditionFailed))
+	case interactions.ErrCouldNotUpdateData:
+		wc.UnprocessableEntity(commons.MakeFailureResponse("Could not update the tags of the resource", http.StatusUnprocessableEntity))
+	default:
+		wc.InternalServerError(commons.MakeFailureResponse("Unknown error occurred", http.StatusInternalServerError))
+	}
+}
+
+// UpdateResourceMetadataHandler merges the JSON merge patch of the payload into the metadata of a resource,
+// only when the If-Match header, if any, holds the current ETag of the resource
+func UpdateResourceMetadataHandler(wc *util.WebContext, handler resourceInteractionHandler) {
+	var patch metadata.Metadata
+	if err := wc.BindJSON(&patch); err != nil || patch == nil {
+		log.Errorf("Could not bind the metadata payload : %v", err)
+		wc.BadRequest(commons.MakeFailureResponse("Malformed metadata payload", http.StatusBadRequest))
+		return
+	}
+
+	resource, err := handler.UpdateResourceMetadata(wc.GetResourceID(), wc.GetAppID(), patch, interactions.ParseIfMatch(wc.Header("If-Match")))
+	switch err {
+	case nil:
+		wc.SetHeader("ETag", resource.ETag())
+		wc.Ok(commons.MakeSuccessResponse("Successfully updated the metadata of the resource", resource))
+	case metadata.ErrInvalidMetadata:
+		wc.BadRequest(commons.MakeFailureResponse("Invalid metadata", http.StatusBadRequest))
+	case metadata.ErrMetadataTooLarge:
+		wc.BadRequest(commons.MakeFailureResponse("Metadata too large", http.StatusBadRequest))
+	case interactions.ErrCouldNotFind:
+		wc.NotFound(commons.MakeFailureResponse("Could not find the requested resource", http.StatusNotFound))
+	case interactions.ErrRevisionMismatch:
+		wc.Respond(http.StatusPreconditionFailed, commons.MakeFailureResponse("The resource was changed since it was read", http.StatusPreconditionFailed))
+	case interactions.ErrCouldNotUpdateData:
+		wc.UnprocessableEntity(commons.MakeFailureResponse("Could not update the metadata of the resource", http.StatusUnprocessableEntity))
+	default:
+		wc.InternalServerError(commons.MakeFailureResponse("Unknown error occurred", http.StatusInternalServerError))
+	}
+}
+
+// GetAppResourcesInformationHandler lists a page of the resources of the application, includeHidden=true lists the hidden ones too.
+// The tag query parameters list only the resources having all of them, see download.ParseResourcesRequestParams for the others.
 func GetAppResourcesInformationHandler(wc *util.WebContext, handler resourcesHandler) {
-	appID := wc.GetAppID()
-	if info := handler.GetAppResourcesInformation(appID); info.Err != nil {
+	params, err := download.ParseResourcesRequestParams(wc.Query())
+	if err != nil {
+		wc.BadRequest(commons.MakeFailureResponse(listingErrorMessage(err), http.StatusBadRequest))
+		return
+	}
+	if params.Tags, err = upload.ParseTags(wc.Query()["tag"]); err != nil {
+		wc.BadRequest(commons.MakeFailureResponse("Invalid tag", http.StatusBadRequest))
+		return
+	}
+	params.AppID = wc.GetAppID()
+
+	if info := handler.GetAppResourcesInformation(params); info.Err != nil {
 		wc.NotFound(commons.MakeFailureResponse("Could not retrieve the data", http.StatusNotFound))
 	} else {
-		wc.Ok(commons.MakeSuccessResponse("Successfully retrieved all the available resources", info.Resources))
+		wc.Ok(commons.MakeSuccessResponse("Successfully retrieved the resources", ResourcePage{
+			Resources: info.Resources,
+			Next:      info.Next,
+			Prev:      info.Prev,
+			Total:     info.Total,
+		}))
+	}
+}
+
+// SearchResourcesHandler returns the resources of the application best matching the q query parameter
+func SearchResourcesHandler(wc *util.WebContext, handler resourcesHandler) {
+	params, err := download.ParseSearchRequestParams(wc.Query())
+	if err != nil {
+		wc.BadRequest(commons.MakeFailureResponse(listingErrorMessage(err), http.StatusBadRequest))
+		return
+	}
+	params.AppID = wc.GetAppID()
+
+	if info := handler.SearchResources(params); info.Err != nil {
+		wc.InternalServerError(commons.MakeFailureResponse("Could not search the resources", http.StatusInternalServerError))
+	} else {
+		wc.Ok(commons.MakeSuccessResponse("Successfully searched the resources", info.Results))
+	}
+}
+
+func listingErrorMessage(err error) string {
+	switch err {
+	case download.ErrInvalidSearch:
+		return "Invalid search query"
+	case download.ErrInvalidLimit:
+		return "Invalid limit"
+	case download.ErrUnknownSort:
+		return "Unknown sort"
+	case download.ErrUnknownOrder:
+		return "Unknown order"
+	case download.ErrInvalidCursor:
+		return "Invalid cursor"
+	default:
+		return "Invalid filter"
 	}
 }
 
@@ -71,12 +429,74 @@ func DownloadSingleAppResourceHandler(wc *util.WebContext, handler resourcesHand
 	params := getSingleResourceParams(wc)
 	result := handler.GetSingleResource(params)
 	if result.File != nil {
-		wc.RespondWithFile(result.File.Path, result.File.Name)
+		respondWithFile(wc, result.File)
 	} else {
+		if result.ETag != "" {
+			wc.SetHeader("ETag", result.ETag)
+		}
 		wc.Respond(result.Status, result.Data)
 	}
 }
 
+// respondWithFile sends the compressed files as they are to the clients that accept their encoding,
+// the others get them decompressed on the fly
+func respondWithFile(wc *util.WebContext, file *download.SingleResourceFileResult) {
+	encoded := file.Codec != compression.None && wc.AcceptsEncoding(file.Codec)
+	setIntegrityHeaders(wc, file, encoded)
+	if file.ContentType != "" {
+		wc.SetHeader("Content-Type", file.ContentType)
+	}
+	if file.Codec != compression.None && !encoded {
+		content, err := file.Driver.Get(file.Location)
+		if err != nil {
+			log.Errorf("Could not read the file %s : %v", file.Location, err)
+			wc.InternalServerError(commons.MakeFailureResponse("Could not read the file of the resource", http.StatusInternalServerError))
+			return
+		}
+		defer content.Close()
+		wc.RespondWithDecodedContent(content, file.Name, file.Codec, file.Size)
+		return
+	}
+
+	// the ranges are fetched from the driver as they are requested
+	content := storage.NewReadSeeker(file.Driver, file.Location, file.Stored.Size)
+	defer content.Close()
+	if encoded {
+		wc.RespondWithEncodedContent(content, file.Name, file.Stored.ModTime, file.Codec)
+	} else {
+		wc.RespondWithContent(content, file.Name, file.Stored.ModTime)
+	}
+}
+
+// setIntegrityHeaders describes the content with the ETag and the Digest headers. The digests are
+// of the uncompressed content, so the encoded responses only get an ETag of their own.
+func setIntegrityHeaders(wc *util.WebContext, file *download.SingleResourceFileResult, encoded bool) {
+	if file.Hash == "" {
+		return
+	}
+	if encoded {
+		wc.SetHeader("ETag", fmt.Sprintf(`"%s-%s"`, file.Hash, file.Codec))
+		return
+	}
+	wc.SetHeader("ETag", fmt.Sprintf(`"%s"`, file.Hash))
+
+	digests := []string{"sha-256=" + base64Digest(file.Hash)}
+	if file.MD5 != "" {
+		digests = append(digests, "md5="+base64Digest(file.MD5))
+	}
+	wc.SetHeader("Digest", strings.Join(digests, ", "))
+}
+
+// base64Digest re-encodes the hex encoded digest the way the Digest header carries it
+func base64Digest(digest string) string {
+	sum, err := hex.DecodeString(digest)
+	if err != nil {
+		log.Errorf("Malformed digest %s : %v", digest, err)
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(sum)
+}
+
 func getSingleResourceParams(wc *util.WebContext) download.SingleResourceRequestParams {
 	name := wc.QueryParam("name")
 	downloadParam := wc.QueryParam("download")
@@ -91,3 +511,156 @@ func getSingleResourceParams(wc *util.WebContext) download.SingleResourceRequest
 	}
 	return params
 }
+
+// ResourceIDHeader carries the id of the resource a completed resumable upload was persisted as
+const ResourceIDHeader = "X-Resource-Id"
+
+// TusOptionsHandler advertises the supported tus version and extensions
+func TusOptionsHandler(wc *util.WebContext) {
+	wc.SetHeader("Tus-Resumable", tus.Version)
+	wc.SetHeader("Tus-Version", tus.Version)
+	wc.SetHeader("Tus-Extension", tus.Extensions)
+	wc.SetHeader("Tus-Checksum-Algorithm", tus.ChecksumAlgorithms)
+	wc.Status(http.StatusNoContent)
+}
+
+func CreateUploadHandler(wc *util.WebContext, handler tusHandler) {
+	if !tusResumable(wc) {
+		return
+	}
+
+	length, err := strconv.ParseInt(wc.Header("Upload-Length"), 10, 64)
+	if err != nil {
+		wc.BadRequest(commons.MakeFailureResponse("Upload-Length header is required", http.StatusBadRequest))
+		return
+	}
+
+	metadata, err := tus.ParseMetadata(wc.Header("Upload-Metadata"))
+	if err != nil {
+		respondWithTusError(wc, err)
+		return
+	}
+
+	upload, err := handler.CreateUpload(wc.GetAppID(), length, metadata)
+	if upload != nil {
+		wc.SetHeader("Location", fmt.Sprintf("/%s/resources/uploads/%s", config.Config.ApiVersion, upload.ID))
+		setUploadHeaders(wc, upload)
+	}
+	if err != nil {
+		respondWithTusError(wc, err)
+		return
+	}
+	wc.Status(http.StatusCreated)
+}
+
+func GetUploadHandler(wc *util.WebContext, handler tusHandler) {
+	if !tusResumable(wc) {
+		return
+	}
+
+	upload, err := handler.GetUpload(wc.Param("upload_id"), wc.GetAppID())
+	if err != nil {
+		// responses to HEAD requests carry no body
+		wc.Status(tusErrorStatus(err))
+		return
+	}
+
+	wc.SetHeader("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	wc.SetHeader("Cache-Control", "no-store")
+	setUploadHeaders(wc, upload)
+	wc.Status(http.StatusOK)
+}
+
+func WriteUploadChunkHandler(wc *util.WebContext, handler tusHandler) {
+	if !tusResumable(wc) {
+		return
+	}
+
+	if wc.Header("Content-Type") != "application/offset+octet-stream" {
+		wc.Respond(http.StatusUnsupportedMediaType, commons.MakeFailureResponse(
+			"Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType,
+		))
+		return
+	}
+
+	offset, err := strconv.ParseInt(wc.Header("Upload-Offset"), 10, 64)
+	if err != nil {
+		wc.BadRequest(commons.MakeFailureResponse("Upload-Offset header is required", http.StatusBadRequest))
+		return
+	}
+
+	var checksum *tus.Checksum
+	if header := wc.Header("Upload-Checksum"); header != "" {
+		if checksum, err = tus.ParseChecksum(header); err != nil {
+			respondWithTusError(wc, err)
+			return
+		}
+	}
+
+	upload, err := handler.WriteChunk(wc.Param("upload_id"), wc.GetAppID(), offset, wc.Body(), checksum)
+	if upload != nil {
+		setUploadHeaders(wc, upload)
+	}
+	if err != nil {
+		respondWithTusError(wc, err)
+		return
+	}
+	wc.Status(http.StatusNoContent)
+}
+
+func TerminateUploadHandler(wc *util.WebContext, handler tusHandler) {
+	if !tusResumable(wc) {
+		return
+	}
+
+	if err := handler.TerminateUpload(wc.Param("upload_id"), wc.GetAppID()); err != nil {
+		respondWithTusError(wc, err)
+		return
+	}
+	wc.Status(http.StatusNoContent)
+}
+
+// tusResumable makes sure the client speaks the supported version of the protocol
+func tusResumable(wc *util.WebContext) bool {
+	wc.SetHeader("Tus-Resumable", tus.Version)
+	if wc.Header("Tus-Resumable") != tus.Version {
+		wc.SetHeader("Tus-Version", tus.Version)
+		wc.Respond(http.StatusPreconditionFailed, commons.MakeFailureResponse(
+			"Unsupported tus version", http.StatusPreconditionFailed,
+		))
+		return false
+	}
+	return true
+}
+
+func setUploadHeaders(wc *util.WebContext, upload *tus.Upload) {
+	wc.SetHeader("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if upload.ResourceID != "" {
+		wc.SetHeader(ResourceIDHeader, upload.ResourceID)
+	}
+}
+
+func respondWithTusError(wc *util.WebContext, err error) {
+	status := tusErrorStatus(err)
+	wc.Respond(status, commons.MakeFailureResponse(err.Error(), uint16(status)))
+}
+
+func tusErrorStatus(err error) int {
+	switch err {
+	case tus.ErrUploadNotFound:
+		return http.StatusNotFound
+	case tus.ErrOffsetMismatch:
+		return http.StatusConflict
+	case tus.ErrInvalidLength, tus.ErrInvalidMetadata, tus.ErrInvalidChecksum, tus.ErrUnsupportedChecksum:
+		return http.StatusBadRequest
+	case tus.ErrChecksumMismatch:
+		// defined by the checksum extension of tus
+		return 460
+	case tus.ErrUploadLocked:
+		return http.StatusLocked
+	case tus.ErrCouldNotComplete, tus.ErrCouldNotWrite:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
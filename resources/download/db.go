@@ -2,12 +2,19 @@ package download
 
 import (
 	"database/sql"
+	"github.com/lib/pq"
+	"github.com/mensurowary/juno/resources/metadata"
 	log "github.com/sirupsen/logrus"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
-func (r *Repository) GetResourcesByApplication(appID string) ([]Resource, error) {
-	rows, err := r.queryAllForAppID(appID)
+// GetResourcesByApplication lists a page of the resources of the application matching the filters, plus one more
+// so that the caller can tell whether there are more. The page before the cursor is listed in the reverse order.
+func (r *Repository) GetResourcesByApplication(params ResourcesRequestParams) ([]Resource, error) {
+	rows, err := r.queryAllForAppID(params)
 	if err != nil {
 		return nil, err
 	}
@@ -16,11 +23,18 @@ func (r *Repository) GetResourcesByApplication(appID string) ([]Resource, error)
 	var (
 		id, name, extension string
 		size                int64
+		version             int
+		hidden              bool
+		codec, hash, md5    string
+		tags                []string
+		meta                metadata.Metadata
+		mimeType            string
+		revision            int
 		createdOn           time.Time
 	)
 	var resources []Resource
 	for rows.Next() {
-		err := rows.Scan(&id, &name, &extension, &size, &createdOn)
+		err := rows.Scan(&id, &name, &extension, &size, &version, &hidden, &codec, &hash, &md5, pq.Array(&tags), &meta, &mimeType, &revision, &createdOn)
 		if err != nil {
 			log.Errorf("Error occurred while mapping the results to objects : %v", err)
 			return nil, ErrCouldNotRetrieveResults
@@ -30,31 +44,200 @@ func (r *Repository) GetResourcesByApplication(appID string) ([]Resource, error)
 			Name:      name,
 			Extension: extension,
 			Size:      size,
+			Version:   version,
+			Hidden:    hidden,
+			Codec:     codec,
+			Hash:      hash,
+			MD5:       md5,
+			Tags:      tags,
+			Metadata:  meta,
+			MimeType:  mimeType,
+			Revision:  revision,
 			CreatedOn: createdOn,
 		})
 	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Error occurred while reading the resources of the app: %s : %v", params.AppID, err)
+		return nil, ErrCouldNotRetrieveResults
+	}
 	return resources, nil
 }
 
-func (r *Repository) queryAllForAppID(appID string) (*sql.Rows, error) {
-	rows, err := r.db.Query(`SELECT r.id, r.name, r.extension, r.size, r.created_on FROM resources r JOIN resource_relations rr ON r.id = rr.resource_id WHERE rr.app_id = $1`, appID)
+// CountResourcesByApplication counts the resources of the application matching the filters across all the pages
+func (r *Repository) CountResourcesByApplication(params ResourcesRequestParams) (int, error) {
+	q := filter(params)
+	var count int
+	if err := r.db.QueryRow(`SELECT count(*) FROM resources r JOIN resource_relations rr ON r.id = rr.resource_id WHERE `+q.where(), q.args...).Scan(&count); err != nil {
+		log.Errorf("Error occurred while counting the resources of the app: %s : %v", params.AppID, err)
+		return 0, ErrCouldNotRetrieveResults
+	}
+	return count, nil
+}
 
+// SearchResources returns the resources of the application best matching the query. The names, the extensions and
+// the tags are matched by their words through the full-text search and partially through the trigrams,
+// the string values of the metadata by their words only.
+func (r *Repository) SearchResources(params SearchRequestParams) ([]SearchResult, error) {
+	rows, err := r.db.Query(searchQuery, params.AppID, params.Query, params.IncludeHidden, "%"+escapeLike(params.Query)+"%", params.Limit)
 	if err != nil {
-		log.Errorf("Error occurred while trying to retrieve resources for the app: %s : %v", appID, err)
+		log.Errorf("Error occurred while searching the resources of the app: %s : %v", params.AppID, err)
+		return nil, ErrCouldNotRetrieveResults
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var result SearchResult
+		resource := &result.Resource
+		if err := rows.Scan(&resource.ID, &resource.Name, &resource.Extension, &resource.Size, &resource.Version, &resource.Hidden,
+			&resource.Codec, &resource.Hash, &resource.MD5, pq.Array(&resource.Tags), &resource.Metadata, &resource.MimeType, &resource.Revision, &resource.CreatedOn, &result.Score); err != nil {
+			log.Errorf("Error occurred while mapping the results to objects : %v", err)
+			return nil, ErrCouldNotRetrieveResults
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Error occurred while reading the search results : %v", err)
+		return nil, ErrCouldNotRetrieveResults
+	}
+	return results, nil
+}
+
+// searchQuery ranks the words matched by the full-text search, plus the similarity of the name for the partial matches.
+// The conditions are kept apart so that each one is served by its own index.
+var searchQuery = `SELECT r.id, r.name, r.extension, r.size, r.version, r.hidden, r.codec, COALESCE(r.hash, ''), COALESCE(r.md5, ''), ` + tagsColumn + `, r.metadata, r.mime_type, r.revision, r.created_on,
+		ts_rank(to_tsvector('simple', r.name || ' ' || r.extension || ' ' || array_to_string(` + tagsColumn + `, ' ')) || ` + metadataVector + `, q.query) + similarity(r.name, $2) AS score
+	FROM resources r JOIN resource_relations rr ON r.id = rr.resource_id, websearch_to_tsquery('simple', $2) q(query)
+	WHERE rr.app_id = $1 AND (NOT r.hidden OR $3) AND (
+		to_tsvector('simple', r.name || ' ' || r.extension) @@ q.query OR r.name % $2 OR r.name ILIKE $4
+		OR EXISTS (SELECT 1 FROM tag_relations t WHERE t.resource_id = r.id AND (to_tsvector('simple', t.tag) @@ q.query OR t.tag % $2 OR t.tag ILIKE $4))
+		OR ` + metadataVector + ` @@ q.query
+	)
+	ORDER BY score DESC, r.id
+	LIMIT $5`
+
+// metadataVector holds the words of the string values of the metadata of the resource r
+const metadataVector = `jsonb_to_tsvector('simple', r.metadata, '["string"]')`
+
+// tagsColumn selects the tags of the resource r as an array
+const tagsColumn = `ARRAY(SELECT t.tag FROM tag_relations t WHERE t.resource_id = r.id ORDER BY t.tag)`
+
+// sortColumns are the columns the resources are listed by
+var sortColumns = map[string]string{
+	SortName:      "r.name",
+	SortSize:      "r.size",
+	SortCreatedOn: "r.created_on",
+}
+
+func (r *Repository) queryAllForAppID(params ResourcesRequestParams) (*sql.Rows, error) {
+	q := filter(params)
+
+	column := sortColumns[params.Sort]
+	// the page before the cursor is read backwards from it
+	descending := (params.Order == OrderDesc) != (params.Cursor != nil && params.Cursor.Before)
+	comparison, order := ">", "ASC"
+	if descending {
+		comparison, order = "<", "DESC"
+	}
+	if params.Cursor != nil {
+		value, _ := params.Cursor.value()
+		q.and("(" + column + ", r.id) " + comparison + " (" + q.arg(value) + ", " + q.arg(params.Cursor.ID) + ")")
+	}
+
+	rows, err := r.db.Query(`SELECT r.id, r.name, r.extension, r.size, r.version, r.hidden, r.codec, COALESCE(r.hash, ''), COALESCE(r.md5, ''), `+tagsColumn+`, r.metadata, r.mime_type, r.revision, r.created_on FROM resources r JOIN resource_relations rr ON r.id = rr.resource_id WHERE `+q.where()+
+		` ORDER BY `+column+` `+order+`, r.id `+order+` LIMIT `+q.arg(params.Limit+1), q.args...)
+
+	if err != nil {
+		log.Errorf("Error occurred while trying to retrieve resources for the app: %s : %v", params.AppID, err)
 		return nil, ErrCouldNotRetrieveResults
 	}
 	return rows, nil
 }
 
+// filter builds the conditions the listed resources match
+func filter(params ResourcesRequestParams) *query {
+	q := &query{}
+	q.and("rr.app_id = " + q.arg(params.AppID))
+	q.and("(NOT r.hidden OR " + q.arg(params.IncludeHidden) + ")")
+	if len(params.Tags) > 0 {
+		// the tags are distinct, so the resources holding all of them hold as many as there are
+		q.and("r.id IN (SELECT t.resource_id FROM tag_relations t WHERE t.tag = ANY(" + q.arg(pq.Array(params.Tags)) + ")" +
+			" GROUP BY t.resource_id HAVING count(*) = " + q.arg(len(params.Tags)) + ")")
+	}
+	if len(params.Extensions) > 0 {
+		q.and("r.extension = ANY(" + q.arg(pq.Array(params.Extensions)) + ")")
+	}
+	if params.MinSize != nil {
+		q.and("r.size >= " + q.arg(*params.MinSize))
+	}
+	if params.MaxSize != nil {
+		q.and("r.size <= " + q.arg(*params.MaxSize))
+	}
+	if params.CreatedAfter != nil {
+		q.and("r.created_on >= " + q.arg(*params.CreatedAfter))
+	}
+	if params.CreatedBefore != nil {
+		q.and("r.created_on < " + q.arg(*params.CreatedBefore))
+	}
+	if params.NamePrefix != "" {
+		q.and("r.name LIKE " + q.arg(escapeLike(params.NamePrefix)+"%"))
+	}
+	if len(params.MetadataKeys) > 0 {
+		q.and("r.metadata ?& " + q.arg(pq.Array(params.MetadataKeys)))
+	}
+	// the keys are sorted so that the statement is the same for the same filters
+	keys := make([]string, 0, len(params.Metadata))
+	for key := range params.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		q.and("r.metadata ->> " + q.arg(key) + " = " + q.arg(params.Metadata[key]))
+	}
+	return q
+}
+
+// query collects the conditions of a statement along with their arguments
+type query struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg adds the argument and returns its placeholder
+func (q *query) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+func (q *query) and(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+func (q *query) where() string {
+	return strings.Join(q.conditions, " AND ")
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
 func (r *Repository) FindResourceLocation(appID, resourceID string) DownloadableResource {
 	var (
 		name, extension, savedLocation, id string
+		storageName                        string
 		size                               int64
+		version                            int
+		hidden                             bool
+		codec, hash, md5                   string
+		tags                               []string
+		meta                               metadata.Metadata
+		mimeType                           string
+		revision                           int
 		createdOn                          time.Time
 	)
 
 	rows := r.queryForResourceInformation(appID, resourceID)
-	if err := rows.Scan(&id, &name, &extension, &size, &createdOn, &savedLocation); err != nil {
+	if err := rows.Scan(&id, &name, &extension, &size, &version, &hidden, &codec, &hash, &md5, pq.Array(&tags), &meta, &mimeType, &revision, &createdOn, &savedLocation, &storageName); err != nil {
 		log.Errorf("Error occurred while mapping the results to objects : %v", err)
 		return NoDownloadableResource
 	}
@@ -65,14 +248,24 @@ func (r *Repository) FindResourceLocation(appID, resourceID string) Downloadable
 			Extension: extension,
 			CreatedOn: createdOn,
 			Size:      size,
+			Version:   version,
+			Hidden:    hidden,
+			Codec:     codec,
+			Hash:      hash,
+			MD5:       md5,
+			Tags:      tags,
+			Metadata:  meta,
+			MimeType:  mimeType,
+			Revision:  revision,
 		},
 		SavedLocation: savedLocation,
+		Storage:       storageName,
 	}
 }
 
 func (r *Repository) queryForResourceInformation(appID string, resourceID string) *sql.Row {
 	return r.db.QueryRow(`
-		SELECT r.id, r.name, r.extension, r.size, r.created_on, rr.saved_location
+		SELECT r.id, r.name, r.extension, r.size, r.version, r.hidden, r.codec, COALESCE(r.hash, ''), COALESCE(r.md5, ''), `+tagsColumn+`, r.metadata, r.mime_type, r.revision, r.created_on, rr.saved_location, rr.storage
 		FROM resources r 
 		JOIN resource_relations rr ON r.id = rr.resource_id
 		WHERE rr.app_id = $1 AND r.id = $2
@@ -1,28 +1,263 @@
 package download
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"github.com/mensurowary/juno/commons"
-	"github.com/mensurowary/juno/config"
+	"github.com/mensurowary/juno/resources/metadata"
+	"github.com/mensurowary/juno/resources/storage"
+	log "github.com/sirupsen/logrus"
 	"net/http"
-	"path/filepath"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
-func (s *Service) GetAppResourcesInformation(appID string) ResourceInformation {
-	resources, err := s.r.GetResourcesByApplication(appID)
+// GetAppResourcesInformation lists a page of the resources of the application, the hidden ones are left out unless IncludeHidden is set.
+// The total is counted only when the page does not tell it already.
+func (s *Service) GetAppResourcesInformation(params ResourcesRequestParams) ResourceInformation {
+	if params.Sort == "" {
+		params.Sort = SortCreatedOn
+	}
+	if params.Order == "" {
+		params.Order = OrderAsc
+	}
+	if params.Limit <= 0 {
+		params.Limit = DefaultLimit
+	}
+
+	resources, err := s.r.GetResourcesByApplication(params)
+	if err != nil {
+		return ResourceInformation{Resources: []Resource{}, Err: err}
+	}
+
+	more := len(resources) > params.Limit
+	if more {
+		resources = resources[:params.Limit]
+	}
+	before := params.Cursor != nil && params.Cursor.Before
+	if before {
+		for i, j := 0, len(resources)-1; i < j; i, j = i+1, j-1 {
+			resources[i], resources[j] = resources[j], resources[i]
+		}
+	}
 	if resources == nil {
 		resources = []Resource{}
 	}
-	return ResourceInformation{
-		Resources: resources,
-		Err:       err,
+
+	info := ResourceInformation{Resources: resources, Total: len(resources)}
+	if len(resources) > 0 {
+		// the page was reached from the cursor, so there is a page on its side
+		if (before && more) || (params.Cursor != nil && !before) {
+			info.Prev = makeCursor(params, resources[0], true)
+		}
+		if (!before && more) || before {
+			info.Next = makeCursor(params, resources[len(resources)-1], false)
+		}
+	}
+
+	if params.Cursor != nil || more {
+		if info.Total, err = s.r.CountResourcesByApplication(params); err != nil {
+			return ResourceInformation{Resources: []Resource{}, Err: err}
+		}
+	}
+	return info
+}
+
+// SearchResources returns the resources of the application best matching the query, the best one first
+func (s *Service) SearchResources(params SearchRequestParams) SearchInformation {
+	if params.Limit <= 0 {
+		params.Limit = DefaultSearchLimit
+	}
+	results, err := s.r.SearchResources(params)
+	if results == nil {
+		results = []SearchResult{}
+	}
+	return SearchInformation{
+		Results: results,
+		Err:     err,
+	}
+}
+
+// ParseSearchRequestParams reads the query and the limit of the search, the q and the limit query parameters
+func ParseSearchRequestParams(values url.Values) (SearchRequestParams, error) {
+	params := SearchRequestParams{
+		Query:         strings.TrimSpace(values.Get("q")),
+		IncludeHidden: strings.ToLower(values.Get("includeHidden")) == "true",
+		Limit:         DefaultSearchLimit,
+	}
+	if params.Query == "" || len(params.Query) > MaxSearchLength {
+		return SearchRequestParams{}, ErrInvalidSearch
+	}
+	if limit := strings.TrimSpace(values.Get("limit")); limit != "" {
+		var err error
+		if params.Limit, err = strconv.Atoi(limit); err != nil || params.Limit < 1 || params.Limit > MaxLimit {
+			return SearchRequestParams{}, ErrInvalidLimit
+		}
 	}
+	return params, nil
+}
+
+// metaPrefix starts the query parameters filtering the listing by the values of the metadata
+const metaPrefix = "meta."
+
+// ParseResourcesRequestParams reads the sorting, the paging and the filters of the listing from the query
+func ParseResourcesRequestParams(values url.Values) (ResourcesRequestParams, error) {
+	params := ResourcesRequestParams{
+		IncludeHidden: strings.ToLower(values.Get("includeHidden")) == "true",
+		NamePrefix:    values.Get("namePrefix"),
+		Sort:          strings.TrimSpace(values.Get("sort")),
+		Order:         strings.ToLower(strings.TrimSpace(values.Get("order"))),
+		Limit:         DefaultLimit,
+	}
+
+	if params.Sort == "" {
+		params.Sort = SortCreatedOn
+	}
+	if _, ok := sortColumns[params.Sort]; !ok {
+		return ResourcesRequestParams{}, ErrUnknownSort
+	}
+	if params.Order == "" {
+		params.Order = OrderAsc
+	}
+	if params.Order != OrderAsc && params.Order != OrderDesc {
+		return ResourcesRequestParams{}, ErrUnknownOrder
+	}
+
+	if limit := strings.TrimSpace(values.Get("limit")); limit != "" {
+		var err error
+		if params.Limit, err = strconv.Atoi(limit); err != nil || params.Limit < 1 || params.Limit > MaxLimit {
+			return ResourcesRequestParams{}, ErrInvalidLimit
+		}
+	}
+
+	for _, value := range values["extension"] {
+		for _, extension := range strings.Split(value, ",") {
+			if extension = strings.TrimPrefix(strings.TrimSpace(extension), "."); extension != "" {
+				params.Extensions = append(params.Extensions, extension)
+			}
+		}
+	}
+
+	var err error
+	if params.MinSize, err = parseSize(values.Get("minSize")); err != nil {
+		return ResourcesRequestParams{}, err
+	}
+	if params.MaxSize, err = parseSize(values.Get("maxSize")); err != nil {
+		return ResourcesRequestParams{}, err
+	}
+	if params.CreatedAfter, err = parseDate(values.Get("createdAfter")); err != nil {
+		return ResourcesRequestParams{}, err
+	}
+	if params.CreatedBefore, err = parseDate(values.Get("createdBefore")); err != nil {
+		return ResourcesRequestParams{}, err
+	}
+
+	// the metadata is filtered with meta.<key>=<value> and hasMeta=<key>
+	for name, value := range values {
+		if !strings.HasPrefix(name, metaPrefix) {
+			continue
+		}
+		key := strings.TrimPrefix(name, metaPrefix)
+		if key == "" || len(key) > metadata.MaxKeyLength {
+			return ResourcesRequestParams{}, ErrInvalidFilter
+		}
+		if params.Metadata == nil {
+			params.Metadata = map[string]string{}
+		}
+		params.Metadata[key] = value[0]
+	}
+	for _, value := range values["hasMeta"] {
+		for _, key := range strings.Split(value, ",") {
+			if key = strings.TrimSpace(key); key == "" {
+				continue
+			}
+			if len(key) > metadata.MaxKeyLength {
+				return ResourcesRequestParams{}, ErrInvalidFilter
+			}
+			params.MetadataKeys = append(params.MetadataKeys, key)
+		}
+	}
+
+	if cursor := strings.TrimSpace(values.Get("cursor")); cursor != "" {
+		if params.Cursor, err = parseCursor(cursor, params.Sort, params.Order); err != nil {
+			return ResourcesRequestParams{}, err
+		}
+	}
+	return params, nil
+}
+
+func parseSize(value string) (*int64, error) {
+	if value = strings.TrimSpace(value); value == "" {
+		return nil, nil
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return nil, ErrInvalidFilter
+	}
+	return &size, nil
+}
+
+// parseDate reads an RFC 3339 timestamp or a date, the latter is the midnight of the day in UTC
+func parseDate(value string) (*time.Time, error) {
+	if value = strings.TrimSpace(value); value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return &date, nil
+		}
+	}
+	return nil, ErrInvalidFilter
+}
+
+// makeCursor makes the cursor of the page after the resource, or of the one before it
+func makeCursor(params ResourcesRequestParams, resource Resource, before bool) string {
+	cursor := Cursor{Sort: params.Sort, Order: params.Order, ID: resource.ID, Before: before}
+	switch params.Sort {
+	case SortName:
+		cursor.Value = resource.Name
+	case SortSize:
+		cursor.Value = strconv.FormatInt(resource.Size, 10)
+	default:
+		cursor.Value = resource.CreatedOn.Format(time.RFC3339Nano)
+	}
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// parseCursor reads the cursor, it must have been made for the same sort and order
+func parseCursor(value, sort, order string) (*Cursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	cursor := &Cursor{}
+	if err := json.Unmarshal(decoded, cursor); err != nil || cursor.Sort != sort || cursor.Order != order || cursor.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	if _, err := cursor.value(); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// value is the value of the sort field at the cursor
+func (c *Cursor) value() (interface{}, error) {
+	switch c.Sort {
+	case SortSize:
+		return strconv.ParseInt(c.Value, 10, 64)
+	case SortCreatedOn:
+		return time.Parse(time.RFC3339Nano, c.Value)
+	}
+	return c.Value, nil
 }
 
 func (s *Service) GetSingleResource(params SingleResourceRequestParams) SingleResourceResult {
 	downloadableResource := s.r.FindResourceLocation(params.AppID, params.ResourceID)
 
-	if downloadableResource == NoDownloadableResource {
+	if !downloadableResource.Found() {
 		return SingleResourceResult{
 			File:   nil,
 			Data:   commons.MakeFailureResponse("Could not find the requested resource", http.StatusNotFound),
@@ -31,12 +266,29 @@ func (s *Service) GetSingleResource(params SingleResourceRequestParams) SingleRe
 	}
 
 	if params.Download {
-		path := filepath.Join(config.Config.FileUploadDir, downloadableResource.SavedLocation)
+		driver, err := s.drivers.Get(downloadableResource.Storage)
+		if err != nil {
+			log.Errorf("Could not find the %s storage of the resource [%s]", downloadableResource.Storage, params.ResourceID)
+			return fileFailure(err)
+		}
+		stored, err := driver.Stat(downloadableResource.SavedLocation)
+		if err != nil {
+			log.Errorf("Could not stat the file of the resource [%s] : %v", params.ResourceID, err)
+			return fileFailure(err)
+		}
+
 		name := getFileName(&params, &downloadableResource.Resource)
 		return SingleResourceResult{
 			File: &SingleResourceFileResult{
-				Name: name,
-				Path: path,
+				Name:        name,
+				Location:    downloadableResource.SavedLocation,
+				Driver:      driver,
+				Stored:      stored,
+				Codec:       downloadableResource.Resource.Codec,
+				Size:        downloadableResource.Resource.Size,
+				Hash:        downloadableResource.Resource.Hash,
+				MD5:         downloadableResource.Resource.MD5,
+				ContentType: downloadableResource.Resource.MimeType,
 			},
 		}
 	}
@@ -45,6 +297,7 @@ func (s *Service) GetSingleResource(params SingleResourceRequestParams) SingleRe
 		File:   nil,
 		Data:   commons.MakeSuccessResponse("Successfully retrieved the resource information", downloadableResource.Resource),
 		Status: http.StatusOK,
+		ETag:   downloadableResource.Resource.ETag(),
 	}
 }
 
@@ -52,6 +305,19 @@ func (s *Service) GetSingleResourceInformation(params SingleResourceRequestParam
 	return s.r.FindResourceLocation(params.AppID, params.ResourceID)
 }
 
+func fileFailure(err error) SingleResourceResult {
+	if err == storage.ErrNotFound {
+		return SingleResourceResult{
+			Data:   commons.MakeFailureResponse("Could not find the file of the resource", http.StatusNotFound),
+			Status: http.StatusNotFound,
+		}
+	}
+	return SingleResourceResult{
+		Data:   commons.MakeFailureResponse("Could not read the file of the resource", http.StatusInternalServerError),
+		Status: http.StatusInternalServerError,
+	}
+}
+
 func getFileName(p *SingleResourceRequestParams, r *Resource) string {
 	result := r.Name
 
@@ -6,10 +6,12 @@ import (
 	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/mensurowary/juno/commons"
-	"github.com/mensurowary/juno/config"
+	"github.com/mensurowary/juno/resources/metadata"
+	"github.com/mensurowary/juno/resources/storage"
 	"github.com/stretchr/testify/assert"
 	"net/http"
-	"path/filepath"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 )
@@ -18,7 +20,7 @@ func TestService_GetAppResourcesInformation(t *testing.T) {
 	appID := "admin"
 
 	columns := []string{
-		"id", "name", "extension", "size", "created_on",
+		"id", "name", "extension", "size", "version", "hidden", "codec", "hash", "md5", "tags", "metadata", "mime_type", "revision", "created_on",
 	}
 
 	t.Run("Successfully retrieves the app resources data by app id", func(t *testing.T) {
@@ -26,23 +28,29 @@ func TestService_GetAppResourcesInformation(t *testing.T) {
 		defer db.Close()
 
 		expected1 := Resource{
+			Tags:      []string{"fighter", "ufc"},
+			Metadata:  metadata.Metadata{},
 			ID:        "123456",
 			Name:      "Mipe Stiopic",
 			Extension: "txt",
 			Size:      123456,
+			Version:   1,
 			CreatedOn: time.Now(),
 		}
 
 		expected2 := Resource{
+			Tags:      []string{},
+			Metadata:  metadata.Metadata{},
 			ID:        "654321",
 			Name:      "Daniel Cormier",
 			Extension: "epub",
 			Size:      654321,
+			Version:   2,
 			CreatedOn: time.Date(2020, time.March, 14, 12, 6, 0, 0, time.Local),
 		}
 
 		mock.ExpectQuery(`^SELECT (.+) FROM resources*`).
-			WithArgs("admin").
+			WithArgs("admin", false, DefaultLimit+1).
 			WillReturnRows(
 				sqlmock.
 					NewRows(columns).
@@ -52,7 +60,7 @@ func TestService_GetAppResourcesInformation(t *testing.T) {
 
 		s := getService(db)
 
-		ri := s.GetAppResourcesInformation(appID)
+		ri := s.GetAppResourcesInformation(ResourcesRequestParams{AppID: appID})
 
 		assert.Nil(t, ri.Err)
 		assert.NotNil(t, ri.Resources)
@@ -60,17 +68,120 @@ func TestService_GetAppResourcesInformation(t *testing.T) {
 		assert.Nil(t, mock.ExpectationsWereMet())
 	})
 
+	t.Run("Includes the hidden resources when asked to", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		hidden := Resource{
+			Tags:      []string{},
+			Metadata:  metadata.Metadata{},
+			ID:        "123456",
+			Name:      "draft",
+			Extension: "txt",
+			Size:      5,
+			Version:   1,
+			Hidden:    true,
+			CreatedOn: time.Now(),
+		}
+
+		mock.ExpectQuery(`^SELECT (.+) FROM resources r (.+) AND \(NOT r.hidden OR \$2\)`).
+			WithArgs("admin", true, DefaultLimit+1).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(spread(hidden)...))
+
+		ri := getService(db).GetAppResourcesInformation(ResourcesRequestParams{AppID: appID, IncludeHidden: true})
+
+		assert.Nil(t, ri.Err)
+		assert.Equal(t, []Resource{hidden}, ri.Resources)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Lists only the resources having all the tags", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		tagged := Resource{
+			ID:        "123456",
+			Name:      "invoice",
+			Extension: "pdf",
+			Size:      5,
+			Version:   1,
+			Tags:      []string{"invoice", "paid", "q3"},
+			Metadata:  metadata.Metadata{},
+			CreatedOn: time.Now(),
+		}
+
+		mock.ExpectQuery(`^SELECT (.+) FROM resources r (.+) AND r\.id IN \(SELECT t\.resource_id FROM tag_relations t WHERE t\.tag = ANY\(\$3\) GROUP BY t\.resource_id HAVING count\(\*\) = \$4\) ORDER BY`).
+			WithArgs("admin", false, `{"invoice","paid"}`, 2, DefaultLimit+1).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(spread(tagged)...))
+
+		ri := getService(db).GetAppResourcesInformation(ResourcesRequestParams{AppID: appID, Tags: []string{"invoice", "paid"}})
+
+		assert.Nil(t, ri.Err)
+		assert.Equal(t, []Resource{tagged}, ri.Resources)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Lists the resources without any tag condition when no tag is asked for", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		resource := Resource{ID: "123456", Name: "report", Extension: "pdf", Size: 5, Version: 1, Tags: []string{}, Metadata: metadata.Metadata{},
+			CreatedOn: time.Now()}
+
+		mock.ExpectQuery(`^SELECT (.+) FROM resources r JOIN resource_relations rr ON r\.id = rr\.resource_id WHERE rr\.app_id = \$1 AND \(NOT r\.hidden OR \$2\) ORDER BY`).
+			WithArgs("admin", false, 2).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(spread(resource)...).AddRow(spread(resource)...))
+		mock.ExpectQuery(`^SELECT count\(\*\) FROM resources r JOIN resource_relations rr ON r\.id = rr\.resource_id WHERE rr\.app_id = \$1 AND \(NOT r\.hidden OR \$2\)$`).
+			WithArgs("admin", false).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+		ri := getService(db).GetAppResourcesInformation(ResourcesRequestParams{AppID: appID, Limit: 1})
+
+		assert.Nil(t, ri.Err)
+		assert.Equal(t, 3, ri.Total)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Lists only the resources matching the metadata", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		described := Resource{
+			ID:        "123456",
+			Name:      "report",
+			Extension: "pdf",
+			Size:      5,
+			Version:   1,
+			Tags:      []string{},
+			Metadata:  metadata.Metadata{"project": "apollo", "pages": float64(3), "author": "jane"},
+			CreatedOn: time.Now(),
+		}
+
+		mock.ExpectQuery(`^SELECT (.+) FROM resources r (.+) r\.metadata \?& \$3 AND r\.metadata ->> \$4 = \$5 AND r\.metadata ->> \$6 = \$7 ORDER BY`).
+			WithArgs("admin", false, `{"author"}`, "pages", "3", "project", "apollo", DefaultLimit+1).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(spread(described)...))
+
+		ri := getService(db).GetAppResourcesInformation(ResourcesRequestParams{
+			AppID:        appID,
+			Metadata:     map[string]string{"project": "apollo", "pages": "3"},
+			MetadataKeys: []string{"author"},
+		})
+
+		assert.Nil(t, ri.Err)
+		assert.Equal(t, []Resource{described}, ri.Resources)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
 	t.Run("Response should be empty slice when there is no data", func(t *testing.T) {
 		db, mock := getDbAndMock(t)
 		defer db.Close()
 
 		mock.ExpectQuery(`^SELECT (.+) FROM resources*`).
-			WithArgs("admin").
+			WithArgs("admin", false, DefaultLimit+1).
 			WillReturnRows(sqlmock.NewRows(columns))
 
 		s := getService(db)
 
-		ri := s.GetAppResourcesInformation(appID)
+		ri := s.GetAppResourcesInformation(ResourcesRequestParams{AppID: appID})
 
 		assert.Nil(t, ri.Err)
 		assert.NotNil(t, ri.Resources)
@@ -83,12 +194,12 @@ func TestService_GetAppResourcesInformation(t *testing.T) {
 		defer db.Close()
 
 		mock.ExpectQuery(`^SELECT (.+) FROM resources*`).
-			WithArgs("admin").
-			WillReturnRows(sqlmock.NewRows(columns).AddRow("123654", "name", "ext", nil, time.Now()).RowError(1, errors.New("could not do stuff")))
+			WithArgs("admin", false, DefaultLimit+1).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow("123654", "name", "ext", nil, 1, false, "", "", "", "{}", "{}", "", 1, time.Now()).RowError(1, errors.New("could not do stuff")))
 
 		s := getService(db)
 
-		ri := s.GetAppResourcesInformation(appID)
+		ri := s.GetAppResourcesInformation(ResourcesRequestParams{AppID: appID})
 
 		assert.Equal(t, ErrCouldNotRetrieveResults, ri.Err)
 		assert.NotNil(t, ri.Resources)
@@ -96,17 +207,37 @@ func TestService_GetAppResourcesInformation(t *testing.T) {
 		assert.Nil(t, mock.ExpectationsWereMet())
 	})
 
+	t.Run("Response should be empty slice and error should exist when the rows fail partway", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(`^SELECT (.+) FROM resources*`).
+			WithArgs("admin", false, DefaultLimit+1).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow("123654", "name", "ext", 10, 1, false, "", "", "", "{}", "{}", "", 1, time.Now()).
+				AddRow("123655", "name", "ext", 10, 2, false, "", "", "", "{}", "{}", "", 1, time.Now()).
+				RowError(1, errors.New("connection reset")))
+
+		s := getService(db)
+
+		ri := s.GetAppResourcesInformation(ResourcesRequestParams{AppID: appID})
+
+		assert.Equal(t, ErrCouldNotRetrieveResults, ri.Err)
+		assert.Empty(t, ri.Resources)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
 	t.Run("Response should be empty slice and error should exist when query initialization", func(t *testing.T) {
 		db, mock := getDbAndMock(t)
 		defer db.Close()
 
 		mock.ExpectQuery(`^SELECT (.+) FROM resources*`).
-			WithArgs("admin").
+			WithArgs("admin", false, DefaultLimit+1).
 			WillReturnError(errors.New("query is incorrect or whatever"))
 
 		s := getService(db)
 
-		ri := s.GetAppResourcesInformation(appID)
+		ri := s.GetAppResourcesInformation(ResourcesRequestParams{AppID: appID})
 
 		assert.Equal(t, ErrCouldNotRetrieveResults, ri.Err)
 		assert.NotNil(t, ri.Resources)
@@ -115,9 +246,284 @@ func TestService_GetAppResourcesInformation(t *testing.T) {
 	})
 }
 
+func TestService_GetAppResourcesInformationPages(t *testing.T) {
+	columns := []string{
+		"id", "name", "extension", "size", "version", "hidden", "codec", "hash", "md5", "tags", "metadata", "mime_type", "revision", "created_on",
+	}
+	resource := func(id, name string, size int64) Resource {
+		return Resource{ID: id, Name: name, Extension: "txt", Size: size, Version: 1, Tags: []string{}, Metadata: metadata.Metadata{},
+			CreatedOn: time.Date(2020, time.March, 14, 12, 6, 0, 0, time.UTC)}
+	}
+	expectTotal := func(mock sqlmock.Sqlmock, total int) {
+		mock.ExpectQuery(`^SELECT count\(\*\) FROM resources r`).
+			WithArgs("admin", false).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(total))
+	}
+
+	t.Run("Lists the first page with the cursor of the next one", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		a, b, c := resource("1", "a", 10), resource("2", "b", 20), resource("3", "c", 30)
+
+		mock.ExpectQuery(`^SELECT (.+) ORDER BY r.created_on ASC, r.id ASC LIMIT \$3$`).
+			WithArgs("admin", false, 3).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(spread(a)...).AddRow(spread(b)...).AddRow(spread(c)...))
+		expectTotal(mock, 5)
+
+		ri := getService(db).GetAppResourcesInformation(ResourcesRequestParams{AppID: "admin", Limit: 2})
+
+		assert.Nil(t, ri.Err)
+		assert.Equal(t, []Resource{a, b}, ri.Resources)
+		assert.Equal(t, 5, ri.Total)
+		assert.Empty(t, ri.Prev)
+		next, err := parseCursor(ri.Next, SortCreatedOn, OrderAsc)
+		assert.Nil(t, err)
+		assert.Equal(t, &Cursor{Sort: SortCreatedOn, Order: OrderAsc, Value: "2020-03-14T12:06:00Z", ID: "2"}, next)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Lists the page after the cursor", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		c := resource("3", "c", 30)
+
+		mock.ExpectQuery(`^SELECT (.+) AND \(r.name, r.id\) > \(\$3, \$4\) ORDER BY r.name ASC, r.id ASC LIMIT \$5$`).
+			WithArgs("admin", false, "b", "2", 3).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(spread(c)...))
+		expectTotal(mock, 3)
+
+		ri := getService(db).GetAppResourcesInformation(ResourcesRequestParams{
+			AppID: "admin", Sort: SortName, Limit: 2,
+			Cursor: &Cursor{Sort: SortName, Order: OrderAsc, Value: "b", ID: "2"},
+		})
+
+		assert.Nil(t, ri.Err)
+		assert.Equal(t, []Resource{c}, ri.Resources)
+		assert.Equal(t, 3, ri.Total)
+		assert.Empty(t, ri.Next)
+		prev, err := parseCursor(ri.Prev, SortName, OrderAsc)
+		assert.Nil(t, err)
+		assert.Equal(t, &Cursor{Sort: SortName, Order: OrderAsc, Value: "c", ID: "3", Before: true}, prev)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Lists the page before the cursor backwards", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		c, d, e := resource("3", "c", 30), resource("4", "d", 40), resource("5", "e", 50)
+
+		// listed by the descending size, the page before the size 20 holds the greater sizes
+		mock.ExpectQuery(`^SELECT (.+) AND \(r.size, r.id\) > \(\$3, \$4\) ORDER BY r.size ASC, r.id ASC LIMIT \$5$`).
+			WithArgs("admin", false, int64(20), "2", 3).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(spread(c)...).AddRow(spread(d)...).AddRow(spread(e)...))
+		expectTotal(mock, 5)
+
+		ri := getService(db).GetAppResourcesInformation(ResourcesRequestParams{
+			AppID: "admin", Sort: SortSize, Order: OrderDesc, Limit: 2,
+			Cursor: &Cursor{Sort: SortSize, Order: OrderDesc, Value: "20", ID: "2", Before: true},
+		})
+
+		assert.Nil(t, ri.Err)
+		assert.Equal(t, []Resource{d, c}, ri.Resources)
+		prev, _ := parseCursor(ri.Prev, SortSize, OrderDesc)
+		assert.Equal(t, &Cursor{Sort: SortSize, Order: OrderDesc, Value: "40", ID: "4", Before: true}, prev)
+		next, _ := parseCursor(ri.Next, SortSize, OrderDesc)
+		assert.Equal(t, &Cursor{Sort: SortSize, Order: OrderDesc, Value: "30", ID: "3"}, next)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Filters the resources", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		minSize, maxSize := int64(10), int64(5<<30)
+		after, before := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+		mock.ExpectQuery(`^SELECT (.+) AND r.extension = ANY\(\$3\) AND r.size >= \$4 AND r.size <= \$5 AND r.created_on >= \$6 AND r.created_on < \$7 AND r.name LIKE \$8 ORDER BY r.created_on DESC, r.id DESC LIMIT \$9$`).
+			WithArgs("admin", false, `{"pdf","txt"}`, minSize, maxSize, after, before, `50\%%`, DefaultLimit+1).
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		ri := getService(db).GetAppResourcesInformation(ResourcesRequestParams{
+			AppID: "admin", Order: OrderDesc, Extensions: []string{"pdf", "txt"}, MinSize: &minSize, MaxSize: &maxSize,
+			CreatedAfter: &after, CreatedBefore: &before, NamePrefix: "50%",
+		})
+
+		assert.Nil(t, ri.Err)
+		assert.Empty(t, ri.Resources)
+		assert.Equal(t, 0, ri.Total)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails when the total could not be counted", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(`^SELECT (.+) FROM resources r`).
+			WithArgs("admin", false, 2).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(spread(resource("1", "a", 10))...).AddRow(spread(resource("2", "b", 20))...))
+		mock.ExpectQuery(`^SELECT count\(\*\) FROM resources r`).
+			WillReturnError(errors.New("connection reset"))
+
+		ri := getService(db).GetAppResourcesInformation(ResourcesRequestParams{AppID: "admin", Limit: 1})
+
+		assert.Equal(t, ErrCouldNotRetrieveResults, ri.Err)
+		assert.Empty(t, ri.Resources)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestParseResourcesRequestParams(t *testing.T) {
+	t.Run("Defaults to the first page by the creation", func(t *testing.T) {
+		params, err := ParseResourcesRequestParams(url.Values{})
+		assert.Nil(t, err)
+		assert.Equal(t, ResourcesRequestParams{Sort: SortCreatedOn, Order: OrderAsc, Limit: DefaultLimit}, params)
+	})
+
+	t.Run("Reads the sorting and the filters", func(t *testing.T) {
+		params, err := ParseResourcesRequestParams(url.Values{
+			"includeHidden": {"TRUE"},
+			"sort":          {"size"},
+			"order":         {"DESC"},
+			"limit":         {"20"},
+			"extension":     {"pdf, .txt", "epub"},
+			"minSize":       {"10"},
+			"maxSize":       {"5368709120"},
+			"createdAfter":  {"2020-03-01"},
+			"createdBefore": {"2020-04-01T12:00:00+02:00"},
+			"namePrefix":    {"report"},
+		})
+		assert.Nil(t, err)
+
+		minSize, maxSize := int64(10), int64(5<<30)
+		after := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+		before, _ := time.Parse(time.RFC3339, "2020-04-01T12:00:00+02:00")
+		assert.Equal(t, ResourcesRequestParams{
+			IncludeHidden: true,
+			Extensions:    []string{"pdf", "txt", "epub"},
+			MinSize:       &minSize,
+			MaxSize:       &maxSize,
+			CreatedAfter:  &after,
+			CreatedBefore: &before,
+			NamePrefix:    "report",
+			Sort:          SortSize,
+			Order:         OrderDesc,
+			Limit:         20,
+		}, params)
+	})
+
+	t.Run("Reads the metadata filters", func(t *testing.T) {
+		params, err := ParseResourcesRequestParams(url.Values{
+			"meta.project": {"apollo"},
+			"meta.pages":   {"3"},
+			"hasMeta":      {"author, reviewer", "owner"},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"project": "apollo", "pages": "3"}, params.Metadata)
+		assert.Equal(t, []string{"author", "reviewer", "owner"}, params.MetadataKeys)
+	})
+
+	t.Run("Reads the cursor made for the same sorting", func(t *testing.T) {
+		cursor := makeCursor(ResourcesRequestParams{Sort: SortName, Order: OrderAsc}, Resource{ID: "2", Name: "b"}, false)
+		params, err := ParseResourcesRequestParams(url.Values{"sort": {"name"}, "cursor": {cursor}})
+		assert.Nil(t, err)
+		assert.Equal(t, &Cursor{Sort: SortName, Order: OrderAsc, Value: "b", ID: "2"}, params.Cursor)
+	})
+
+	sizeCursor := makeCursor(ResourcesRequestParams{Sort: SortSize, Order: OrderAsc}, Resource{ID: "2", Size: 20}, false)
+	tt := []struct {
+		Values url.Values
+		Err    error
+	}{
+		{Values: url.Values{"limit": {"0"}}, Err: ErrInvalidLimit},
+		{Values: url.Values{"limit": {"1001"}}, Err: ErrInvalidLimit},
+		{Values: url.Values{"limit": {"ten"}}, Err: ErrInvalidLimit},
+		{Values: url.Values{"sort": {"hash"}}, Err: ErrUnknownSort},
+		{Values: url.Values{"order": {"up"}}, Err: ErrUnknownOrder},
+		{Values: url.Values{"minSize": {"-1"}}, Err: ErrInvalidFilter},
+		{Values: url.Values{"maxSize": {"big"}}, Err: ErrInvalidFilter},
+		{Values: url.Values{"createdAfter": {"yesterday"}}, Err: ErrInvalidFilter},
+		{Values: url.Values{"meta.": {"apollo"}}, Err: ErrInvalidFilter},
+		{Values: url.Values{"hasMeta": {strings.Repeat("a", metadata.MaxKeyLength+1)}}, Err: ErrInvalidFilter},
+		{Values: url.Values{"cursor": {"not a cursor"}}, Err: ErrInvalidCursor},
+		{Values: url.Values{"cursor": {sizeCursor}}, Err: ErrInvalidCursor},
+		{Values: url.Values{"sort": {"size"}, "order": {"desc"}, "cursor": {sizeCursor}}, Err: ErrInvalidCursor},
+	}
+	for _, tc := range tt {
+		_, err := ParseResourcesRequestParams(tc.Values)
+		assert.Equal(t, tc.Err, err, tc.Values)
+	}
+}
+
+func TestService_SearchResources(t *testing.T) {
+	columns := []string{
+		"id", "name", "extension", "size", "version", "hidden", "codec", "hash", "md5", "tags", "metadata", "mime_type", "revision", "created_on", "score",
+	}
+
+	t.Run("Returns the resources with their scores", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		best := SearchResult{Resource: Resource{ID: "1", Name: "quarterly report", Extension: "pdf", Size: 5, Version: 1,
+			Tags: []string{"finance"}, Metadata: metadata.Metadata{}, CreatedOn: time.Now()}, Score: 0.9}
+		other := SearchResult{Resource: Resource{ID: "2", Name: "report draft", Extension: "txt", Size: 3, Version: 1,
+			Tags: []string{}, Metadata: metadata.Metadata{}, CreatedOn: time.Now()}, Score: 0.4}
+
+		mock.ExpectQuery(`^SELECT (.+) websearch_to_tsquery\('simple', \$2\) (.+) WHERE rr.app_id = \$1 (.+) ORDER BY score DESC, r.id\s+LIMIT \$5$`).
+			WithArgs("admin", "repo_rt", false, `%repo\_rt%`, DefaultSearchLimit).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(append(spread(best.Resource), best.Score)...).
+				AddRow(append(spread(other.Resource), other.Score)...))
+
+		info := getService(db).SearchResources(SearchRequestParams{AppID: "admin", Query: "repo_rt"})
+
+		assert.Nil(t, info.Err)
+		assert.Equal(t, []SearchResult{best, other}, info.Results)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Results are empty when the search fails", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(`^SELECT (.+) FROM resources r`).
+			WithArgs("admin", "report", true, "%report%", 5).
+			WillReturnError(errors.New("function similarity does not exist"))
+
+		info := getService(db).SearchResources(SearchRequestParams{AppID: "admin", Query: "report", IncludeHidden: true, Limit: 5})
+
+		assert.Equal(t, ErrCouldNotRetrieveResults, info.Err)
+		assert.NotNil(t, info.Results)
+		assert.Empty(t, info.Results)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestParseSearchRequestParams(t *testing.T) {
+	params, err := ParseSearchRequestParams(url.Values{"q": {" annual report "}, "limit": {"5"}, "includeHidden": {"true"}})
+	assert.Nil(t, err)
+	assert.Equal(t, SearchRequestParams{Query: "annual report", IncludeHidden: true, Limit: 5}, params)
+
+	params, err = ParseSearchRequestParams(url.Values{"q": {"report"}})
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultSearchLimit, params.Limit)
+
+	tt := []struct {
+		Values url.Values
+		Err    error
+	}{
+		{Values: url.Values{}, Err: ErrInvalidSearch},
+		{Values: url.Values{"q": {"   "}}, Err: ErrInvalidSearch},
+		{Values: url.Values{"q": {strings.Repeat("a", MaxSearchLength+1)}}, Err: ErrInvalidSearch},
+		{Values: url.Values{"q": {"report"}, "limit": {"0"}}, Err: ErrInvalidLimit},
+	}
+	for _, tc := range tt {
+		_, err := ParseSearchRequestParams(tc.Values)
+		assert.Equal(t, tc.Err, err, tc.Values)
+	}
+}
+
 func TestService_GetSingleResourceInformation(t *testing.T) {
 	columns := []string{
-		"id", "name", "extension", "size", "created_on", "saved_location",
+		"id", "name", "extension", "size", "version", "hidden", "codec", "hash", "md5", "tags", "metadata", "mime_type", "revision", "created_on", "saved_location", "storage",
 	}
 	t.Run("Successfully gets single resource information", func(t *testing.T) {
 		db, mock := getDbAndMock(t)
@@ -125,6 +531,8 @@ func TestService_GetSingleResourceInformation(t *testing.T) {
 
 		expected := DownloadableResource{
 			Resource: Resource{
+				Tags:      []string{"report"},
+				Metadata:  metadata.Metadata{},
 				ID:        "123456",
 				Name:      "mock",
 				Extension: "pdf",
@@ -132,6 +540,7 @@ func TestService_GetSingleResourceInformation(t *testing.T) {
 				Size:      123456,
 			},
 			SavedLocation: "./hello/mock.pdf",
+			Storage:       storage.LocalDriver,
 		}
 
 		mock.ExpectQuery(`\s*SELECT (.+) \s*FROM resources r*`).
@@ -173,7 +582,7 @@ func TestService_GetSingleResourceInformation(t *testing.T) {
 
 func TestService_GetSingleResource(t *testing.T) {
 	columns := []string{
-		"id", "name", "extension", "size", "created_on", "saved_location",
+		"id", "name", "extension", "size", "version", "hidden", "codec", "hash", "md5", "tags", "metadata", "mime_type", "revision", "created_on", "saved_location", "storage",
 	}
 
 	t.Run("Get single resource information", func(t *testing.T) {
@@ -182,13 +591,17 @@ func TestService_GetSingleResource(t *testing.T) {
 
 		dr := DownloadableResource{
 			Resource: Resource{
+				Tags:      []string{},
+				Metadata:  metadata.Metadata{},
 				ID:        "123456789",
 				Name:      "mock",
 				Extension: "pdf",
 				CreatedOn: time.Now(),
 				Size:      123456,
+				Revision:  3,
 			},
 			SavedLocation: "./hello/mock.pdf",
+			Storage:       storage.LocalDriver,
 		}
 		mock.ExpectQuery(`\s*SELECT (.+) \s*FROM resources r*`).
 			WithArgs("admin", "123456789").
@@ -206,10 +619,15 @@ func TestService_GetSingleResource(t *testing.T) {
 			File:   nil,
 			Data:   commons.MakeSuccessResponse("Successfully retrieved the resource information", dr.Resource),
 			Status: http.StatusOK,
+			ETag:   `"rev-3"`,
 		}, result)
 	})
 
 	t.Run("Get single resource download information", func(t *testing.T) {
+		assert.Nil(t, files.Put("mock.pdf", strings.NewReader("hello"), 5))
+		t.Cleanup(func() {
+			_ = files.Delete("mock.pdf")
+		})
 		db, mock := getDbAndMock(t)
 		s := getService(db)
 
@@ -220,8 +638,11 @@ func TestService_GetSingleResource(t *testing.T) {
 				Extension: "pdf",
 				CreatedOn: time.Now(),
 				Size:      123456,
+				Hash:      "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+				MD5:       "5d41402abc4b2a76b9719d911017c592",
 			},
-			SavedLocation: "hello/mock.pdf",
+			SavedLocation: "mock.pdf",
+			Storage:       storage.MemoryDriver,
 		}
 		mock.ExpectQuery(`\s*SELECT (.+) \s*FROM resources r*`).
 			WithArgs("admin", "123456789").
@@ -235,12 +656,41 @@ func TestService_GetSingleResource(t *testing.T) {
 			Download:   true,
 		})
 
-		assert.Equal(t, SingleResourceResult{
-			File: &SingleResourceFileResult{
-				Name: "mock.pdf",
-				Path: filepath.Join(config.Config.FileUploadDir, "hello/mock.pdf"),
-			},
-		}, result)
+		assert.NotNil(t, result.File)
+		assert.Equal(t, "mock.pdf", result.File.Name)
+		assert.Equal(t, "mock.pdf", result.File.Location)
+		assert.Equal(t, storage.MemoryDriver, result.File.Driver.Name())
+		assert.Equal(t, int64(5), result.File.Stored.Size)
+		assert.Equal(t, int64(123456), result.File.Size)
+		assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", result.File.Hash)
+		assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", result.File.MD5)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Not found when the file is missing from the storage", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		dr := DownloadableResource{
+			Resource:      Resource{ID: "123456789", Name: "mock", Extension: "pdf", CreatedOn: time.Now()},
+			SavedLocation: "mock.pdf",
+			Storage:       storage.MemoryDriver,
+		}
+		mock.ExpectQuery(`\s*SELECT (.+) \s*FROM resources r*`).
+			WithArgs("admin", "123456789").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(
+				spreadDR(dr)...,
+			))
+
+		result := s.GetSingleResource(SingleResourceRequestParams{
+			AppID:      "admin",
+			ResourceID: "123456789",
+			Download:   true,
+		})
+
+		assert.Nil(t, result.File)
+		assert.Equal(t, http.StatusNotFound, result.Status)
+		assert.Nil(t, mock.ExpectationsWereMet())
 	})
 
 	t.Run("Return empty results when no data is available", func(t *testing.T) {
@@ -304,18 +754,27 @@ func getDbAndMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
 	return db, mock
 }
 
+// files holds the files of the resources the tests download
+var files = storage.NewMemory()
+
 func getService(db *sql.DB) *Service {
 	r := NewRepository(db)
-	return NewService(r)
+	drivers, _ := storage.NewRegistry(storage.MemoryDriver, files)
+	return NewService(r, drivers)
 }
 
 func spread(resource Resource) []driver.Value {
 	return []driver.Value{
-		resource.ID, resource.Name, resource.Extension, resource.Size, resource.CreatedOn,
+		resource.ID, resource.Name, resource.Extension, resource.Size, resource.Version, resource.Hidden, resource.Codec, resource.Hash, resource.MD5, "{" + strings.Join(resource.Tags, ",") + "}", encode(resource.Metadata), resource.MimeType, resource.Revision, resource.CreatedOn,
 	}
 }
 
+func encode(meta metadata.Metadata) string {
+	encoded, _ := meta.Value()
+	return encoded.(string)
+}
+
 func spreadDR(dr DownloadableResource) []driver.Value {
 	values := spread(dr.Resource)
-	return append(values, dr.SavedLocation)
+	return append(values, dr.SavedLocation, dr.Storage)
 }
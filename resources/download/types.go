@@ -3,6 +3,9 @@ package download
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"github.com/mensurowary/juno/resources/metadata"
+	"github.com/mensurowary/juno/resources/storage"
 	"time"
 )
 
@@ -11,25 +14,123 @@ type Repository struct {
 }
 
 type Resource struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Extension string    `json:"extension"`
-	Size      int64     `json:"size"`
-	CreatedOn time.Time `json:"created_on"`
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Extension string            `json:"extension"`
+	Size      int64             `json:"size"`
+	Version   int               `json:"version"`
+	Hidden    bool              `json:"hidden"`
+	Codec     string            `json:"codec,omitempty"`
+	Hash      string            `json:"hash,omitempty"`
+	MD5       string            `json:"md5,omitempty"`
+	Tags      []string          `json:"tags"`
+	Metadata  metadata.Metadata `json:"metadata"`
+	MimeType  string            `json:"mime_type,omitempty"`
+	Revision  int               `json:"revision"`
+	CreatedOn time.Time         `json:"created_on"`
+}
+
+// ETag is the entity tag of the information of the resource. The revision is bumped by every change of the
+// resource, so the tag tells the clients whether the resource was changed since they read it.
+func (r Resource) ETag() string {
+	return fmt.Sprintf(`"rev-%d"`, r.Revision)
 }
 
 type ResourceInformation struct {
 	Resources []Resource
-	Err       error
+	// Next and Prev are the cursors of the pages around, empty when there are none
+	Next, Prev string
+	// Total is the number of the resources listed across all the pages
+	Total int
+	Err   error
 }
 
 type DownloadableResource struct {
 	Resource      Resource
 	SavedLocation string
+	// Storage is the name of the driver holding the file
+	Storage string
 }
 
 type Service struct {
-	r *Repository
+	r       *Repository
+	drivers *storage.Registry
+}
+
+// ResourcesRequestParams picks the resources of the application to be listed
+type ResourcesRequestParams struct {
+	AppID         string
+	IncludeHidden bool
+	// Tags are the tags the resources must all have
+	Tags []string
+	// Extensions are the extensions the resources may have, any when empty
+	Extensions []string
+	// MinSize and MaxSize bound the size of the resources, unbounded when nil
+	MinSize, MaxSize *int64
+	// CreatedAfter and CreatedBefore bound the creation of the resources, the latter exclusively
+	CreatedAfter, CreatedBefore *time.Time
+	NamePrefix                  string
+	// Metadata are the values the metadata of the resources must have under the keys, compared as text
+	Metadata map[string]string
+	// MetadataKeys are the keys the metadata of the resources must all have
+	MetadataKeys []string
+	// Sort is the field the resources are listed by, the ids break the ties
+	Sort, Order string
+	// Limit is the size of a page, DefaultLimit when not set
+	Limit  int
+	Cursor *Cursor
+}
+
+// SearchRequestParams picks the resources of the application to be searched
+type SearchRequestParams struct {
+	AppID         string
+	Query         string
+	IncludeHidden bool
+	// Limit is the number of the best matching resources returned, DefaultSearchLimit when not set
+	Limit int
+}
+
+// SearchResult is a resource matching the search along with its relevance, the greater the better
+type SearchResult struct {
+	Resource
+	Score float64 `json:"score"`
+}
+
+type SearchInformation struct {
+	Results []SearchResult
+	Err     error
+}
+
+// the fields the resources can be listed by
+const (
+	SortName      = "name"
+	SortSize      = "size"
+	SortCreatedOn = "created_on"
+)
+
+// the orders the resources can be listed in
+const (
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+// the sizes of the pages of the listing
+const (
+	DefaultLimit       = 100
+	DefaultSearchLimit = 20
+	MaxLimit           = 1000
+	// MaxSearchLength is the longest search query
+	MaxSearchLength = 256
+)
+
+// Cursor is a position in the listing, the page after it is listed or the one before it when Before is set.
+// It holds the sort and the order it was made for, so that it is not used for another listing.
+type Cursor struct {
+	Sort   string `json:"s"`
+	Order  string `json:"o"`
+	Value  string `json:"v"`
+	ID     string `json:"id"`
+	Before bool   `json:"b,omitempty"`
 }
 
 type SingleResourceRequestParams struct {
@@ -41,19 +142,46 @@ type SingleResourceResult struct {
 	File   *SingleResourceFileResult
 	Data   interface{}
 	Status int
+	// ETag is the entity tag of the information of the resource, empty when it is not found
+	ETag string
 }
 
 type SingleResourceFileResult struct {
-	Path, Name string
+	Name string
+	// Location is the file held by the Driver, Stored describes it as it is held
+	Location string
+	Driver   storage.Driver
+	Stored   storage.Info
+	// Codec is the compression codec the file is stored with, Size is its uncompressed size
+	Codec string
+	Size  int64
+	// ContentType is the stored media type of the file, empty when it is told by the name
+	ContentType string
+	// Hash and MD5 are the hex encoded SHA-256 and MD5 of the uncompressed content, empty for the files stored before they were recorded
+	Hash, MD5 string
 }
 
+var (
+	ErrInvalidLimit  = errors.New("invalid limit, must be between 1 and 1000")
+	ErrUnknownSort   = errors.New("unknown sort, must be one of name, size or created_on")
+	ErrUnknownOrder  = errors.New("unknown order, must be either asc or desc")
+	ErrInvalidFilter = errors.New("invalid filter, the sizes must be numbers and the dates RFC 3339 timestamps or dates")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSearch = errors.New("invalid search, the query must be between 1 and 256 characters")
+)
+
 var (
 	ErrCouldNotRetrieveResults = errors.New("could not retrieve the results")
 	NoDownloadableResource     = DownloadableResource{}
 )
 
-func NewService(r *Repository) *Service {
-	return &Service{r}
+// Found tells whether the resource exists, NoDownloadableResource is returned otherwise
+func (d DownloadableResource) Found() bool {
+	return d.Resource.ID != ""
+}
+
+func NewService(r *Repository, drivers *storage.Registry) *Service {
+	return &Service{r, drivers}
 }
 
 func NewRepository(db *sql.DB) *Repository {
@@ -2,17 +2,29 @@ package interactions
 
 import (
 	"database/sql"
+	"github.com/lib/pq"
+	"github.com/mensurowary/juno/resources/download"
+	"github.com/mensurowary/juno/resources/metadata"
+	"github.com/mensurowary/juno/resources/upload"
 	log "github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
 )
 
 var deleteResourceByIDQuery = `DELETE FROM resources WHERE id IN (SELECT r.id FROM resources r JOIN resource_relations rr ON r.id = rr.resource_id WHERE app_id = $1 AND r.id = $2)`
 
-func (r Repository) DeleteResourceByID(resourceID, appID string) error {
+// DeleteResourceByID deletes the resource stored in the file at the location of the storage driver, the release
+// function removes the file before the deletion is committed when no other resource is stored in it
+func (r Repository) DeleteResourceByID(resourceID, appID, storage, location string, release func() error) error {
 	tx, err := r.db.Begin()
 	if err != nil {
 		return mitigate(tx, err, "Error occurred when starting the transaction", ErrCouldNotStartTx)
 	}
 
+	if err := upload.LockLocation(tx, storage, location); err != nil {
+		return mitigate(tx, err, "Error occurred when locking the stored file", ErrCouldNotExecStmt)
+	}
+
 	stmt, err := tx.Prepare(deleteResourceByIDQuery)
 	if err != nil {
 		return mitigate(tx, err, "Error occurred when creating the prepared statement", ErrCouldNotCreatePS)
@@ -29,9 +41,197 @@ func (r Repository) DeleteResourceByID(resourceID, appID string) error {
 		return err
 	}
 
+	references, err := upload.CountReferences(tx, storage, location)
+	if err != nil {
+		return mitigate(tx, err, "Error occurred when counting the references to the stored file", ErrCouldNotExecStmt)
+	}
+
+	if references == 0 {
+		if err := release(); err != nil {
+			return mitigate(tx, err, "Error occurred when removing the stored file", ErrCouldNotDeleteFile)
+		}
+	}
+
 	return handleCommit(tx)
 }
 
+// UpdateResource applies the changes to the resource and returns the resource as it ends up. The renames take the lock
+// of the new name first, like the uploads do, so that the versions of the new name are numbered one after the other.
+func (r Repository) UpdateResource(params UpdateResourceParameters) (download.Resource, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return download.Resource{}, mitigate(tx, err, "Error occurred when starting the transaction", ErrCouldNotStartTx)
+	}
+
+	if params.Name != nil {
+		if err := upload.LockName(tx, params.AppID, *params.Name, *params.Extension); err != nil {
+			return download.Resource{}, mitigate(tx, err, "Error occurred when locking the resource name", ErrCouldNotExecStmt)
+		}
+	}
+
+	var revision int
+	err = tx.QueryRow(`SELECT r.revision FROM resources r JOIN resource_relations rr ON r.id = rr.resource_id WHERE rr.app_id = $1 AND r.id = $2 FOR UPDATE`,
+		params.AppID, params.ResourceID).Scan(&revision)
+	if err == sql.ErrNoRows {
+		return download.Resource{}, mitigate(tx, err, "The resource to be updated does not exist", ErrCouldNotFind)
+	}
+	if err != nil {
+		return download.Resource{}, mitigate(tx, err, "Error occurred when locking the resource", ErrCouldNotExecStmt)
+	}
+	if !matchesRevision(params.Revisions, revision) {
+		return download.Resource{}, mitigate(tx, ErrRevisionMismatch, "The resource was changed since the given revision", ErrRevisionMismatch)
+	}
+
+	q := &update{}
+	q.arg(params.ResourceID)
+	if params.Name != nil {
+		// like the uploads by default, the renamed resource becomes the next version of the resources with its new name
+		var latest int
+		if err := tx.QueryRow(`SELECT COALESCE(MAX(r.version), 0) FROM resources r JOIN resource_relations rr ON r.id = rr.resource_id WHERE rr.app_id = $1 AND r.name = $2 AND r.extension = $3 AND r.id <> $4`,
+			params.AppID, *params.Name, *params.Extension, params.ResourceID).Scan(&latest); err != nil {
+			return download.Resource{}, mitigate(tx, err, "Error occurred when looking for the resources with the same name", ErrCouldNotExecStmt)
+		}
+		q.set("name", *params.Name)
+		q.set("extension", *params.Extension)
+		q.set("version", latest+1)
+	}
+	if params.MimeType != nil {
+		q.set("mime_type", *params.MimeType)
+	}
+	if params.Hidden != nil {
+		q.set("hidden", *params.Hidden)
+	}
+
+	q.columns = append(q.columns, "revision = revision + 1")
+	resource, err := scanResource(tx.QueryRow(`UPDATE resources SET `+strings.Join(q.columns, ", ")+` WHERE id = $1 RETURNING `+resourceColumns, q.args...))
+	if err != nil {
+		return download.Resource{}, mitigate(tx, err, "Error occurred when updating the resource", ErrCouldNotExecStmt)
+	}
+
+	return resource, handleCommit(tx)
+}
+
+// resourceColumns read back the changed resource as it is listed
+const resourceColumns = `id, name, extension, size, version, hidden, codec, COALESCE(hash, ''), COALESCE(md5, ''),
+	ARRAY(SELECT t.tag FROM tag_relations t WHERE t.resource_id = resources.id ORDER BY t.tag), metadata, mime_type, revision, created_on`
+
+func scanResource(row *sql.Row) (download.Resource, error) {
+	var resource download.Resource
+	err := row.Scan(&resource.ID, &resource.Name, &resource.Extension, &resource.Size, &resource.Version, &resource.Hidden, &resource.Codec,
+		&resource.Hash, &resource.MD5, pq.Array(&resource.Tags), &resource.Metadata, &resource.MimeType, &resource.Revision, &resource.CreatedOn)
+	return resource, err
+}
+
+// lockRevision locks the resource until the end of the transaction and checks that it is at one of the expected revisions
+func lockRevision(tx *sql.Tx, resourceID string, revisions []int) error {
+	var revision int
+	err := tx.QueryRow(`SELECT revision FROM resources WHERE id = $1 FOR UPDATE`, resourceID).Scan(&revision)
+	if err == sql.ErrNoRows {
+		return mitigate(tx, err, "The resource to be updated does not exist", ErrCouldNotFind)
+	}
+	if err != nil {
+		return mitigate(tx, err, "Error occurred when locking the resource", ErrCouldNotExecStmt)
+	}
+	if !matchesRevision(revisions, revision) {
+		return mitigate(tx, ErrRevisionMismatch, "The resource was changed since the given revision", ErrRevisionMismatch)
+	}
+	return nil
+}
+
+// matchesRevision tells whether the resource at the revision is at one of the expected revisions
+func matchesRevision(expected []int, revision int) bool {
+	if expected == nil {
+		return true
+	}
+	for _, r := range expected {
+		if r == revision {
+			return true
+		}
+	}
+	return false
+}
+
+// update collects the assignments of an UPDATE statement along with their arguments
+type update struct {
+	columns []string
+	args    []interface{}
+}
+
+func (u *update) arg(value interface{}) string {
+	u.args = append(u.args, value)
+	return "$" + strconv.Itoa(len(u.args))
+}
+
+func (u *update) set(column string, value interface{}) {
+	u.columns = append(u.columns, column+" = "+u.arg(value))
+}
+
+// UpdateResourceTags adds the tags to the resource and removes the others when it is at one of the expected revisions,
+// the resource is returned as it ends up
+func (r Repository) UpdateResourceTags(resourceID string, add, remove []string, revisions []int) (download.Resource, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return download.Resource{}, mitigate(tx, err, "Error occurred when starting the transaction", ErrCouldNotStartTx)
+	}
+
+	if err := lockRevision(tx, resourceID, revisions); err != nil {
+		return download.Resource{}, err
+	}
+
+	if err := upload.AddTags(tx, resourceID, add); err != nil {
+		return download.Resource{}, mitigate(tx, err, "Error occurred when adding the tags", ErrCouldNotExecStmt)
+	}
+
+	if len(remove) > 0 {
+		if _, err := tx.Exec(`DELETE FROM tag_relations WHERE resource_id = $1 AND tag = ANY($2)`, resourceID, pq.Array(remove)); err != nil {
+			return download.Resource{}, mitigate(tx, err, "Error occurred when removing the tags", ErrCouldNotExecStmt)
+		}
+	}
+
+	resource, err := scanResource(tx.QueryRow(`UPDATE resources SET revision = revision + 1 WHERE id = $1 RETURNING `+resourceColumns, resourceID))
+	if err != nil {
+		return download.Resource{}, mitigate(tx, err, "Error occurred when bumping the revision", ErrCouldNotExecStmt)
+	}
+
+	return resource, handleCommit(tx)
+}
+
+// UpdateResourceMetadata merges the patch into the metadata of the resource when it is at one of the expected revisions,
+// the resource is returned as it ends up. The merged metadata is checked against the limits before it is saved.
+func (r Repository) UpdateResourceMetadata(resourceID string, patch metadata.Metadata, revisions []int) (download.Resource, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return download.Resource{}, mitigate(tx, err, "Error occurred when starting the transaction", ErrCouldNotStartTx)
+	}
+
+	var (
+		current  metadata.Metadata
+		revision int
+	)
+	err = tx.QueryRow(`SELECT metadata, revision FROM resources WHERE id = $1 FOR UPDATE`, resourceID).Scan(&current, &revision)
+	if err == sql.ErrNoRows {
+		return download.Resource{}, mitigate(tx, err, "The resource to be updated does not exist", ErrCouldNotFind)
+	}
+	if err != nil {
+		return download.Resource{}, mitigate(tx, err, "Error occurred when reading the metadata", ErrCouldNotExecStmt)
+	}
+	if !matchesRevision(revisions, revision) {
+		return download.Resource{}, mitigate(tx, ErrRevisionMismatch, "The resource was changed since the given revision", ErrRevisionMismatch)
+	}
+
+	merged := current.Merge(patch)
+	if err := merged.Validate(); err != nil {
+		return download.Resource{}, mitigate(tx, err, "The merged metadata is over the limits", err)
+	}
+
+	resource, err := scanResource(tx.QueryRow(`UPDATE resources SET metadata = $2, revision = revision + 1 WHERE id = $1 RETURNING `+resourceColumns, resourceID, merged))
+	if err != nil {
+		return download.Resource{}, mitigate(tx, err, "Error occurred when updating the metadata", ErrCouldNotExecStmt)
+	}
+
+	return resource, handleCommit(tx)
+}
+
 func handleExec(tx *sql.Tx, stmt *sql.Stmt, args ...interface{}) (sql.Result, error) {
 	result, err := stmt.Exec(args...)
 
@@ -57,7 +257,7 @@ func handleRowsAffected(err error, result sql.Result, tx *sql.Tx) error {
 func handleCommit(tx *sql.Tx) error {
 	err := tx.Commit()
 	if err != nil {
-		log.Errorf("Could not commit the deletion : %v", err)
+		log.Errorf("Could not commit the changes : %v", err)
 		return ErrCouldNotCommit
 	}
 	return nil
@@ -70,6 +270,6 @@ func mitigate(tx *sql.Tx, err error, errMessage string, newErr error) error {
 			log.Errorf("%s : %v", errMessage, err2)
 		}
 	}
-	log.Errorf("Error occurred while deleting a single resource : %v", err)
+	log.Errorf("Error occurred while changing a single resource : %v", err)
 	return newErr
 }
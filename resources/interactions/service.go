@@ -1,11 +1,13 @@
 package interactions
 
 import (
-	"github.com/mensurowary/juno/config"
 	"github.com/mensurowary/juno/resources/download"
+	"github.com/mensurowary/juno/resources/metadata"
+	"github.com/mensurowary/juno/resources/upload"
 	log "github.com/sirupsen/logrus"
-	"os"
-	"path/filepath"
+	"mime"
+	"strconv"
+	"strings"
 )
 
 func (s *Service) DeleteSingleResourceByID(resourceID, appID string) error {
@@ -14,21 +16,170 @@ func (s *Service) DeleteSingleResourceByID(resourceID, appID string) error {
 		AppID:      appID,
 	})
 
-	if resourceInfo == download.NoDownloadableResource {
+	if !resourceInfo.Found() {
 		log.Infof("Requested resource [%s] does not exist", resourceID)
 		return ErrCouldNotFind
 	}
 
-	err := s.r.DeleteResourceByID(resourceID, appID)
+	// the file is shared by the resources with the same content, it goes with the last of them
+	location := resourceInfo.SavedLocation
+	release := func() error {
+		driver, err := s.drivers.Get(resourceInfo.Storage)
+		if err == nil {
+			err = driver.Delete(location)
+		}
+		if err != nil {
+			log.Errorf(`Error occurred while deleting the file "%s" of the %s storage : %v`, location, resourceInfo.Storage, err)
+			return err
+		}
+		return nil
+	}
+
+	err := s.r.DeleteResourceByID(resourceID, appID, resourceInfo.Storage, location, release)
+	if err == ErrCouldNotDeleteFile {
+		return err
+	}
 	if err != nil {
 		log.Errorf("Could not delete the resource [%s]", resourceID)
 		return ErrCouldNotDeleteData
 	}
+	return nil
+}
 
-	location := filepath.Join(config.Config.FileUploadDir, resourceInfo.SavedLocation)
-	if err := os.Remove(location); err != nil {
-		log.Errorf(`Error occurred while deleting the file "%s" : %v`, location, err)
-		return ErrCouldNotDeleteFile
+// UpdateResource renames the resource, changes the media type it is served with or hides it from the listings,
+// the changes are applied only when the resource is at one of the expected revisions
+func (s *Service) UpdateResource(params UpdateResourceParameters) (download.Resource, error) {
+	if params.Name != nil && strings.TrimSpace(*params.Name) == "" {
+		return download.Resource{}, ErrInvalidUpdate
 	}
-	return nil
+	if params.MimeType != nil && *params.MimeType != "" {
+		if _, _, err := mime.ParseMediaType(*params.MimeType); err != nil {
+			return download.Resource{}, ErrInvalidUpdate
+		}
+	}
+
+	resourceInfo := s.rs.GetSingleResourceInformation(download.SingleResourceRequestParams{
+		ResourceID: params.ResourceID,
+		AppID:      params.AppID,
+	})
+
+	if !resourceInfo.Found() {
+		log.Infof("Requested resource [%s] does not exist", params.ResourceID)
+		return download.Resource{}, ErrCouldNotFind
+	}
+
+	// the renames set both the name and the extension, the one not given is kept, renaming to the same name changes nothing
+	if params.Name != nil || params.Extension != nil {
+		name, extension := resourceInfo.Resource.Name, resourceInfo.Resource.Extension
+		if params.Name != nil {
+			name = strings.TrimSpace(*params.Name)
+		}
+		if params.Extension != nil {
+			extension = strings.TrimPrefix(strings.TrimSpace(*params.Extension), ".")
+		}
+		params.Name, params.Extension = nil, nil
+		if name != resourceInfo.Resource.Name || extension != resourceInfo.Resource.Extension {
+			params.Name, params.Extension = &name, &extension
+		}
+	}
+
+	resource, err := s.r.UpdateResource(params)
+	switch err {
+	case nil:
+		return resource, nil
+	case ErrCouldNotFind, ErrRevisionMismatch:
+		return download.Resource{}, err
+	default:
+		log.Errorf("Could not update the resource [%s]", params.ResourceID)
+		return download.Resource{}, ErrCouldNotUpdateData
+	}
+}
+
+// AddResourceTags tags the resource when it is at one of the expected revisions, the tags it already has are skipped
+func (s *Service) AddResourceTags(resourceID, appID string, tags []string, revisions []int) (download.Resource, error) {
+	return s.updateResourceTags(resourceID, appID, tags, nil, revisions)
+}
+
+// RemoveResourceTags removes the tags from the resource when it is at one of the expected revisions,
+// the tags it does not have are skipped
+func (s *Service) RemoveResourceTags(resourceID, appID string, tags []string, revisions []int) (download.Resource, error) {
+	return s.updateResourceTags(resourceID, appID, nil, tags, revisions)
+}
+
+func (s *Service) updateResourceTags(resourceID, appID string, add, remove []string, revisions []int) (download.Resource, error) {
+	add, err := upload.ParseTags(add)
+	if err != nil {
+		return download.Resource{}, err
+	}
+	remove, err = upload.ParseTags(remove)
+	if err != nil {
+		return download.Resource{}, err
+	}
+
+	resourceInfo := s.rs.GetSingleResourceInformation(download.SingleResourceRequestParams{
+		ResourceID: resourceID,
+		AppID:      appID,
+	})
+
+	if !resourceInfo.Found() {
+		log.Infof("Requested resource [%s] does not exist", resourceID)
+		return download.Resource{}, ErrCouldNotFind
+	}
+
+	resource, err := s.r.UpdateResourceTags(resourceID, add, remove, revisions)
+	if err == ErrCouldNotFind || err == ErrRevisionMismatch {
+		return download.Resource{}, err
+	}
+	if err != nil {
+		log.Errorf("Could not update the tags of the resource [%s]", resourceID)
+		return download.Resource{}, ErrCouldNotUpdateData
+	}
+	return resource, nil
+}
+
+// UpdateResourceMetadata merges the patch into the metadata of the resource as a JSON merge patch when it is at one
+// of the expected revisions, the null values remove the keys
+func (s *Service) UpdateResourceMetadata(resourceID, appID string, patch metadata.Metadata, revisions []int) (download.Resource, error) {
+	if err := patch.Validate(); err != nil {
+		return download.Resource{}, err
+	}
+
+	resourceInfo := s.rs.GetSingleResourceInformation(download.SingleResourceRequestParams{
+		ResourceID: resourceID,
+		AppID:      appID,
+	})
+
+	if !resourceInfo.Found() {
+		log.Infof("Requested resource [%s] does not exist", resourceID)
+		return download.Resource{}, ErrCouldNotFind
+	}
+
+	resource, err := s.r.UpdateResourceMetadata(resourceID, patch, revisions)
+	if err == metadata.ErrInvalidMetadata || err == metadata.ErrMetadataTooLarge || err == ErrCouldNotFind || err == ErrRevisionMismatch {
+		return download.Resource{}, err
+	}
+	if err != nil {
+		log.Errorf("Could not update the metadata of the resource [%s]", resourceID)
+		return download.Resource{}, ErrCouldNotUpdateData
+	}
+	return resource, nil
+}
+
+// ParseIfMatch reads the revisions of the If-Match header, made of the entity tags of download.Resource.ETag.
+// The revisions are nil for any when the header is missing or *, the weak tags never match.
+func ParseIfMatch(header string) []int {
+	if header = strings.TrimSpace(header); header == "" || header == "*" {
+		return nil
+	}
+	revisions := []int{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if !strings.HasPrefix(tag, `"rev-`) || !strings.HasSuffix(tag, `"`) {
+			continue
+		}
+		if revision, err := strconv.Atoi(tag[len(`"rev-`) : len(tag)-1]); err == nil {
+			revisions = append(revisions, revision)
+		}
+	}
+	return revisions
 }
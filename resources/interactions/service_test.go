@@ -6,9 +6,13 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/mensurowary/juno/config"
 	"github.com/mensurowary/juno/resources/download"
+	"github.com/mensurowary/juno/resources/metadata"
+	"github.com/mensurowary/juno/resources/storage"
+	"github.com/mensurowary/juno/resources/upload"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -29,20 +33,26 @@ func TestService_DeleteSingleResourceByID(t *testing.T) {
 		baseFilename := createDummyFile(t)
 		db, mock := getDbAndMock(t)
 		s := getService(db, download.DownloadableResource{
+			Resource:      download.Resource{ID: "123456789"},
 			SavedLocation: baseFilename,
+			Storage:       storage.LocalDriver,
 		})
 
 		mock.ExpectBegin()
+		expectLocationLock(mock, baseFilename)
 		mock.ExpectPrepare(`^DELETE FROM resources WHERE id IN*`).
 			ExpectExec().
 			WithArgs("admin", "123456789").
 			WillReturnResult(sqlmock.NewResult(-1, 1))
+		expectReferences(mock, baseFilename, 0)
 		mock.ExpectCommit()
 
 		result := s.DeleteSingleResourceByID("123456789", "admin")
 
 		assert.Nil(t, result)
 		assert.Nil(t, mock.ExpectationsWereMet())
+		_, err := os.Stat(filepath.Join(tmpDir, baseFilename))
+		assert.True(t, os.IsNotExist(err))
 
 		t.Cleanup(func() {
 			_ = os.RemoveAll("./tmp")
@@ -54,10 +64,13 @@ func TestService_DeleteSingleResourceByID(t *testing.T) {
 		baseFilename := createDummyFile(t)
 		db, mock := getDbAndMock(t)
 		s := getService(db, download.DownloadableResource{
+			Resource:      download.Resource{ID: "123456789"},
 			SavedLocation: baseFilename,
+			Storage:       storage.LocalDriver,
 		})
 
 		mock.ExpectBegin()
+		expectLocationLock(mock, baseFilename)
 		mock.ExpectPrepare(`^DELETE FROM resources WHERE id IN*`).
 			ExpectExec().
 			WithArgs("admin", "123456789").
@@ -80,21 +93,55 @@ func TestService_DeleteSingleResourceByID(t *testing.T) {
 
 		db, mock := getDbAndMock(t)
 		s := getService(db, download.DownloadableResource{
+			Resource:      download.Resource{ID: "123456789"},
 			SavedLocation: baseFilename + "random",
+			Storage:       storage.LocalDriver,
 		})
 
 		mock.ExpectBegin()
+		expectLocationLock(mock, baseFilename+"random")
 		mock.ExpectPrepare(`^DELETE FROM resources WHERE id IN*`).
 			ExpectExec().
 			WithArgs("admin", "123456789").
 			WillReturnResult(sqlmock.NewResult(-1, 1))
-		mock.ExpectCommit()
+		expectReferences(mock, baseFilename+"random", 0)
+		mock.ExpectRollback()
 
 		result := s.DeleteSingleResourceByID("123456789", "admin")
 
 		assert.Equal(t, ErrCouldNotDeleteFile, result)
 		assert.Nil(t, mock.ExpectationsWereMet())
 
+		t.Cleanup(func() {
+			_ = os.RemoveAll("./tmp")
+			_ = db.Close()
+		})
+	})
+	t.Run("When the file is shared with another resource it is kept", func(t *testing.T) {
+		baseFilename := createDummyFile(t)
+		db, mock := getDbAndMock(t)
+		s := getService(db, download.DownloadableResource{
+			Resource:      download.Resource{ID: "123456789"},
+			SavedLocation: baseFilename,
+			Storage:       storage.LocalDriver,
+		})
+
+		mock.ExpectBegin()
+		expectLocationLock(mock, baseFilename)
+		mock.ExpectPrepare(`^DELETE FROM resources WHERE id IN*`).
+			ExpectExec().
+			WithArgs("admin", "123456789").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		expectReferences(mock, baseFilename, 1)
+		mock.ExpectCommit()
+
+		result := s.DeleteSingleResourceByID("123456789", "admin")
+
+		assert.Nil(t, result)
+		assert.Nil(t, mock.ExpectationsWereMet())
+		_, err := os.Stat(filepath.Join(tmpDir, baseFilename))
+		assert.Nil(t, err)
+
 		t.Cleanup(func() {
 			_ = os.RemoveAll("./tmp")
 			_ = db.Close()
@@ -108,7 +155,7 @@ func TestRepository_DeleteResourceByID(t *testing.T) {
 		r := NewRepository(db)
 
 		mock.ExpectBegin().WillReturnError(errors.New("begin resulted in error"))
-		err := r.DeleteResourceByID("", "")
+		err := r.DeleteResourceByID("", "", storage.LocalDriver, "report.pdf", noRelease)
 
 		assert.Equal(t, ErrCouldNotStartTx, err)
 		assert.Nil(t, mock.ExpectationsWereMet())
@@ -119,9 +166,10 @@ func TestRepository_DeleteResourceByID(t *testing.T) {
 		r := NewRepository(db)
 
 		mock.ExpectBegin()
+		expectLocationLock(mock, "report.pdf")
 		mock.ExpectPrepare(`^DELETE FROM resources WHERE id IN*`).
 			WillReturnError(errors.New("failed for no reason :)"))
-		err := r.DeleteResourceByID("", "")
+		err := r.DeleteResourceByID("", "", storage.LocalDriver, "report.pdf", noRelease)
 
 		assert.Equal(t, ErrCouldNotCreatePS, err)
 		assert.Nil(t, mock.ExpectationsWereMet())
@@ -132,11 +180,12 @@ func TestRepository_DeleteResourceByID(t *testing.T) {
 		r := NewRepository(db)
 
 		mock.ExpectBegin()
+		expectLocationLock(mock, "report.pdf")
 		mock.ExpectPrepare(`^DELETE FROM resources WHERE id IN*`).
 			ExpectExec().
 			WithArgs("app_id", "resource_id").
 			WillReturnError(errors.New("failed for no reason too"))
-		err := r.DeleteResourceByID("resource_id", "app_id")
+		err := r.DeleteResourceByID("resource_id", "app_id", storage.LocalDriver, "report.pdf", noRelease)
 
 		assert.Equal(t, ErrCouldNotExecStmt, err)
 		assert.Nil(t, mock.ExpectationsWereMet())
@@ -147,43 +196,595 @@ func TestRepository_DeleteResourceByID(t *testing.T) {
 		r := NewRepository(db)
 
 		mock.ExpectBegin()
+		expectLocationLock(mock, "report.pdf")
 		mock.ExpectPrepare(`^DELETE FROM resources WHERE id IN*`).
 			ExpectExec().
 			WithArgs("app_id", "resource_id").
 			WillReturnResult(sqlmock.NewErrorResult(errors.New("fails for no reason")))
-		err := r.DeleteResourceByID("resource_id", "app_id")
+		err := r.DeleteResourceByID("resource_id", "app_id", storage.LocalDriver, "report.pdf", noRelease)
 
 		assert.Equal(t, ErrCouldNotReadRowsAffected, err)
 		assert.Nil(t, mock.ExpectationsWereMet())
 	})
 
+	t.Run("Locking the stored file fails", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		r := NewRepository(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`^SELECT pg_advisory_xact_lock`).
+			WithArgs("location:local:report.pdf").
+			WillReturnError(errors.New("fails for no reason"))
+		mock.ExpectRollback()
+		err := r.DeleteResourceByID("resource_id", "app_id", storage.LocalDriver, "report.pdf", noRelease)
+
+		assert.Equal(t, ErrCouldNotExecStmt, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Counting the references fails", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		r := NewRepository(db)
+
+		mock.ExpectBegin()
+		expectLocationLock(mock, "report.pdf")
+		mock.ExpectPrepare(`^DELETE FROM resources WHERE id IN*`).
+			ExpectExec().
+			WithArgs("app_id", "resource_id").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(`^SELECT count\(\*\) FROM resource_relations`).
+			WithArgs("report.pdf", storage.LocalDriver).
+			WillReturnError(errors.New("fails for no reason"))
+		mock.ExpectRollback()
+		err := r.DeleteResourceByID("resource_id", "app_id", storage.LocalDriver, "report.pdf", noRelease)
+
+		assert.Equal(t, ErrCouldNotExecStmt, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
 	t.Run("Committing fails", func(t *testing.T) {
 		db, mock := getDbAndMock(t)
 		r := NewRepository(db)
 
 		mock.ExpectBegin()
+		expectLocationLock(mock, "report.pdf")
 		mock.ExpectPrepare(`^DELETE FROM resources WHERE id IN*`).
 			ExpectExec().
 			WithArgs("app_id", "resource_id").
 			WillReturnResult(sqlmock.NewResult(1, 1))
+		expectReferences(mock, "report.pdf", 1)
 		mock.ExpectCommit().WillReturnError(errors.New("fails for no reason"))
-		err := r.DeleteResourceByID("resource_id", "app_id")
+		err := r.DeleteResourceByID("resource_id", "app_id", storage.LocalDriver, "report.pdf", noRelease)
 
 		assert.Equal(t, ErrCouldNotCommit, err)
 		assert.Nil(t, mock.ExpectationsWereMet())
 	})
 }
 
+func TestService_UpdateResource(t *testing.T) {
+	hidden := true
+
+	t.Run("When resource does not exist", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.NoDownloadableResource)
+
+		_, err := s.UpdateResource(UpdateResourceParameters{ResourceID: "123456", AppID: "admin", Hidden: &hidden})
+
+		assert.Equal(t, ErrCouldNotFind, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Hides the resource", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789", Name: "draft", Revision: 1},
+		})
+		// the resource was tagged since it was read, the response holds it as it ends up
+		updated := download.Resource{ID: "123456789", Name: "draft", Hidden: true, Tags: []string{"q3"}, Metadata: metadata.Metadata{}, Revision: 3}
+
+		mock.ExpectBegin()
+		expectRevision(mock, 2)
+		mock.ExpectQuery(`^UPDATE resources SET hidden = \$2, revision = revision \+ 1 WHERE id = \$1 RETURNING id, name`).
+			WithArgs("123456789", true).
+			WillReturnRows(resourceRow(updated))
+		mock.ExpectCommit()
+
+		resource, err := s.UpdateResource(UpdateResourceParameters{ResourceID: "123456789", AppID: "admin", Hidden: &hidden})
+
+		assert.Nil(t, err)
+		assert.Equal(t, updated, resource)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Renames the resource and changes its mime type", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789", Name: "draft", Extension: "txt", Revision: 3},
+		})
+
+		name, mimeType := " report ", "text/markdown; charset=utf-8"
+		extension := ".md"
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`^SELECT pg_advisory_xact_lock`).
+			WithArgs("admin/report.md").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		expectRevision(mock, 3)
+		expectLatestVersion(mock, "report", "md", 0)
+		mock.ExpectQuery(`^UPDATE resources SET name = \$2, extension = \$3, version = \$4, mime_type = \$5, revision = revision \+ 1 WHERE id = \$1 RETURNING id, name`).
+			WithArgs("123456789", "report", "md", 1, mimeType).
+			WillReturnRows(resourceRow(download.Resource{ID: "123456789", Name: "report", Extension: "md", Version: 1, MimeType: mimeType, Revision: 4}))
+		mock.ExpectCommit()
+
+		resource, err := s.UpdateResource(UpdateResourceParameters{
+			ResourceID: "123456789",
+			AppID:      "admin",
+			Name:       &name,
+			Extension:  &extension,
+			MimeType:   &mimeType,
+			Revisions:  []int{3},
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, download.Resource{ID: "123456789", Name: "report", Extension: "md", Version: 1, MimeType: mimeType, Tags: []string{},
+			Metadata: metadata.Metadata{}, Revision: 4}, resource)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Renames the resource into the next version of the new name and keeps the extension", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789", Name: "draft", Extension: "txt", Version: 1, Revision: 1},
+		})
+
+		name := "report"
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`^SELECT pg_advisory_xact_lock`).
+			WithArgs("admin/report.txt").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		expectRevision(mock, 1)
+		expectLatestVersion(mock, "report", "txt", 2)
+		mock.ExpectQuery(`^UPDATE resources SET name = \$2, extension = \$3, version = \$4, revision = revision \+ 1 WHERE id = \$1 RETURNING id, name`).
+			WithArgs("123456789", "report", "txt", 3).
+			WillReturnRows(resourceRow(download.Resource{ID: "123456789", Name: "report", Extension: "txt", Version: 3, Revision: 2}))
+		mock.ExpectCommit()
+
+		resource, err := s.UpdateResource(UpdateResourceParameters{ResourceID: "123456789", AppID: "admin", Name: &name})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 3, resource.Version)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Leaves the name alone when it does not change", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789", Name: "report", Extension: "txt", Version: 2, Revision: 1},
+		})
+
+		name := " report "
+
+		mock.ExpectBegin()
+		expectRevision(mock, 1)
+		mock.ExpectQuery(`^UPDATE resources SET hidden = \$2, revision = revision \+ 1 WHERE id = \$1 RETURNING id, name`).
+			WithArgs("123456789", true).
+			WillReturnRows(resourceRow(download.Resource{ID: "123456789", Name: "report", Extension: "txt", Version: 2, Hidden: true, Revision: 2}))
+		mock.ExpectCommit()
+
+		resource, err := s.UpdateResource(UpdateResourceParameters{ResourceID: "123456789", AppID: "admin", Name: &name, Hidden: &hidden})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, resource.Version)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rejects the update when the resource was changed since", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789", Revision: 2},
+		})
+
+		mock.ExpectBegin()
+		expectRevision(mock, 3)
+		mock.ExpectRollback()
+
+		_, err := s.UpdateResource(UpdateResourceParameters{ResourceID: "123456789", AppID: "admin", Hidden: &hidden, Revisions: []int{2}})
+
+		assert.Equal(t, ErrRevisionMismatch, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rejects the invalid changes", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789"},
+		})
+
+		blank, malformed := "  ", "text/"
+
+		_, err := s.UpdateResource(UpdateResourceParameters{ResourceID: "123456789", AppID: "admin", Name: &blank})
+		assert.Equal(t, ErrInvalidUpdate, err)
+
+		_, err = s.UpdateResource(UpdateResourceParameters{ResourceID: "123456789", AppID: "admin", MimeType: &malformed})
+		assert.Equal(t, ErrInvalidUpdate, err)
+
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("When the update fails", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789"},
+		})
+
+		mock.ExpectBegin()
+		expectRevision(mock, 1)
+		mock.ExpectQuery(`^UPDATE resources SET hidden`).
+			WillReturnError(errors.New("disk full"))
+		mock.ExpectRollback()
+
+		_, err := s.UpdateResource(UpdateResourceParameters{ResourceID: "123456789", AppID: "admin", Hidden: &hidden})
+
+		assert.Equal(t, ErrCouldNotUpdateData, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestParseIfMatch(t *testing.T) {
+	tt := []struct {
+		Header   string
+		Expected []int
+	}{
+		{Header: "", Expected: nil},
+		{Header: "*", Expected: nil},
+		{Header: `"rev-3"`, Expected: []int{3}},
+		{Header: `"rev-3", "rev-4"`, Expected: []int{3, 4}},
+		{Header: `W/"rev-3"`, Expected: []int{}},
+		{Header: `"2cf24dba5fb0a30e"`, Expected: []int{}},
+	}
+
+	for _, tc := range tt {
+		assert.Equal(t, tc.Expected, ParseIfMatch(tc.Header), tc.Header)
+	}
+}
+
+func expectRevision(mock sqlmock.Sqlmock, revision int) {
+	mock.ExpectQuery(`^SELECT r.revision FROM resources r (.+) FOR UPDATE`).
+		WithArgs("admin", "123456789").
+		WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(revision))
+}
+
+func expectLatestVersion(mock sqlmock.Sqlmock, name, extension string, version int) {
+	mock.ExpectQuery(`^SELECT COALESCE\(MAX\(r.version\), 0\) FROM resources r (.+) r.id <> \$4`).
+		WithArgs("admin", name, extension, "123456789").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(version))
+}
+
+func TestService_ResourceTags(t *testing.T) {
+	t.Run("When resource does not exist", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.NoDownloadableResource)
+
+		_, err := s.AddResourceTags("123456", "admin", []string{"invoice"}, nil)
+
+		assert.Equal(t, ErrCouldNotFind, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Adds the tags", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789", Name: "report", Tags: []string{"q3"}},
+		})
+
+		mock.ExpectBegin()
+		expectLockedRevision(mock, 1)
+		expectTagInsert(mock, "invoice")
+		expectTagInsert(mock, "paid")
+		expectTags(mock, "invoice", "paid", "q3")
+		mock.ExpectCommit()
+
+		resource, err := s.AddResourceTags("123456789", "admin", []string{" invoice ", "paid,invoice"}, []int{1})
+
+		assert.Nil(t, err)
+		assert.Equal(t, download.Resource{ID: "123456789", Name: "report", Tags: []string{"invoice", "paid", "q3"}, Metadata: metadata.Metadata{},
+			Revision: 2}, resource)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Removes the tags", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789", Tags: []string{"invoice", "q3"}},
+		})
+
+		mock.ExpectBegin()
+		expectLockedRevision(mock, 1)
+		mock.ExpectExec(`^DELETE FROM tag_relations WHERE resource_id = \$1 AND tag = ANY\(\$2\)`).
+			WithArgs("123456789", `{"invoice","draft"}`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectTags(mock, "q3")
+		mock.ExpectCommit()
+
+		resource, err := s.RemoveResourceTags("123456789", "admin", []string{"invoice", "draft"}, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"q3"}, resource.Tags)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rejects the tags when the resource was changed since", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789", Revision: 1},
+		})
+
+		mock.ExpectBegin()
+		expectLockedRevision(mock, 2)
+		mock.ExpectRollback()
+
+		_, err := s.AddResourceTags("123456789", "admin", []string{"invoice"}, []int{1})
+
+		assert.Equal(t, ErrRevisionMismatch, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("When the resource is deleted before it is locked", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789"},
+		})
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`^SELECT revision FROM resources WHERE id = \$1 FOR UPDATE`).
+			WithArgs("123456789").
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		_, err := s.AddResourceTags("123456789", "admin", []string{"invoice"}, nil)
+
+		assert.Equal(t, ErrCouldNotFind, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rejects the tags too long", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789"},
+		})
+
+		_, err := s.AddResourceTags("123456789", "admin", []string{strings.Repeat("a", upload.MaxTagLength+1)}, nil)
+
+		assert.Equal(t, upload.ErrInvalidTag, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("When the update fails", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789"},
+		})
+
+		mock.ExpectBegin()
+		expectLockedRevision(mock, 1)
+		mock.ExpectExec(`^INSERT INTO tag_relations`).
+			WithArgs("123456789", "invoice").
+			WillReturnError(errors.New("disk full"))
+		mock.ExpectRollback()
+
+		_, err := s.AddResourceTags("123456789", "admin", []string{"invoice"}, nil)
+
+		assert.Equal(t, ErrCouldNotUpdateData, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestService_UpdateResourceMetadata(t *testing.T) {
+	t.Run("When resource does not exist", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.NoDownloadableResource)
+
+		_, err := s.UpdateResourceMetadata("123456", "admin", metadata.Metadata{"project": "apollo"}, nil)
+
+		assert.Equal(t, ErrCouldNotFind, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Merges the patch into the metadata", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789", Name: "report"},
+		})
+
+		mock.ExpectBegin()
+		expectMetadata(mock, `{"project": "apollo", "draft": true, "review": {"by": "jane", "on": "2020-03-14"}}`, 1)
+		mock.ExpectQuery(`^UPDATE resources SET metadata = \$2, revision = revision \+ 1 WHERE id = \$1 RETURNING id, name`).
+			WithArgs("123456789", `{"pages":3,"project":"apollo","review":{"by":"john","on":"2020-03-14"}}`).
+			WillReturnRows(resourceRow(download.Resource{ID: "123456789", Name: "report", Revision: 2,
+				Metadata: metadata.Metadata{"pages": float64(3), "project": "apollo", "review": map[string]interface{}{"by": "john", "on": "2020-03-14"}}}))
+		mock.ExpectCommit()
+
+		resource, err := s.UpdateResourceMetadata("123456789", "admin", metadata.Metadata{
+			"draft":  nil,
+			"pages":  float64(3),
+			"review": map[string]interface{}{"by": "john"},
+		}, []int{1})
+
+		assert.Nil(t, err)
+		assert.Equal(t, `{"pages":3,"project":"apollo","review":{"by":"john","on":"2020-03-14"}}`, encode(resource.Metadata))
+		assert.Equal(t, 2, resource.Revision)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rejects the metadata growing too large", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789"},
+		})
+
+		mock.ExpectBegin()
+		expectMetadata(mock, `{"notes": "`+strings.Repeat("a", metadata.MaxSize-100)+`"}`, 1)
+		mock.ExpectRollback()
+
+		_, err := s.UpdateResourceMetadata("123456789", "admin", metadata.Metadata{"summary": strings.Repeat("b", 100)}, nil)
+
+		assert.Equal(t, metadata.ErrMetadataTooLarge, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rejects the patch when the resource was changed since", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789", Revision: 1},
+		})
+
+		mock.ExpectBegin()
+		expectMetadata(mock, `{}`, 2)
+		mock.ExpectRollback()
+
+		_, err := s.UpdateResourceMetadata("123456789", "admin", metadata.Metadata{"project": "apollo"}, []int{1})
+
+		assert.Equal(t, ErrRevisionMismatch, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("When the resource is deleted before it is locked", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789"},
+		})
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`^SELECT metadata, revision FROM resources WHERE id = \$1 FOR UPDATE`).
+			WithArgs("123456789").
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		_, err := s.UpdateResourceMetadata("123456789", "admin", metadata.Metadata{"project": "apollo"}, nil)
+
+		assert.Equal(t, ErrCouldNotFind, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rejects the keys too long", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789"},
+		})
+
+		_, err := s.UpdateResourceMetadata("123456789", "admin", metadata.Metadata{strings.Repeat("k", metadata.MaxKeyLength+1): "v"}, nil)
+
+		assert.Equal(t, metadata.ErrInvalidMetadata, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("When the update fails", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+		s := getService(db, download.DownloadableResource{
+			Resource: download.Resource{ID: "123456789"},
+		})
+
+		mock.ExpectBegin()
+		expectMetadata(mock, `{}`, 1)
+		mock.ExpectQuery(`^UPDATE resources SET metadata`).
+			WillReturnError(errors.New("disk full"))
+		mock.ExpectRollback()
+
+		_, err := s.UpdateResourceMetadata("123456789", "admin", metadata.Metadata{"project": "apollo"}, nil)
+
+		assert.Equal(t, ErrCouldNotUpdateData, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func expectMetadata(mock sqlmock.Sqlmock, current string, revision int) {
+	mock.ExpectQuery(`^SELECT metadata, revision FROM resources WHERE id = \$1 FOR UPDATE`).
+		WithArgs("123456789").
+		WillReturnRows(sqlmock.NewRows([]string{"metadata", "revision"}).AddRow(current, revision))
+}
+
+func encode(meta metadata.Metadata) string {
+	encoded, _ := meta.Value()
+	return encoded.(string)
+}
+
+func expectTagInsert(mock sqlmock.Sqlmock, tag string) {
+	mock.ExpectExec(`^INSERT INTO tag_relations\(resource_id, tag\) values \(\$1, \$2\) ON CONFLICT DO NOTHING`).
+		WithArgs("123456789", tag).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// expectTags expects the revision of the resource to be bumped to 2 and the resource to be read back with the tags
+func expectTags(mock sqlmock.Sqlmock, tags ...string) {
+	mock.ExpectQuery(`^UPDATE resources SET revision = revision \+ 1 WHERE id = \$1 RETURNING id, name`).
+		WithArgs("123456789").
+		WillReturnRows(resourceRow(download.Resource{ID: "123456789", Name: "report", Tags: tags, Revision: 2}))
+}
+
+func expectLockedRevision(mock sqlmock.Sqlmock, revision int) {
+	mock.ExpectQuery(`^SELECT revision FROM resources WHERE id = \$1 FOR UPDATE`).
+		WithArgs("123456789").
+		WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(revision))
+}
+
+// resourceRow is the resource read back from the changed row
+func resourceRow(resource download.Resource) *sqlmock.Rows {
+	meta, _ := resource.Metadata.Value()
+	return sqlmock.NewRows([]string{"id", "name", "extension", "size", "version", "hidden", "codec", "hash", "md5", "tags", "metadata", "mime_type", "revision", "created_on"}).
+		AddRow(resource.ID, resource.Name, resource.Extension, resource.Size, resource.Version, resource.Hidden, resource.Codec, resource.Hash, resource.MD5,
+			"{"+strings.Join(resource.Tags, ",")+"}", meta, resource.MimeType, resource.Revision, resource.CreatedOn)
+}
+
 func getDbAndMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
 	db, mock, err := sqlmock.New()
 	assert.Nil(t, err)
 	return db, mock
 }
 
+func noRelease() error {
+	return nil
+}
+
+func expectLocationLock(mock sqlmock.Sqlmock, location string) {
+	mock.ExpectExec(`^SELECT pg_advisory_xact_lock`).
+		WithArgs("location:" + storage.LocalDriver + ":" + location).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func expectReferences(mock sqlmock.Sqlmock, location string, references int) {
+	mock.ExpectQuery(`^SELECT count\(\*\) FROM resource_relations`).
+		WithArgs(location, storage.LocalDriver).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(references))
+}
+
 func getService(db *sql.DB, expected download.DownloadableResource) *Service {
 	rs := mockResourceService{expected}
 	r := NewRepository(db)
-	return NewService(r, &rs)
+	drivers, _ := storage.NewRegistry(storage.LocalDriver, storage.NewLocal(tmpDir))
+	return NewService(r, &rs, drivers)
 }
 
 func createDummyFile(t *testing.T) string {
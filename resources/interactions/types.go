@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"github.com/mensurowary/juno/resources/download"
+	"github.com/mensurowary/juno/resources/storage"
 )
 
 type Repository struct {
@@ -11,8 +12,9 @@ type Repository struct {
 }
 
 type Service struct {
-	r  *Repository
-	rs resourceService
+	r       *Repository
+	rs      resourceService
+	drivers *storage.Registry
 }
 
 type resourceService interface {
@@ -24,6 +26,9 @@ var (
 	ErrCouldNotDeleteData = errors.New("could not delete the resource information from database")
 	ErrCouldNotDeleteFile = errors.New("could not delete the file")
 	ErrCouldNotFind       = errors.New("could not find the resource")
+	ErrCouldNotUpdateData = errors.New("could not update the resource information in database")
+	ErrRevisionMismatch   = errors.New("the resource was changed since the given revision")
+	ErrInvalidUpdate      = errors.New("invalid update, the name must not be empty and the mime type must be a media type")
 )
 
 // Database action errors
@@ -33,13 +38,26 @@ var (
 	ErrCouldNotExecStmt         = errors.New("could not execute the prepared statement")
 	ErrCouldNotReadRowsAffected = errors.New("could read rows affected")
 	ErrMoreThanOneRowsAffected  = errors.New("could read rows affected")
-	ErrCouldNotCommit           = errors.New("could not commit the deletion")
+	ErrCouldNotCommit           = errors.New("could not commit the changes")
 )
 
-func NewService(r *Repository, rs resourceService) *Service {
+// UpdateResourceParameters holds the changes of a resource, the nil ones are left as they are
+type UpdateResourceParameters struct {
+	ResourceID, AppID string
+	// Name and Extension are both set when the resource is renamed
+	Name, Extension *string
+	// MimeType is the media type the file is served with, empty to tell it by the extension
+	MimeType *string
+	Hidden   *bool
+	// Revisions are the revisions the resource is expected to be at, any when nil
+	Revisions []int
+}
+
+func NewService(r *Repository, rs resourceService, drivers *storage.Registry) *Service {
 	return &Service{
-		r:  r,
-		rs: rs,
+		r:       r,
+		rs:      rs,
+		drivers: drivers,
 	}
 }
 
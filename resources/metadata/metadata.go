@@ -0,0 +1,139 @@
+package metadata
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// HeaderPrefix starts the headers an upload can carry its metadata in, the rest of the header name is the key
+const HeaderPrefix = "X-Juno-Meta-"
+
+// the limits of the metadata of a resource
+const (
+	// MaxSize is the longest the JSON encoded metadata can be, in bytes
+	MaxSize = 8192
+	// MaxKeyLength is the longest top level key the metadata can have
+	MaxKeyLength = 128
+)
+
+var (
+	ErrInvalidMetadata  = errors.New("invalid metadata, must be a JSON object with keys of at most 128 characters")
+	ErrMetadataTooLarge = errors.New("metadata too large, must be at most 8192 bytes when encoded")
+)
+
+// Metadata is the user-defined JSON object of a resource, it is kept in a jsonb column
+type Metadata map[string]interface{}
+
+// Parse reads the metadata from the JSON object of the value, empty when the value is empty
+func Parse(value string) (Metadata, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var metadata Metadata
+	if err := json.Unmarshal([]byte(value), &metadata); err != nil || metadata == nil {
+		return nil, ErrInvalidMetadata
+	}
+	return metadata, metadata.Validate()
+}
+
+// FromHeaders reads the metadata from the X-Juno-Meta-* headers, the keys are lower cased and the values are strings
+func FromHeaders(header http.Header) Metadata {
+	var metadata Metadata
+	for name, values := range header {
+		if len(name) <= len(HeaderPrefix) || !strings.EqualFold(name[:len(HeaderPrefix)], HeaderPrefix) || len(values) == 0 {
+			continue
+		}
+		if metadata == nil {
+			metadata = Metadata{}
+		}
+		metadata[strings.ToLower(name[len(HeaderPrefix):])] = values[0]
+	}
+	return metadata
+}
+
+// Validate checks the keys and the encoded size of the metadata
+func (m Metadata) Validate() error {
+	for key := range m {
+		if key == "" || len(key) > MaxKeyLength {
+			return ErrInvalidMetadata
+		}
+	}
+	encoded, err := json.Marshal(m)
+	if err != nil {
+		return ErrInvalidMetadata
+	}
+	if len(encoded) > MaxSize {
+		return ErrMetadataTooLarge
+	}
+	return nil
+}
+
+// Merge applies the patch to a copy of the metadata as a JSON merge patch (RFC 7386):
+// the objects are merged recursively and the null values remove the keys
+func (m Metadata) Merge(patch Metadata) Metadata {
+	merged := Metadata{}
+	for key, value := range m {
+		merged[key] = value
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		object, isObject := asObject(value)
+		current, hasObject := asObject(merged[key])
+		if isObject && hasObject {
+			merged[key] = current.Merge(object)
+		} else if isObject {
+			// the nulls of the patch are not kept in a new object either
+			merged[key] = Metadata{}.Merge(object)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+func asObject(value interface{}) (Metadata, bool) {
+	switch object := value.(type) {
+	case Metadata:
+		return object, true
+	case map[string]interface{}:
+		return object, true
+	}
+	return nil, false
+}
+
+// Value encodes the metadata for the database, the empty metadata is an empty object
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	encoded, err := json.Marshal(m)
+	return string(encoded), err
+}
+
+// Scan decodes the metadata read from the database
+func (m *Metadata) Scan(src interface{}) error {
+	var encoded []byte
+	switch value := src.(type) {
+	case []byte:
+		encoded = value
+	case string:
+		encoded = []byte(value)
+	case nil:
+		*m = Metadata{}
+		return nil
+	default:
+		return ErrInvalidMetadata
+	}
+	metadata := Metadata{}
+	if err := json.Unmarshal(encoded, &metadata); err != nil {
+		return err
+	}
+	*m = metadata
+	return nil
+}
@@ -0,0 +1,88 @@
+package metadata
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tt := []struct {
+		Value    string
+		Expected Metadata
+		Err      error
+	}{
+		{Value: "", Expected: nil},
+		{Value: `{"project": "apollo", "pages": 3}`, Expected: Metadata{"project": "apollo", "pages": float64(3)}},
+		{Value: `["apollo"]`, Err: ErrInvalidMetadata},
+		{Value: `null`, Err: ErrInvalidMetadata},
+		{Value: `{"project": `, Err: ErrInvalidMetadata},
+		{Value: `{"": "apollo"}`, Err: ErrInvalidMetadata},
+		{Value: `{"notes": "` + strings.Repeat("a", MaxSize) + `"}`, Err: ErrMetadataTooLarge},
+	}
+
+	for _, tc := range tt {
+		metadata, err := Parse(tc.Value)
+		assert.Equal(t, tc.Err, err, tc.Value)
+		if tc.Err == nil {
+			assert.Equal(t, tc.Expected, metadata, tc.Value)
+		}
+	}
+}
+
+func TestFromHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Juno-Meta-Project", "apollo")
+	header.Set("x-juno-meta-review-by", "jane")
+	header.Set("X-Juno-Meta-", "skipped")
+	header.Set("Content-Type", "application/pdf")
+
+	assert.Equal(t, Metadata{"project": "apollo", "review-by": "jane"}, FromHeaders(header))
+	assert.Nil(t, FromHeaders(http.Header{}))
+}
+
+func TestMetadata_Merge(t *testing.T) {
+	current := Metadata{
+		"project": "apollo",
+		"draft":   true,
+		"review":  map[string]interface{}{"by": "jane", "on": "2020-03-14"},
+	}
+
+	merged := current.Merge(Metadata{
+		"draft":  nil,
+		"pages":  float64(3),
+		"review": map[string]interface{}{"by": "john", "on": nil},
+		"owner":  map[string]interface{}{"name": "jane", "team": nil},
+	})
+
+	assert.Equal(t, Metadata{
+		"project": "apollo",
+		"pages":   float64(3),
+		"review":  Metadata{"by": "john"},
+		"owner":   Metadata{"name": "jane"},
+	}, merged)
+	// the metadata merged into is left as it is
+	assert.Equal(t, true, current["draft"])
+}
+
+func TestMetadata_Scan(t *testing.T) {
+	var metadata Metadata
+	assert.Nil(t, metadata.Scan([]byte(`{"project": "apollo"}`)))
+	assert.Equal(t, Metadata{"project": "apollo"}, metadata)
+
+	assert.Nil(t, metadata.Scan(nil))
+	assert.Equal(t, Metadata{}, metadata)
+
+	assert.Equal(t, ErrInvalidMetadata, metadata.Scan(42))
+}
+
+func TestMetadata_Value(t *testing.T) {
+	value, err := Metadata(nil).Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "{}", value)
+
+	value, err = Metadata{"project": "apollo"}.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, `{"project":"apollo"}`, value)
+}
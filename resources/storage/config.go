@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"github.com/mensurowary/juno/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// FromConfig creates the drivers in the config, the new files are put to the STORAGE_DRIVER one.
+// The local driver is always there so the files stored before switching the driver stay reachable,
+// the memory one too so that its files are simply not found once the process restarts.
+func FromConfig() *Registry {
+	drivers := []Driver{NewLocal(config.Config.FileUploadDir), NewMemory()}
+	if config.Config.S3Endpoint != "" {
+		s3, err := NewS3(S3Options{
+			Endpoint:  config.Config.S3Endpoint,
+			Region:    config.Config.S3Region,
+			Bucket:    config.Config.S3Bucket,
+			Prefix:    config.Config.S3Prefix,
+			AccessKey: config.Config.S3AccessKey,
+			SecretKey: config.Config.S3SecretKey,
+			UseSSL:    config.Config.S3UseSSL,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		drivers = append(drivers, s3)
+	}
+
+	registry, err := NewRegistry(config.Config.StorageDriver, drivers...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return registry
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Local holds the files in a directory of the local disk
+type Local struct {
+	dir string
+}
+
+func NewLocal(dir string) *Local {
+	return &Local{dir: dir}
+}
+
+func (l *Local) Name() string {
+	return LocalDriver
+}
+
+// Put writes the content next to the location first, so that the readers never see a partial file
+func (l *Local) Put(location string, src io.Reader, size int64) error {
+	file, err := ioutil.TempFile(l.dir, ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := io.Copy(file, src); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), l.path(location))
+}
+
+func (l *Local) Get(location string) (io.ReadCloser, error) {
+	file, err := os.Open(l.path(location))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+func (l *Local) GetRange(location string, offset, length int64) (io.ReadCloser, error) {
+	file, err := os.Open(l.path(location))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &limitedFile{Reader: io.LimitReader(file, length), file: file}, nil
+}
+
+func (l *Local) Stat(location string) (Info, error) {
+	info, err := os.Stat(l.path(location))
+	if os.IsNotExist(err) {
+		return Info{}, ErrNotFound
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (l *Local) Delete(location string) error {
+	err := os.Remove(l.path(location))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// moveFile renames the file into the directory, which fails when they are on different devices
+func (l *Local) moveFile(path, location string) error {
+	return os.Rename(path, l.path(location))
+}
+
+func (l *Local) path(location string) string {
+	return filepath.Join(l.dir, filepath.Base(location))
+}
+
+type limitedFile struct {
+	io.Reader
+	file *os.File
+}
+
+func (l *limitedFile) Close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// Memory holds the files in the memory of the process, they are lost once it exits
+type Memory struct {
+	mu    sync.RWMutex
+	files map[string]memoryFile
+}
+
+type memoryFile struct {
+	content []byte
+	modTime time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{files: map[string]memoryFile{}}
+}
+
+func (m *Memory) Name() string {
+	return MemoryDriver
+}
+
+func (m *Memory) Put(location string, src io.Reader, size int64) error {
+	content, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[location] = memoryFile{content: content, modTime: time.Now()}
+	return nil
+}
+
+func (m *Memory) Get(location string) (io.ReadCloser, error) {
+	file, err := m.file(location)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(file.content)), nil
+}
+
+func (m *Memory) GetRange(location string, offset, length int64) (io.ReadCloser, error) {
+	file, err := m.file(location)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(len(file.content))
+	if offset > size {
+		offset = size
+	}
+	end := offset + length
+	if end > size || length < 0 {
+		end = size
+	}
+	return ioutil.NopCloser(bytes.NewReader(file.content[offset:end])), nil
+}
+
+func (m *Memory) Stat(location string) (Info, error) {
+	file, err := m.file(location)
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Size: int64(len(file.content)), ModTime: file.modTime}, nil
+}
+
+func (m *Memory) Delete(location string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[location]; !ok {
+		return ErrNotFound
+	}
+	delete(m.files, location)
+	return nil
+}
+
+// file returns the file as it is, the content is never modified in place since Put replaces it as a whole
+func (m *Memory) file(location string) (memoryFile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	file, ok := m.files[location]
+	if !ok {
+		return memoryFile{}, ErrNotFound
+	}
+	return file, nil
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"io"
+	"os"
+)
+
+// Current is the driver the new files are put to
+func (r *Registry) Current() Driver {
+	return r.current
+}
+
+// Get returns the driver recorded with a file
+func (r *Registry) Get(name string) (Driver, error) {
+	driver, ok := r.drivers[name]
+	if !ok {
+		return nil, ErrUnknownDriver
+	}
+	return driver, nil
+}
+
+// fileMover is implemented by the drivers that can take over a local file without copying it
+type fileMover interface {
+	moveFile(path, location string) error
+}
+
+// PutFile puts the local file to the location and removes it
+func PutFile(driver Driver, location, path string) error {
+	if mover, ok := driver.(fileMover); ok {
+		if err := mover.moveFile(path, location); err == nil {
+			return nil
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return driver.Put(location, file, info.Size())
+}
+
+// NewReadSeeker reads the file of the given size through the ranged gets,
+// so that only the ranges actually read are fetched from the driver
+func NewReadSeeker(driver Driver, location string, size int64) io.ReadSeekCloser {
+	return &rangeReader{driver: driver, location: location, size: size}
+}
+
+type rangeReader struct {
+	driver       Driver
+	location     string
+	size, offset int64
+	current      io.ReadCloser
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.current == nil {
+		current, err := r.driver.GetRange(r.location, r.offset, r.size-r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.current = current
+	}
+	n, err := r.current.Read(p)
+	r.offset += int64(n)
+	if err == io.EOF && r.offset < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *rangeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	if offset != r.offset {
+		_ = r.Close()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+// Close stops the ranged get in progress, if any
+func (r *rangeReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
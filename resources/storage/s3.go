@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
+	"net/http"
+	"path"
+)
+
+// S3Options are the connection details of an S3 compatible service, e.g. MinIO
+type S3Options struct {
+	Endpoint, Region, Bucket string
+	AccessKey, SecretKey     string
+	UseSSL                   bool
+	// Prefix is prepended to the locations, so that the bucket can be shared
+	Prefix string
+}
+
+// S3 holds the files as the objects of a bucket
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func NewS3(options S3Options) (*S3, error) {
+	client, err := minio.New(options.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(options.AccessKey, options.SecretKey, ""),
+		Secure: options.UseSSL,
+		Region: options.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3{client: client, bucket: options.Bucket, prefix: options.Prefix}, nil
+}
+
+func (s *S3) Name() string {
+	return S3Driver
+}
+
+func (s *S3) Put(location string, src io.Reader, size int64) error {
+	_, err := s.client.PutObject(context.Background(), s.bucket, s.key(location), src, size, minio.PutObjectOptions{})
+	return err
+}
+
+func (s *S3) Get(location string) (io.ReadCloser, error) {
+	return s.get(location, minio.GetObjectOptions{})
+}
+
+func (s *S3) GetRange(location string, offset, length int64) (io.ReadCloser, error) {
+	if length <= 0 {
+		return http.NoBody, nil
+	}
+	options := minio.GetObjectOptions{}
+	if err := options.SetRange(offset, offset+length-1); err != nil {
+		return nil, err
+	}
+	return s.get(location, options)
+}
+
+// get stats the object before handing it out, the missing objects would only fail on the first read otherwise
+func (s *S3) get(location string, options minio.GetObjectOptions) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(context.Background(), s.bucket, s.key(location), options)
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	if _, err := object.Stat(); err != nil {
+		_ = object.Close()
+		return nil, s3Error(err)
+	}
+	return object, nil
+}
+
+func (s *S3) Stat(location string) (Info, error) {
+	info, err := s.client.StatObject(context.Background(), s.bucket, s.key(location), minio.StatObjectOptions{})
+	if err != nil {
+		return Info{}, s3Error(err)
+	}
+	return Info{Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+// Delete succeeds for the missing objects too, S3 does not tell them apart
+func (s *S3) Delete(location string) error {
+	return s3Error(s.client.RemoveObject(context.Background(), s.bucket, s.key(location), minio.RemoveObjectOptions{}))
+}
+
+func (s *S3) key(location string) string {
+	return path.Join(s.prefix, location)
+}
+
+func s3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound":
+		return ErrNotFound
+	}
+	return err
+}
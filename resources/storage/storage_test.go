@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	testDriver(t, NewLocal(t.TempDir()))
+}
+
+func TestMemory(t *testing.T) {
+	testDriver(t, NewMemory())
+}
+
+// TestS3 runs against a real bucket, e.g. of a local MinIO, only when S3_TEST_ENDPOINT is set
+func TestS3(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+	driver, err := NewS3(S3Options{
+		Endpoint:  endpoint,
+		Region:    os.Getenv("S3_TEST_REGION"),
+		Bucket:    os.Getenv("S3_TEST_BUCKET"),
+		AccessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+		UseSSL:    os.Getenv("S3_TEST_USE_SSL") == "true",
+		Prefix:    "juno-test",
+	})
+	assert.Nil(t, err)
+	testDriver(t, driver)
+}
+
+// testDriver checks the behaviour every driver has to share
+func testDriver(t *testing.T, driver Driver) {
+	const content = "juno keeps the files in the drivers"
+
+	t.Run("Puts and gets the file", func(t *testing.T) {
+		assert.Nil(t, driver.Put("put.txt", strings.NewReader(content), int64(len(content))))
+		defer driver.Delete("put.txt")
+
+		assert.Equal(t, content, read(t, driver, "put.txt"))
+
+		info, err := driver.Stat("put.txt")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(len(content)), info.Size)
+		assert.False(t, info.ModTime.IsZero())
+	})
+
+	t.Run("Put replaces the existing file", func(t *testing.T) {
+		assert.Nil(t, driver.Put("replaced.txt", strings.NewReader("old"), 3))
+		assert.Nil(t, driver.Put("replaced.txt", strings.NewReader(content), int64(len(content))))
+		defer driver.Delete("replaced.txt")
+
+		assert.Equal(t, content, read(t, driver, "replaced.txt"))
+	})
+
+	t.Run("Gets a range of the file", func(t *testing.T) {
+		assert.Nil(t, driver.Put("range.txt", strings.NewReader(content), int64(len(content))))
+		defer driver.Delete("range.txt")
+
+		reader, err := driver.GetRange("range.txt", 5, 5)
+		assert.Nil(t, err)
+		defer reader.Close()
+
+		part, err := ioutil.ReadAll(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, "keeps", string(part))
+	})
+
+	t.Run("Deletes the file", func(t *testing.T) {
+		assert.Nil(t, driver.Put("deleted.txt", strings.NewReader(content), int64(len(content))))
+		assert.Nil(t, driver.Delete("deleted.txt"))
+
+		_, err := driver.Stat("deleted.txt")
+		assert.Equal(t, ErrNotFound, err)
+	})
+
+	t.Run("Not found when the file is missing", func(t *testing.T) {
+		_, err := driver.Get("missing.txt")
+		assert.Equal(t, ErrNotFound, err)
+
+		_, err = driver.GetRange("missing.txt", 0, 5)
+		assert.Equal(t, ErrNotFound, err)
+
+		_, err = driver.Stat("missing.txt")
+		assert.Equal(t, ErrNotFound, err)
+	})
+}
+
+func read(t *testing.T, driver Driver, location string) string {
+	reader, err := driver.Get(location)
+	assert.Nil(t, err)
+	if err != nil {
+		return ""
+	}
+	defer reader.Close()
+
+	content, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	return string(content)
+}
+
+func TestRegistry(t *testing.T) {
+	local := NewLocal(t.TempDir())
+
+	t.Run("Selects the current driver by name", func(t *testing.T) {
+		registry, err := NewRegistry(LocalDriver, local)
+		assert.Nil(t, err)
+		assert.Equal(t, local, registry.Current())
+
+		driver, err := registry.Get(LocalDriver)
+		assert.Nil(t, err)
+		assert.Equal(t, local, driver)
+	})
+
+	t.Run("Fails with an unknown driver", func(t *testing.T) {
+		_, err := NewRegistry(S3Driver, local)
+		assert.Equal(t, ErrUnknownDriver, err)
+
+		registry, _ := NewRegistry(LocalDriver, local)
+		_, err = registry.Get(S3Driver)
+		assert.Equal(t, ErrUnknownDriver, err)
+	})
+}
+
+func TestPutFile(t *testing.T) {
+	// the local driver moves the file while the memory one copies it
+	for _, driver := range []Driver{NewLocal(t.TempDir()), NewMemory()} {
+		t.Run("Puts and removes the file with "+driver.Name(), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "upload")
+			assert.Nil(t, ioutil.WriteFile(path, []byte("hello"), 0600))
+
+			assert.Nil(t, PutFile(driver, "stored", path))
+
+			assert.Equal(t, "hello", read(t, driver, "stored"))
+			_, err := os.Stat(path)
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+}
+
+func TestNewReadSeeker(t *testing.T) {
+	const content = "0123456789"
+	driver := NewLocal(t.TempDir())
+	assert.Nil(t, driver.Put("digits", strings.NewReader(content), int64(len(content))))
+
+	reader := NewReadSeeker(driver, "digits", int64(len(content)))
+	defer reader.Close()
+
+	t.Run("Reads from the offset sought to", func(t *testing.T) {
+		offset, err := reader.Seek(4, io.SeekStart)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(4), offset)
+
+		part := make([]byte, 3)
+		_, err = io.ReadFull(reader, part)
+		assert.Nil(t, err)
+		assert.Equal(t, "456", string(part))
+	})
+
+	t.Run("Seeks relative to the end", func(t *testing.T) {
+		_, err := reader.Seek(-2, io.SeekEnd)
+		assert.Nil(t, err)
+
+		rest, err := ioutil.ReadAll(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, "89", string(rest))
+	})
+
+	t.Run("Fails before the start", func(t *testing.T) {
+		_, err := reader.Seek(-1, io.SeekStart)
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// the names the drivers are selected with and recorded under
+const (
+	LocalDriver  = "local"
+	S3Driver     = "s3"
+	MemoryDriver = "memory"
+)
+
+var (
+	ErrNotFound      = errors.New("file could not be found in the storage")
+	ErrUnknownDriver = errors.New("unknown storage driver, must be either local, s3 or memory")
+)
+
+// Driver holds the files of the resources, the locations are the names of the files within the driver
+type Driver interface {
+	// Name is recorded with each file so that it is read from the same driver later on
+	Name() string
+	// Put stores the content under the location replacing the existing file, size is -1 when unknown
+	Put(location string, src io.Reader, size int64) error
+	Get(location string) (io.ReadCloser, error)
+	// GetRange reads length bytes starting from the offset
+	GetRange(location string, offset, length int64) (io.ReadCloser, error)
+	Stat(location string) (Info, error)
+	// Delete fails with ErrNotFound when the driver can tell the file does not exist
+	Delete(location string) error
+}
+
+// Info describes a file as it is held by the driver
+type Info struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// Registry holds the drivers by name, the new files are put to the current one
+type Registry struct {
+	current Driver
+	drivers map[string]Driver
+}
+
+func NewRegistry(current string, drivers ...Driver) (*Registry, error) {
+	registry := &Registry{drivers: map[string]Driver{}}
+	for _, driver := range drivers {
+		registry.drivers[driver.Name()] = driver
+	}
+	driver, ok := registry.drivers[current]
+	if !ok {
+		return nil, ErrUnknownDriver
+	}
+	registry.current = driver
+	return registry, nil
+}
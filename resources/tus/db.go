@@ -0,0 +1,66 @@
+package tus
+
+import (
+	"database/sql"
+	log "github.com/sirupsen/logrus"
+)
+
+func (r *Repository) createUpload(upload *Upload) error {
+	_, err := r.db.Exec(`
+		INSERT INTO uploads(id, app_id, upload_length, upload_offset, name, filename, part_location, created_on)
+		VALUES ($1, $2, $3, 0, $4, $5, $6, current_timestamp)
+	`, upload.ID, upload.AppID, upload.Length, upload.Name, upload.Filename, upload.PartLocation)
+	if err != nil {
+		log.Errorf("Could not create the upload : %v", err)
+		return ErrCouldNotPersist
+	}
+	return nil
+}
+
+func (r *Repository) findUpload(uploadID, appID string) (*Upload, error) {
+	var resourceID sql.NullString
+	upload := &Upload{}
+	row := r.db.QueryRow(`
+		SELECT id, app_id, upload_length, upload_offset, name, filename, part_location, resource_id
+		FROM uploads WHERE id = $1 AND app_id = $2
+	`, uploadID, appID)
+	err := row.Scan(&upload.ID, &upload.AppID, &upload.Length, &upload.Offset, &upload.Name, &upload.Filename, &upload.PartLocation, &resourceID)
+	if err == sql.ErrNoRows {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		log.Errorf("Could not retrieve the upload : %v", err)
+		return nil, ErrCouldNotRetrieveResult
+	}
+	upload.ResourceID = resourceID.String
+	return upload, nil
+}
+
+// updateOffset moves the offset only if no one else has moved it in the meantime
+func (r *Repository) updateOffset(uploadID string, from, to int64) error {
+	result, err := r.db.Exec(`UPDATE uploads SET upload_offset = $3 WHERE id = $1 AND upload_offset = $2`, uploadID, from, to)
+	if err != nil {
+		log.Errorf("Could not update the upload offset : %v", err)
+		return ErrCouldNotPersist
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected != 1 {
+		return ErrOffsetMismatch
+	}
+	return nil
+}
+
+func (r *Repository) setResourceID(uploadID, resourceID string) error {
+	if _, err := r.db.Exec(`UPDATE uploads SET resource_id = $2 WHERE id = $1`, uploadID, resourceID); err != nil {
+		log.Errorf("Could not set the resource of the upload : %v", err)
+		return ErrCouldNotPersist
+	}
+	return nil
+}
+
+func (r *Repository) deleteUpload(uploadID string) error {
+	if _, err := r.db.Exec(`DELETE FROM uploads WHERE id = $1`, uploadID); err != nil {
+		log.Errorf("Could not delete the upload : %v", err)
+		return ErrCouldNotPersist
+	}
+	return nil
+}
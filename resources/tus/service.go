@@ -0,0 +1,246 @@
+package tus
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/google/uuid"
+	"github.com/mensurowary/juno/config"
+	log "github.com/sirupsen/logrus"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CreateUpload creates an empty upload of the given length
+func (s *Service) CreateUpload(appID string, length int64, metadata map[string]string) (*Upload, error) {
+	if length < 0 {
+		return nil, ErrInvalidLength
+	}
+
+	id := uuid.New().String()
+	upload := &Upload{
+		ID:           id,
+		AppID:        appID,
+		Length:       length,
+		Name:         strings.TrimSpace(metadata["name"]),
+		Filename:     strings.TrimSpace(metadata["filename"]),
+		PartLocation: id + ".part",
+	}
+
+	file, err := os.Create(partPath(upload))
+	if err != nil {
+		log.Errorf("Could not create the part file of the upload : %v", err)
+		return nil, ErrCouldNotWrite
+	}
+	_ = file.Close()
+
+	if err := s.r.createUpload(upload); err != nil {
+		removePart(upload)
+		return nil, err
+	}
+
+	if length == 0 {
+		return upload, s.complete(upload)
+	}
+	return upload, nil
+}
+
+// GetUpload retrieves the upload of the application
+func (s *Service) GetUpload(uploadID, appID string) (*Upload, error) {
+	return s.r.findUpload(uploadID, appID)
+}
+
+// WriteChunk appends the chunk to the upload at the given offset, the upload is persisted as a resource once it is complete.
+// Without a checksum the bytes received before a failure are kept so the client can resume from there,
+// with a checksum the chunk is either stored as a whole or not at all.
+func (s *Service) WriteChunk(uploadID, appID string, offset int64, chunk io.Reader, checksum *Checksum) (*Upload, error) {
+	if !s.locks.tryLock(uploadID) {
+		return nil, ErrUploadLocked
+	}
+	defer s.locks.unlock(uploadID)
+
+	upload, err := s.r.findUpload(uploadID, appID)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Offset != offset {
+		return upload, ErrOffsetMismatch
+	}
+
+	written, writeErr := writePart(upload, chunk, checksum)
+	if written > 0 {
+		if err := s.r.updateOffset(upload.ID, upload.Offset, upload.Offset+written); err != nil {
+			return upload, err
+		}
+		upload.Offset += written
+	}
+	if writeErr != nil {
+		return upload, writeErr
+	}
+
+	// a completion that failed earlier is retried as well
+	if upload.Offset == upload.Length && upload.ResourceID == "" {
+		return upload, s.complete(upload)
+	}
+	return upload, nil
+}
+
+// TerminateUpload deletes the upload along with the chunks received so far
+func (s *Service) TerminateUpload(uploadID, appID string) error {
+	if !s.locks.tryLock(uploadID) {
+		return ErrUploadLocked
+	}
+	defer s.locks.unlock(uploadID)
+
+	upload, err := s.r.findUpload(uploadID, appID)
+	if err != nil {
+		return err
+	}
+	if err := s.r.deleteUpload(upload.ID); err != nil {
+		return err
+	}
+	removePart(upload)
+	return nil
+}
+
+func (s *Service) complete(upload *Upload) error {
+	filename := upload.Filename
+	if filename == "" && upload.Name == "" {
+		filename = upload.ID
+	}
+
+	resourceID, err := s.assembler.HandleAssembledUpload(partPath(upload), upload.Length, upload.AppID, url.Values{
+		"name":     {upload.Name},
+		"filename": {filename},
+	})
+	if err != nil {
+		log.Errorf("Could not complete the upload [%s] : %v", upload.ID, err)
+		return ErrCouldNotComplete
+	}
+
+	if err := s.r.setResourceID(upload.ID, resourceID); err != nil {
+		return ErrCouldNotComplete
+	}
+	upload.ResourceID = resourceID
+	return nil
+}
+
+func writePart(upload *Upload, chunk io.Reader, checksum *Checksum) (int64, error) {
+	file, err := os.OpenFile(partPath(upload), os.O_WRONLY, 0)
+	if err != nil {
+		log.Errorf("Could not open the part file of the upload [%s] : %v", upload.ID, err)
+		return 0, ErrCouldNotWrite
+	}
+	defer file.Close()
+
+	// the bytes past the offset belong to a chunk that was never acknowledged
+	if err := file.Truncate(upload.Offset); err != nil {
+		log.Errorf("Could not truncate the part file of the upload [%s] : %v", upload.ID, err)
+		return 0, ErrCouldNotWrite
+	}
+	if _, err := file.Seek(upload.Offset, io.SeekStart); err != nil {
+		return 0, ErrCouldNotWrite
+	}
+
+	var (
+		w      io.Writer = file
+		hasher hash.Hash
+	)
+	if checksum != nil {
+		hasher = checksum.hash()
+		w = io.MultiWriter(file, hasher)
+	}
+
+	written, err := io.Copy(w, io.LimitReader(chunk, upload.Length-upload.Offset))
+	if checksum != nil && (err != nil || !bytes.Equal(hasher.Sum(nil), checksum.Sum)) {
+		_ = file.Truncate(upload.Offset)
+		if err != nil {
+			log.Errorf("Could not receive the chunk of the upload [%s] : %v", upload.ID, err)
+			return 0, ErrCouldNotWrite
+		}
+		return 0, ErrChecksumMismatch
+	}
+	if err != nil {
+		log.Errorf("Could not receive the whole chunk of the upload [%s], kept %d bytes : %v", upload.ID, written, err)
+		return written, ErrCouldNotWrite
+	}
+	return written, nil
+}
+
+// ParseMetadata parses the Upload-Metadata header, a comma separated list of keys and base64 encoded values
+func ParseMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, " ", 2)
+		var value []byte
+		if len(parts) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return nil, ErrInvalidMetadata
+			}
+			value = decoded
+		}
+		metadata[parts[0]] = string(value)
+	}
+	return metadata, nil
+}
+
+// ParseChecksum parses the Upload-Checksum header, the algorithm followed by the base64 encoded checksum
+func ParseChecksum(header string) (*Checksum, error) {
+	parts := strings.SplitN(strings.TrimSpace(header), " ", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidChecksum
+	}
+
+	checksum := &Checksum{Algorithm: parts[0]}
+	if checksum.hash() == nil {
+		return nil, ErrUnsupportedChecksum
+	}
+
+	sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return nil, ErrInvalidChecksum
+	}
+	checksum.Sum = sum
+	return checksum, nil
+}
+
+func (c *Checksum) hash() hash.Hash {
+	switch c.Algorithm {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	}
+	return nil
+}
+
+func partPath(upload *Upload) string {
+	return filepath.Join(config.Config.FileUploadDir, upload.PartLocation)
+}
+
+func removePart(upload *Upload) {
+	if err := RemovePart(upload.PartLocation); err != nil {
+		log.Errorf("Could not remove the part file of the upload [%s] : %v", upload.ID, err)
+	}
+}
+
+// RemovePart removes the part file of an upload from the upload directory, the missing ones are already removed
+func RemovePart(partLocation string) error {
+	if err := os.Remove(filepath.Join(config.Config.FileUploadDir, partLocation)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
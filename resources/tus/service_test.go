@@ -0,0 +1,303 @@
+package tus
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mensurowary/juno/config"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+var uploadColumns = []string{"id", "app_id", "upload_length", "upload_offset", "name", "filename", "part_location", "resource_id"}
+
+func TestService_CreateUpload(t *testing.T) {
+	t.Run("Creates the upload with an empty part file", func(t *testing.T) {
+		useTempDir(t)
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectExec(`^INSERT INTO uploads\(id, app_id, upload_length, upload_offset, name, filename, part_location, created_on\)*`).
+			WithArgs(sqlmock.AnyArg(), "test", 11, "", "hello.txt", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+
+		upload, err := getService(db, &mockAssembler{}).CreateUpload("test", 11, map[string]string{"filename": "hello.txt"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), upload.Offset)
+		assert.Equal(t, "", readPart(t, upload))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails with a negative length", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		_, err := getService(db, &mockAssembler{}).CreateUpload("test", -1, nil)
+
+		assert.Equal(t, ErrInvalidLength, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestService_WriteChunk(t *testing.T) {
+	t.Run("Appends the chunk and moves the offset", func(t *testing.T) {
+		useTempDir(t)
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		upload := createPart(t, "first", "hello")
+		expectUpload(mock, upload, 11)
+		mock.ExpectExec(`^UPDATE uploads SET upload_offset = \$3 WHERE id = \$1 AND upload_offset = \$2`).
+			WithArgs("first", 5, 8).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+
+		result, err := getService(db, &mockAssembler{}).WriteChunk("first", "test", 5, strings.NewReader(" wo"), nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(8), result.Offset)
+		assert.Equal(t, "hello wo", readPart(t, upload))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Completes the upload once the last chunk arrives", func(t *testing.T) {
+		useTempDir(t)
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		upload := createPart(t, "last", "hello")
+		expectUpload(mock, upload, 11)
+		mock.ExpectExec(`^UPDATE uploads SET upload_offset = \$3*`).
+			WithArgs("last", 5, 11).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectExec(`^UPDATE uploads SET resource_id = \$2 WHERE id = \$1`).
+			WithArgs("last", "resource").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+
+		assembler := &mockAssembler{resourceID: "resource"}
+		result, err := getService(db, assembler).WriteChunk("last", "test", 5, strings.NewReader(" world and more"), nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "resource", result.ResourceID)
+		assert.Equal(t, "hello world", assembler.content)
+		assert.Equal(t, int64(11), assembler.size)
+		assert.Equal(t, "hello.txt", assembler.values.Get("filename"))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Verifies the checksum of the chunk", func(t *testing.T) {
+		useTempDir(t)
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		upload := createPart(t, "verified", "hello")
+		expectUpload(mock, upload, 11)
+		mock.ExpectExec(`^UPDATE uploads SET upload_offset = \$3*`).
+			WithArgs("verified", 5, 8).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+
+		_, err := getService(db, &mockAssembler{}).WriteChunk("verified", "test", 5, strings.NewReader(" wo"), sha1Checksum(" wo"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "hello wo", readPart(t, upload))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Discards the chunk when the checksum does not match", func(t *testing.T) {
+		useTempDir(t)
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		upload := createPart(t, "corrupt", "hello")
+		expectUpload(mock, upload, 11)
+
+		_, err := getService(db, &mockAssembler{}).WriteChunk("corrupt", "test", 5, strings.NewReader(" wo"), sha1Checksum(" xx"))
+
+		assert.Equal(t, ErrChecksumMismatch, err)
+		assert.Equal(t, "hello", readPart(t, upload))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Keeps the bytes received before the connection drops", func(t *testing.T) {
+		useTempDir(t)
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		upload := createPart(t, "dropped", "hello")
+		expectUpload(mock, upload, 11)
+		mock.ExpectExec(`^UPDATE uploads SET upload_offset = \$3*`).
+			WithArgs("dropped", 5, 7).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+
+		result, err := getService(db, &mockAssembler{}).WriteChunk("dropped", "test", 5, &droppingReader{data: " w"}, nil)
+
+		assert.Equal(t, ErrCouldNotWrite, err)
+		assert.Equal(t, int64(7), result.Offset)
+		assert.Equal(t, "hello w", readPart(t, upload))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails when the offset does not match", func(t *testing.T) {
+		useTempDir(t)
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		upload := createPart(t, "behind", "hello")
+		expectUpload(mock, upload, 11)
+
+		_, err := getService(db, &mockAssembler{}).WriteChunk("behind", "test", 3, strings.NewReader("lo"), nil)
+
+		assert.Equal(t, ErrOffsetMismatch, err)
+		assert.Equal(t, "hello", readPart(t, upload))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails when the upload belongs to another application", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		mock.ExpectQuery(`^SELECT id, app_id, upload_length, upload_offset, name, filename, part_location, resource_id*`).
+			WithArgs("first", "other").
+			WillReturnRows(sqlmock.NewRows(uploadColumns))
+
+		_, err := getService(db, &mockAssembler{}).WriteChunk("first", "other", 0, strings.NewReader("hello"), nil)
+
+		assert.Equal(t, ErrUploadNotFound, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestService_TerminateUpload(t *testing.T) {
+	t.Run("Deletes the upload and its part file", func(t *testing.T) {
+		useTempDir(t)
+		db, mock := getDbAndMock(t)
+		defer db.Close()
+
+		upload := createPart(t, "terminated", "hello")
+		expectUpload(mock, upload, 11)
+		mock.ExpectExec(`^DELETE FROM uploads WHERE id = \$1`).
+			WithArgs("terminated").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+
+		err := getService(db, &mockAssembler{}).TerminateUpload("terminated", "test")
+
+		assert.Nil(t, err)
+		_, statErr := os.Stat(partPath(upload))
+		assert.True(t, os.IsNotExist(statErr))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestParseMetadata(t *testing.T) {
+	t.Run("Decodes the values", func(t *testing.T) {
+		metadata, err := ParseMetadata("filename aGVsbG8udHh0, name d29ybGQ=,is_confidential")
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"filename": "hello.txt", "name": "world", "is_confidential": ""}, metadata)
+	})
+
+	t.Run("Fails when a value is not base64", func(t *testing.T) {
+		_, err := ParseMetadata("filename hello.txt")
+		assert.Equal(t, ErrInvalidMetadata, err)
+	})
+}
+
+func TestParseChecksum(t *testing.T) {
+	t.Run("Parses the algorithm and the checksum", func(t *testing.T) {
+		checksum, err := ParseChecksum("sha1 " + base64.StdEncoding.EncodeToString([]byte{1, 2, 3}))
+
+		assert.Nil(t, err)
+		assert.Equal(t, &Checksum{Algorithm: "sha1", Sum: []byte{1, 2, 3}}, checksum)
+	})
+
+	t.Run("Fails with an unsupported algorithm", func(t *testing.T) {
+		_, err := ParseChecksum("crc32 AAAA")
+		assert.Equal(t, ErrUnsupportedChecksum, err)
+	})
+
+	t.Run("Fails without the checksum", func(t *testing.T) {
+		_, err := ParseChecksum("sha1")
+		assert.Equal(t, ErrInvalidChecksum, err)
+	})
+}
+
+type mockAssembler struct {
+	resourceID string
+	content    string
+	size       int64
+	values     url.Values
+}
+
+func (m *mockAssembler) HandleAssembledUpload(path string, size int64, appID string, values url.Values) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	m.content, m.size, m.values = string(content), size, values
+	return m.resourceID, os.Remove(path)
+}
+
+// droppingReader returns its data and then fails as a dropped connection would
+type droppingReader struct {
+	data string
+	read bool
+}
+
+func (d *droppingReader) Read(p []byte) (int, error) {
+	if d.read {
+		return 0, errors.New("connection reset by peer")
+	}
+	d.read = true
+	return copy(p, d.data), nil
+}
+
+func sha1Checksum(data string) *Checksum {
+	sum := sha1.Sum([]byte(data))
+	return &Checksum{Algorithm: "sha1", Sum: sum[:]}
+}
+
+func createPart(t *testing.T, id, content string) *Upload {
+	upload := &Upload{ID: id, AppID: "test", Filename: "hello.txt", PartLocation: id + ".part", Offset: int64(len(content))}
+	assert.Nil(t, ioutil.WriteFile(partPath(upload), []byte(content), 0600))
+	return upload
+}
+
+func expectUpload(mock sqlmock.Sqlmock, upload *Upload, length int64) {
+	mock.ExpectQuery(`^SELECT id, app_id, upload_length, upload_offset, name, filename, part_location, resource_id*`).
+		WithArgs(upload.ID, upload.AppID).
+		WillReturnRows(sqlmock.NewRows(uploadColumns).
+			AddRow(upload.ID, upload.AppID, length, upload.Offset, "", upload.Filename, upload.PartLocation, nil))
+}
+
+func readPart(t *testing.T, upload *Upload) string {
+	content, err := ioutil.ReadFile(partPath(upload))
+	assert.Nil(t, err)
+	return string(content)
+}
+
+func useTempDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "juno-tus")
+	assert.Nil(t, err)
+	previous := config.Config.FileUploadDir
+	config.Config.FileUploadDir = dir
+	t.Cleanup(func() {
+		config.Config.FileUploadDir = previous
+		_ = os.RemoveAll(dir)
+	})
+}
+
+func getDbAndMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	return db, mock
+}
+
+func getService(db *sql.DB, assembler assembler) *Service {
+	return NewService(NewRepository(db), assembler)
+}
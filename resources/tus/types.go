@@ -0,0 +1,108 @@
+package tus
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"sync"
+)
+
+const (
+	// Version is the version of the tus protocol implemented
+	Version = "1.0.0"
+	// Extensions are the tus extensions supported on top of the core protocol
+	Extensions = "creation,termination,checksum"
+	// ChecksumAlgorithms are the algorithms the chunks can be verified with
+	ChecksumAlgorithms = "md5,sha1,sha256"
+)
+
+var (
+	ErrUploadNotFound         = errors.New("could not find the upload")
+	ErrOffsetMismatch         = errors.New("upload offset does not match")
+	ErrInvalidLength          = errors.New("upload length must not be negative")
+	ErrInvalidMetadata        = errors.New("malformed upload metadata")
+	ErrInvalidChecksum        = errors.New("malformed upload checksum")
+	ErrUnsupportedChecksum    = errors.New("unsupported checksum algorithm")
+	ErrChecksumMismatch       = errors.New("checksum of the chunk does not match")
+	ErrUploadLocked           = errors.New("upload is already being written to")
+	ErrCouldNotWrite          = errors.New("could not write the chunk")
+	ErrCouldNotComplete       = errors.New("upload could not be completed")
+	ErrCouldNotPersist        = errors.New("could not persist the given data to database")
+	ErrCouldNotRetrieveResult = errors.New("could not retrieve the result")
+)
+
+// Upload is a resumable upload, the chunks are appended to the part file until the offset reaches the length
+type Upload struct {
+	ID           string
+	AppID        string
+	Length       int64
+	Offset       int64
+	Name         string
+	Filename     string
+	PartLocation string
+	// ResourceID is set once the upload is completed and persisted as a resource
+	ResourceID string
+}
+
+// Checksum is the checksum of a chunk as given in the Upload-Checksum header
+type Checksum struct {
+	Algorithm string
+	Sum       []byte
+}
+
+type repository interface {
+	createUpload(upload *Upload) error
+	findUpload(uploadID, appID string) (*Upload, error)
+	updateOffset(uploadID string, from, to int64) error
+	setResourceID(uploadID, resourceID string) error
+	deleteUpload(uploadID string) error
+}
+
+// assembler persists the completed uploads the same way as the regular ones, see upload.Service
+type assembler interface {
+	HandleAssembledUpload(path string, size int64, appID string, values url.Values) (string, error)
+}
+
+type Repository struct {
+	db *sql.DB
+}
+
+type Service struct {
+	r         repository
+	assembler assembler
+	locks     *locks
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db}
+}
+
+func NewService(r repository, assembler assembler) *Service {
+	return &Service{
+		r:         r,
+		assembler: assembler,
+		locks:     &locks{held: map[string]bool{}},
+	}
+}
+
+// locks keeps the chunks of an upload from being written concurrently
+type locks struct {
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+func (l *locks) tryLock(uploadID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held[uploadID] {
+		return false
+	}
+	l.held[uploadID] = true
+	return true
+}
+
+func (l *locks) unlock(uploadID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.held, uploadID)
+}
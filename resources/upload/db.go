@@ -2,60 +2,322 @@ package upload
 
 import (
 	"database/sql"
+	"fmt"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
+	"strings"
 )
 
-func (r *Repository) saveUploadedResourceInformation(params *SaveUploadedResourceParameters) *InsertResult {
-	ID := uuid.New().String()
-	err := r.persistResourceInformation(ID, params)
-	if err != nil {
-		ID = ""
-	}
-	return &InsertResult{
-		ID:  ID,
-		Err: err,
+// saveUploadedResourceInformation persists the resource and puts its file before committing it,
+// so that no resource is committed without its file
+func (r *Repository) saveUploadedResourceInformation(params *SaveUploadedResourceParameters, files storedFiles) *InsertResult {
+	result := &InsertResult{}
+	placed := false
+	result.Err = r.withTx(func(tx *sql.Tx) error {
+		saved, err := r.saveResource(tx, params)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		if err := files.put(params); err != nil {
+			_ = tx.Rollback()
+			return errCouldNotPlace
+		}
+		placed = true
+
+		if err := tx.Commit(); err != nil {
+			log.Infof("Could not commit! : %v", err)
+			return errCouldNotPersist
+		}
+		log.Info("Successfully inserted the data")
+		result = saved
+		return nil
+	})
+	if result.Err != nil && placed {
+		r.releasePlaced(files, params)
 	}
+	return result
 }
 
-func (r *Repository) withTx(action func(tx *sql.Tx) error) error {
-	tx, err := r.db.Begin()
+// saveUploadedResourcesInformation persists all the resources in a single transaction, their files are put before
+// committing them. The result of the resource that failed it holds the error.
+func (r *Repository) saveUploadedResourcesInformation(params []*SaveUploadedResourceParameters, files storedFiles) ([]*InsertResult, error) {
+	results := make([]*InsertResult, len(params))
+	var placed []*SaveUploadedResourceParameters
+	err := r.withTx(func(tx *sql.Tx) error {
+		for i, p := range params {
+			saved, err := r.saveResource(tx, p)
+			if err != nil {
+				_ = tx.Rollback()
+				results[i] = &InsertResult{Err: err}
+				return err
+			}
+			results[i] = saved
+		}
+
+		for i, p := range params {
+			if err := files.put(p); err != nil {
+				_ = tx.Rollback()
+				results[i] = &InsertResult{Err: errCouldNotPlace}
+				return errCouldNotPlace
+			}
+			placed = append(placed, p)
+		}
+
+		if err := tx.Commit(); err != nil {
+			log.Infof("Could not commit! : %v", err)
+			return errCouldNotPersist
+		}
+		log.Infof("Successfully inserted the data of %d resources", len(params))
+		return nil
+	})
 	if err != nil {
-		log.Errorf("Could not start the transaction : %v", err)
-		return errCouldNotPersist
+		r.releasePlaced(files, placed...)
+		return results, err
+	}
+	return results, nil
+}
+
+// releasePlaced removes the files put for the resources that were rolled back, unless other resources are stored in them
+func (r *Repository) releasePlaced(files storedFiles, placed ...*SaveUploadedResourceParameters) {
+	for _, p := range placed {
+		p := p
+		if err := r.releaseLocation(p.Storage, p.UploadDestination, func() error {
+			return files.remove(p.Storage, p.UploadDestination)
+		}); err != nil {
+			log.Errorf("Could not release the file %s of the %s storage : %v", p.UploadDestination, p.Storage, err)
+		}
 	}
-	return action(tx)
 }
 
-func (r *Repository) persistResourceInformation(ID string, params *SaveUploadedResourceParameters) error {
+// releaseLocation removes the stored file unless resources are stored in it. The references are counted under
+// the lock of the location, so that a file referenced by a resource persisted meanwhile is kept.
+func (r *Repository) releaseLocation(storage, location string, remove func() error) error {
 	return r.withTx(func(tx *sql.Tx) error {
-		if err := r.saveUploadedResourceInfo(tx, ID, params); err != nil {
+		if err := LockLocation(tx, storage, location); err != nil {
+			_ = tx.Rollback()
 			return err
 		}
-
-		if err := r.persistResourceRelations(tx, ID, params); err != nil {
+		references, err := CountReferences(tx, storage, location)
+		if err != nil {
+			_ = tx.Rollback()
 			return err
 		}
-
+		if references == 0 {
+			if err := remove(); err != nil {
+				_ = tx.Rollback()
+				return err
+			}
+		}
 		if err := tx.Commit(); err != nil {
-			log.Infof("Could not commit! : %v", err)
 			return errCouldNotPersist
 		}
-		log.Info("Successfully inserted the data")
 		return nil
 	})
 }
 
+// saveResource persists the resource, the duplicate strategy decides what happens when the application
+// already owns a resource with the same name and extension
+func (r *Repository) saveResource(tx *sql.Tx, params *SaveUploadedResourceParameters) (*InsertResult, error) {
+	if err := LockName(tx, params.AppID, params.FileName, params.FileExtension); err != nil {
+		return nil, err
+	}
+	if err := LockLocation(tx, params.Storage, params.UploadDestination); err != nil {
+		return nil, err
+	}
+
+	existing, err := findLatestResource(tx, params.AppID, params.FileName, params.FileExtension)
+	if err != nil {
+		return nil, err
+	}
+
+	params.Version = 1
+	if existing != nil {
+		switch params.DuplicateStrategy {
+		case DuplicateReject:
+			_ = tx.Rollback()
+			return nil, ErrDuplicateResource
+		case DuplicateOverwrite:
+			return r.overwriteResource(tx, existing, params)
+		case DuplicateRename:
+			if params.FileName, err = freeName(tx, params.AppID, params.FileName, params.FileExtension); err != nil {
+				return nil, err
+			}
+			if err := LockName(tx, params.AppID, params.FileName, params.FileExtension); err != nil {
+				return nil, err
+			}
+		default:
+			params.Version = existing.Version + 1
+		}
+	}
+
+	ID := uuid.New().String()
+	if err := r.saveUploadedResourceInfo(tx, ID, params); err != nil {
+		return nil, err
+	}
+	if err := r.persistResourceRelations(tx, ID, params); err != nil {
+		return nil, err
+	}
+	if err := AddTags(tx, ID, params.Tags); err != nil {
+		return nil, err
+	}
+	return &InsertResult{ID: ID}, nil
+}
+
+// LockLocation serializes the changes of the references to the stored file until the end of the transaction.
+// The file is removed only while holding the lock, once no resource is stored in it, so that a file is never
+// removed while a new reference to it is being persisted.
+func LockLocation(tx *sql.Tx, storage, location string) error {
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, "location:"+storage+":"+location); err != nil {
+		log.Errorf("Could not lock the stored file : %v", err)
+		return errCouldNotPersist
+	}
+	return nil
+}
+
+// CountReferences returns how many resources are stored in the file held by the storage driver
+func CountReferences(tx *sql.Tx, storage, location string) (int, error) {
+	var count int
+	if err := tx.QueryRow(`SELECT count(*) FROM resource_relations WHERE saved_location = $1 AND storage = $2`, location, storage).Scan(&count); err != nil {
+		log.Errorf("Could not count the references to the stored file : %v", err)
+		return 0, errCouldNotPersist
+	}
+	return count, nil
+}
+
+// AddTags tags the resource, the tags it already has are skipped
+func AddTags(tx *sql.Tx, resourceID string, tags []string) error {
+	for _, tag := range tags {
+		if _, err := tx.Exec(`INSERT INTO tag_relations(resource_id, tag) values ($1, $2) ON CONFLICT DO NOTHING`, resourceID, tag); err != nil {
+			log.Errorf("Could not tag the resource : %v", err)
+			return errCouldNotPersist
+		}
+	}
+	return nil
+}
+
+// LockName serializes the uploads and the renames to the same name of an application until the end of the transaction
+func LockName(tx *sql.Tx, appID, name, extension string) error {
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, appID+"/"+name+"."+extension); err != nil {
+		log.Errorf("Could not lock the resource name : %v", err)
+		return errCouldNotPersist
+	}
+	return nil
+}
+
+// findLatestResource returns the latest version of the resource with the given name, if any
+func findLatestResource(tx *sql.Tx, appID, name, extension string) (*existingResource, error) {
+	row := tx.QueryRow(`SELECT r.id, r.version, rr.saved_location, rr.storage FROM resources r JOIN resource_relations rr ON r.id = rr.resource_id
+		WHERE rr.app_id = $1 AND r.name = $2 AND r.extension = $3 ORDER BY r.version DESC LIMIT 1`, appID, name, extension)
+
+	existing := &existingResource{}
+	if err := row.Scan(&existing.ID, &existing.Version, &existing.SavedLocation, &existing.Storage); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Errorf("Could not look for the existing resource : %v", err)
+		return nil, errCouldNotPersist
+	}
+	return existing, nil
+}
+
+// freeName returns the first of "name (1)", "name (2)", ... the application does not own yet
+func freeName(tx *sql.Tx, appID, name, extension string) (string, error) {
+	rows, err := tx.Query(`SELECT r.name FROM resources r JOIN resource_relations rr ON r.id = rr.resource_id
+		WHERE rr.app_id = $1 AND r.extension = $2 AND r.name LIKE $3`, appID, extension, escapeLike(name)+" (%)")
+	if err != nil {
+		log.Errorf("Could not look for the taken names : %v", err)
+		return "", errCouldNotPersist
+	}
+	defer rows.Close()
+
+	taken := map[string]bool{}
+	for rows.Next() {
+		var existing string
+		if err := rows.Scan(&existing); err != nil {
+			log.Errorf("Could not read the taken names : %v", err)
+			return "", errCouldNotPersist
+		}
+		taken[existing] = true
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Could not read the taken names : %v", err)
+		return "", errCouldNotPersist
+	}
+
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)", name, i)
+		if !taken[candidate] {
+			return candidate, nil
+		}
+	}
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// overwriteResource points the existing resource to the new file, its id stays the same.
+// The replaced file is returned for removal unless other resources are stored in it.
+func (r *Repository) overwriteResource(tx *sql.Tx, existing *existingResource, params *SaveUploadedResourceParameters) (*InsertResult, error) {
+	if err := LockLocation(tx, existing.Storage, existing.SavedLocation); err != nil {
+		return nil, err
+	}
+
+	// the metadata of the resource is kept unless the upload carries some
+	var replacedMetadata interface{}
+	if len(params.Metadata) > 0 {
+		replacedMetadata = params.Metadata
+	}
+	if err := execute(tx,
+		`UPDATE resources SET size = $2, codec = $3, hash = $4, md5 = $5, metadata = COALESCE($6, metadata), revision = revision + 1, created_on = current_timestamp WHERE id = $1`,
+		existing.ID, params.FileSize, params.Codec, params.Hash, params.MD5, replacedMetadata); err != nil {
+		return nil, err
+	}
+	if err := execute(tx,
+		`UPDATE resource_relations SET saved_location = $2, storage = $3 WHERE resource_id = $1`,
+		existing.ID, params.UploadDestination, params.Storage); err != nil {
+		return nil, err
+	}
+
+	// the tags of the upload are added to the ones the resource already has
+	if err := AddTags(tx, existing.ID, params.Tags); err != nil {
+		return nil, err
+	}
+
+	references, err := CountReferences(tx, existing.Storage, existing.SavedLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &InsertResult{ID: existing.ID}
+	if references == 0 {
+		result.ReplacedLocation = existing.SavedLocation
+		result.ReplacedStorage = existing.Storage
+	}
+	return result, nil
+}
+
+func (r *Repository) withTx(action func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		log.Errorf("Could not start the transaction : %v", err)
+		return errCouldNotPersist
+	}
+	return action(tx)
+}
+
 func (r *Repository) saveUploadedResourceInfo(tx *sql.Tx, ID string, params *SaveUploadedResourceParameters) error {
 	return execute(tx,
-		`INSERT INTO resources(id, name, extension, size, created_on) values ($1, $2, $3, $4, current_timestamp)`,
-		ID, params.FileName, params.FileExtension, params.FileSize)
+		`INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, current_timestamp)`,
+		ID, params.FileName, params.FileExtension, params.FileSize, params.Version, params.Hidden, params.Codec, params.Hash, params.MD5, params.Metadata)
 }
 
 func (r *Repository) persistResourceRelations(tx *sql.Tx, resourceID string, params *SaveUploadedResourceParameters) error {
 	return execute(tx,
-		`INSERT INTO resource_relations(app_id, resource_id, saved_location) values ($1, $2, $3)`,
-		params.AppID, resourceID, params.UploadDestination)
+		`INSERT INTO resource_relations(app_id, resource_id, saved_location, storage) values ($1, $2, $3, $4)`,
+		params.AppID, resourceID, params.UploadDestination, params.Storage)
 
 }
 
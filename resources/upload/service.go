@@ -1,52 +1,306 @@
 package upload
 
 import (
-	"fmt"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"github.com/google/uuid"
 	"github.com/mensurowary/juno/config"
+	"github.com/mensurowary/juno/resources/compression"
+	"github.com/mensurowary/juno/resources/metadata"
+	"github.com/mensurowary/juno/resources/storage"
 	log "github.com/sirupsen/logrus"
-	"mime/multipart"
+	"io"
 	"net/url"
+	"os"
 	"path/filepath"
 	"strings"
 )
 
-func (s *Service) HandleUpload(writer FileWriter, fileHeader *multipart.FileHeader, appID string, values url.Values) (string, error) {
-	parameters := makeFileUploadParams(fileHeader, values, appID)
-	return s.upload(writer, fileHeader, &parameters)
+// HandleUpload streams the content to the disk and persists it, the name and the extension are taken
+// from the filename unless the name value is given
+func (s *Service) HandleUpload(writer FileWriter, src io.Reader, filename string, appID string, values url.Values) (string, error) {
+	parameters, err := makeFileUploadParams(filename, values, appID)
+	if err != nil {
+		return EmptyID, err
+	}
+	save := func(dst string, digest io.Writer) (int64, error) {
+		return saveEncoded(writer, io.TeeReader(src, digest), dst, parameters.Codec)
+	}
+	return s.upload(save, &parameters)
+}
+
+// HandleAssembledUpload persists a file that is already on the disk, e.g. the one assembled from the chunks of a resumable upload.
+// The file is moved to its destination, the name is taken from the filename value unless the name value is given.
+func (s *Service) HandleAssembledUpload(path string, size int64, appID string, values url.Values) (string, error) {
+	parameters, err := makeFileUploadParams(strings.TrimSpace(values.Get("filename")), values, appID)
+	if err != nil {
+		return EmptyID, err
+	}
+	// the assembled file is moved as it is
+	parameters.Codec = compression.None
+	save := func(dst string, digest io.Writer) (int64, error) {
+		if err := hashFile(path, digest); err != nil {
+			return 0, err
+		}
+		return size, os.Rename(path, dst)
+	}
+	return s.upload(save, &parameters)
 }
 
-func (s *Service) upload(writer FileWriter, file *multipart.FileHeader, params *FileUploadParameters) (string, error) {
-	uploadDestination := uploadDestination(params)
+// HandleUploads uploads many files at once, the mode value picks between the best effort (default)
+// and the all or nothing semantics. The name and the checksum values are ignored, each file is named after its filename.
+func (s *Service) HandleUploads(writer FileWriter, parts []Part, appID string, values url.Values) ([]PartResult, error) {
+	mode := strings.TrimSpace(values.Get("mode"))
+	if mode == "" {
+		mode = ModeBestEffort
+	}
+	if mode != ModeBestEffort && mode != ModeAllOrNothing {
+		return nil, ErrUnknownUploadMode
+	}
+
+	values = copyValues(values)
+	values.Del("name")
+	values.Del("checksum")
+
+	results := make([]PartResult, len(parts))
+	for i, part := range parts {
+		results[i].Filename = part.Filename
+	}
+
+	if mode == ModeBestEffort {
+		for i, part := range parts {
+			params, err := makeFileUploadParams(part.Filename, values, appID)
+			if err != nil {
+				return nil, err
+			}
+			stored, err := s.storePart(writer, part, &params)
+			if err != nil {
+				results[i].Error = PartNotUploaded
+				continue
+			}
+			if results[i].FileID, err = s.persist(stored); err == ErrDuplicateResource {
+				results[i].Error = PartDuplicate
+			} else if err != nil {
+				results[i].Error = PartNotPersisted
+			}
+		}
+		return results, nil
+	}
+
+	var stored []*SaveUploadedResourceParameters
+	for i, part := range parts {
+		params, err := makeFileUploadParams(part.Filename, values, appID)
+		if err != nil {
+			return nil, err
+		}
+		file, err := s.storePart(writer, part, &params)
+		if err != nil {
+			discard(stored...)
+			for j := range results {
+				results[j].Error = PartRolledBack
+			}
+			results[i].Error = PartNotUploaded
+			return results, nil
+		}
+		stored = append(stored, file)
+	}
+
+	saved, err := s.r.saveUploadedResourcesInformation(stored, s.storedFiles())
+	if err != nil {
+		discard(stored...)
+		for i := range results {
+			switch {
+			case err != ErrDuplicateResource:
+				results[i].Error = PartNotPersisted
+			case saved[i] != nil && saved[i].Err == ErrDuplicateResource:
+				results[i].Error = PartDuplicate
+			default:
+				results[i].Error = PartRolledBack
+			}
+		}
+		return results, nil
+	}
+	for i, result := range saved {
+		results[i].FileID = result.ID
+		s.removeReplaced(result)
+	}
+	return results, nil
+}
 
-	err := writer.SaveFileTo(file, uploadDestination)
+func (s *Service) upload(save func(dst string, digest io.Writer) (int64, error), params *FileUploadParameters) (string, error) {
+	stored, err := s.store(save, params)
+	if err != nil {
+		return EmptyID, err
+	}
+	return s.persist(stored)
+}
 
+// store saves the file under a temporary name while hashing its content and returns what is to be persisted about it,
+// the file is moved to the location addressed by its content once persisted
+func (s *Service) store(save func(dst string, digest io.Writer) (int64, error), params *FileUploadParameters) (*SaveUploadedResourceParameters, error) {
+	temporary := temporaryDestination()
+	sha256Digest, md5Digest := sha256.New(), md5.New()
+	size, err := save(temporary, io.MultiWriter(sha256Digest, md5Digest))
 	if err != nil {
 		log.Error("Error occurred while uploading the file", params, err)
-		return EmptyID, ErrFileCouldNotBeUploaded
+		return nil, ErrFileCouldNotBeUploaded
 	}
 
-	log.Infof("Uploaded to %s", uploadDestination)
+	log.Infof("Uploaded to %s", temporary)
 
-	uploadDestination = getFilename(uploadDestination)
+	sums := map[string][]byte{SHA256: sha256Digest.Sum(nil), MD5: md5Digest.Sum(nil)}
+	for _, checksum := range params.Checksums {
+		if !bytes.Equal(sums[checksum.Algorithm], checksum.Sum) {
+			log.Errorf("The %s checksum of the upload %s does not match", checksum.Algorithm, temporary)
+			removeFile(getFilename(temporary))
+			return nil, ErrChecksumMismatch
+		}
+	}
 
-	res := s.r.saveUploadedResourceInformation(&SaveUploadedResourceParameters{
+	hash := hex.EncodeToString(sums[SHA256])
+	return &SaveUploadedResourceParameters{
 		FileName:          params.Name,
-		FileSize:          file.Size,
+		FileSize:          size,
 		FileExtension:     params.Extension,
-		UploadDestination: uploadDestination,
+		UploadDestination: contentLocation(hash, params.Codec),
+		TemporaryLocation: getFilename(temporary),
+		Hash:              hash,
+		MD5:               hex.EncodeToString(sums[MD5]),
 		AppID:             params.AppID,
-	})
+		DuplicateStrategy: params.DuplicateStrategy,
+		Hidden:            params.Hidden,
+		Codec:             params.Codec,
+		Storage:           s.drivers.Current().Name(),
+		Tags:              params.Tags,
+		Metadata:          params.Metadata,
+	}, nil
+}
 
-	if res.Err == errCouldNotPersist {
+func (s *Service) storePart(writer FileWriter, part Part, params *FileUploadParameters) (*SaveUploadedResourceParameters, error) {
+	src, err := part.Open()
+	if err != nil {
+		log.Errorf("Could not open the uploaded file %s : %v", part.Filename, err)
+		return nil, ErrFileCouldNotBeUploaded
+	}
+	defer src.Close()
+
+	return s.store(func(dst string, digest io.Writer) (int64, error) {
+		return saveEncoded(writer, io.TeeReader(src, digest), dst, params.Codec)
+	}, params)
+}
+
+// saveEncoded saves the content compressed with the codec, if any, and returns its uncompressed size
+func saveEncoded(writer FileWriter, src io.Reader, dst string, codec string) (int64, error) {
+	if codec == compression.None {
+		return writer.SaveFileTo(src, dst)
+	}
+
+	counter := &countingReader{r: src}
+	encoded := compression.Encode(codec, counter)
+	defer encoded.Close()
+
+	if _, err := writer.SaveFileTo(encoded, dst); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (s *Service) persist(stored *SaveUploadedResourceParameters) (string, error) {
+	res := s.r.saveUploadedResourceInformation(stored, s.storedFiles())
+	if res.Err != nil {
+		discard(stored)
+		if res.Err == ErrDuplicateResource {
+			return EmptyID, ErrDuplicateResource
+		}
 		return EmptyID, ErrFileCouldNotBeUploaded
 	}
+	s.removeReplaced(res)
 	return res.ID, nil
 }
 
+func (s *Service) storedFiles() storedFiles {
+	return storedFiles{put: s.put, remove: s.remove}
+}
+
+// put moves the received upload to the location addressed by its content, a file already
+// stored there has the very same content so it is simply replaced
+func (s *Service) put(stored *SaveUploadedResourceParameters) error {
+	temporary := filepath.Join(config.Config.FileUploadDir, stored.TemporaryLocation)
+	driver, err := s.drivers.Get(stored.Storage)
+	if err == nil {
+		err = storage.PutFile(driver, stored.UploadDestination, temporary)
+	}
+	if err != nil {
+		log.Errorf("Could not put the file %s to %s of the %s storage : %v", temporary, stored.UploadDestination, stored.Storage, err)
+	}
+	return err
+}
+
+// remove deletes the stored file, the missing ones are already removed
+func (s *Service) remove(storageName, location string) error {
+	driver, err := s.drivers.Get(storageName)
+	if err == nil {
+		err = driver.Delete(location)
+	}
+	if err != nil && err != storage.ErrNotFound {
+		log.Errorf("Could not remove the file %s of the %s storage : %v", location, storageName, err)
+		return err
+	}
+	return nil
+}
+
+// discard removes the files of the uploads that could not be persisted
+func discard(stored ...*SaveUploadedResourceParameters) {
+	for _, file := range stored {
+		removeFile(file.TemporaryLocation)
+	}
+}
+
+// removeReplaced removes the file of the overwritten resource, if any
+func (s *Service) removeReplaced(result *InsertResult) {
+	if result.ReplacedLocation == "" {
+		return
+	}
+	// the references are counted again, an upload of the same content may have been committed since
+	if err := s.r.releaseLocation(result.ReplacedStorage, result.ReplacedLocation, func() error {
+		return s.remove(result.ReplacedStorage, result.ReplacedLocation)
+	}); err != nil {
+		log.Errorf("Could not release the replaced file %s of the %s storage : %v", result.ReplacedLocation, result.ReplacedStorage, err)
+	}
+}
+
+// removeFile removes a file received into the upload directory
+func removeFile(location string) {
+	path := filepath.Join(config.Config.FileUploadDir, location)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Errorf("Could not remove the file %s : %v", path, err)
+	}
+}
+
+func copyValues(values url.Values) url.Values {
+	result := url.Values{}
+	for key, value := range values {
+		result[key] = append([]string(nil), value...)
+	}
+	return result
+}
+
 func getFilename(uploadDestination string) string {
-	start := len(config.Config.FileUploadDir) + 1
-	return uploadDestination[start:]
+	return filepath.Base(uploadDestination)
 }
 
 func fileExtension(uploadDestination string) string {
@@ -57,31 +311,180 @@ func fileExtension(uploadDestination string) string {
 	return ext
 }
 
-func makeFileUploadParams(fileHeader *multipart.FileHeader, values url.Values, appID string) FileUploadParameters {
+func makeFileUploadParams(filename string, values url.Values, appID string) (FileUploadParameters, error) {
+	strategy, err := duplicateStrategy(values)
+	if err != nil {
+		return FileUploadParameters{}, err
+	}
+
+	codec, err := compression.Parse(values.Get("compress"), config.Config.CompressionCodec)
+	if err != nil {
+		return FileUploadParameters{}, err
+	}
+
+	checksums, err := parseChecksums(values["checksum"])
+	if err != nil {
+		return FileUploadParameters{}, err
+	}
+
+	tags, err := ParseTags(values["tags"])
+	if err != nil {
+		return FileUploadParameters{}, err
+	}
+
+	meta, err := metadata.Parse(values.Get("metadata"))
+	if err != nil {
+		return FileUploadParameters{}, err
+	}
+
 	name := strings.TrimSpace(values.Get("name"))
 
-	ext := fileExtension(fileHeader.Filename)
+	ext := fileExtension(filename)
 	if ext == "" {
 		ext = fileExtension(name)
 	}
 
 	if name == "" {
-		filename := fileHeader.Filename
-		name = filename[:len(filename)-len(ext)-1]
+		name = strings.TrimSuffix(filename, "."+ext)
 	}
 
 	return FileUploadParameters{
-		Name:      name,
-		Extension: ext,
-		AppID:     appID,
+		Name:              name,
+		Extension:         ext,
+		DuplicateStrategy: strategy,
+		Hidden:            strings.ToLower(strings.TrimSpace(values.Get("hidden"))) == "true",
+		Codec:             codec,
+		AppID:             appID,
+		Checksums:         checksums,
+		Tags:              tags,
+		Metadata:          meta,
+	}, nil
+}
+
+// ParseTags reads the tags from the values, each one may hold many of them separated by commas.
+// The tags are trimmed, the empty and the repeated ones are skipped.
+func ParseTags(values []string) ([]string, error) {
+	var tags []string
+	seen := map[string]bool{}
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "" || seen[tag] {
+				continue
+			}
+			if len(tag) > MaxTagLength {
+				return nil, ErrInvalidTag
+			}
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
 	}
+	return tags, nil
 }
 
-func uploadDestination(params *FileUploadParameters) string {
-	ext := params.Extension
-	if ext != "" {
-		ext = "." + ext
+// parseChecksums reads the checksum values, each one is the algorithm and the hex encoded digest separated by a colon
+func parseChecksums(values []string) ([]Checksum, error) {
+	var checksums []Checksum
+	for _, value := range values {
+		parts := strings.SplitN(strings.TrimSpace(value), ":", 2)
+		if len(parts) != 2 {
+			return nil, ErrInvalidChecksum
+		}
+		sum, err := hex.DecodeString(parts[1])
+		if err != nil {
+			return nil, ErrInvalidChecksum
+		}
+		checksum, err := newChecksum(parts[0], sum)
+		if err != nil {
+			return nil, err
+		}
+		checksums = append(checksums, checksum)
+	}
+	return checksums, nil
+}
+
+// ParseContentMD5 parses the Content-MD5 header, the base64 encoded MD5 of the content
+func ParseContentMD5(header string) (Checksum, error) {
+	sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header))
+	if err != nil {
+		return Checksum{}, ErrInvalidChecksum
+	}
+	return newChecksum(MD5, sum)
+}
+
+// ParseDigest parses the Digest and the Repr-Digest headers, the comma separated algorithm=digest pairs
+// with the base64 digest wrapped in colons in the latter. The algorithms other than md5 and sha-256 are skipped.
+func ParseDigest(header string) ([]Checksum, error) {
+	var checksums []Checksum
+	for _, item := range strings.Split(header, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(parts) != 2 {
+			return nil, ErrInvalidChecksum
+		}
+		algorithm := strings.ReplaceAll(strings.ToLower(parts[0]), "-", "")
+		if algorithm != MD5 && algorithm != SHA256 {
+			continue
+		}
+		sum, err := base64.StdEncoding.DecodeString(strings.Trim(parts[1], ":"))
+		if err != nil {
+			return nil, ErrInvalidChecksum
+		}
+		checksum, err := newChecksum(algorithm, sum)
+		if err != nil {
+			return nil, err
+		}
+		checksums = append(checksums, checksum)
+	}
+	return checksums, nil
+}
+
+func newChecksum(algorithm string, sum []byte) (Checksum, error) {
+	algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+	switch {
+	case algorithm == MD5 && len(sum) == md5.Size, algorithm == SHA256 && len(sum) == sha256.Size:
+		return Checksum{Algorithm: algorithm, Sum: sum}, nil
 	}
-	uploadDestination := filepath.Join(config.Config.FileUploadDir, params.Name)
-	return fmt.Sprintf("%s-%s%s", uploadDestination, uuid.New().String(), ext)
+	return Checksum{}, ErrInvalidChecksum
+}
+
+// String formats the checksum the way the checksum value is given
+func (c Checksum) String() string {
+	return c.Algorithm + ":" + hex.EncodeToString(c.Sum)
+}
+
+// duplicateStrategy reads the duplicate value, new versions are created unless stated otherwise
+func duplicateStrategy(values url.Values) (int, error) {
+	value := strings.TrimSpace(values.Get("duplicate"))
+	if value == "" {
+		return DuplicateVersion, nil
+	}
+	strategy, ok := duplicateStrategies[value]
+	if !ok {
+		return 0, ErrUnknownDuplicateStrategy
+	}
+	return strategy, nil
+}
+
+// temporaryDestination is where the upload is received until it is persisted
+func temporaryDestination() string {
+	return filepath.Join(config.Config.FileUploadDir, uuid.New().String()+".upload")
+}
+
+// contentLocation is the file name of the content with the given hash, the codec tells apart the compressed copies
+func contentLocation(hash, codec string) string {
+	if codec == compression.None {
+		return hash
+	}
+	return hash + "." + codec
+}
+
+func hashFile(path string, digest io.Writer) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(digest, file)
+	return err
 }
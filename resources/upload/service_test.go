@@ -1,29 +1,56 @@
 package upload
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mensurowary/juno/config"
+	"github.com/mensurowary/juno/resources/compression"
+	"github.com/mensurowary/juno/resources/metadata"
+	"github.com/mensurowary/juno/resources/storage"
 	"github.com/stretchr/testify/assert"
-	"mime/multipart"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "juno-upload")
+	if err != nil {
+		panic(err)
+	}
+	config.Config.FileUploadDir = dir
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// helloHash and helloMD5 are the SHA-256 and the MD5 of "hello"
+const (
+	helloHash = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	helloMD5  = "5d41402abc4b2a76b9719d911017c592"
+)
+
 func TestService_HandleUpload(t *testing.T) {
 	t.Run("Error occurred while uploading the file", func(t *testing.T) {
 		db, _ := getDbAndMock(t)
-		s := NewService(db)
+		s := getService(db)
 
 		writer := &mockFileWriter{
 			err: errors.New("failure"),
 		}
-		header := &multipart.FileHeader{}
 		appId := "app_id"
 		values := map[string][]string{
 			"name": {"hello"},
 		}
 
-		resourceID, err := s.HandleUpload(writer, header, appId, values)
+		resourceID, err := s.HandleUpload(writer, strings.NewReader(""), "", appId, values)
 
 		assert.Equal(t, EmptyID, resourceID)
 		assert.Equal(t, ErrFileCouldNotBeUploaded, err)
@@ -31,51 +58,176 @@ func TestService_HandleUpload(t *testing.T) {
 
 	t.Run("Upload successful", func(t *testing.T) {
 		db, mock := getDbAndMock(t)
-		s := NewService(db)
+		s := getService(db)
 
 		mock.ExpectBegin()
-		mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, created_on)*").
-			ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456).
+		expectNoDuplicate(mock)
+		mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+			ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456, 1, false, "", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
 			WillReturnResult(sqlmock.NewResult(-1, 1))
 
-		mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location)*").
-			ExpectExec().WithArgs("app_id", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location, storage)*").
+			ExpectExec().WithArgs("app_id", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
 			WillReturnResult(sqlmock.NewResult(-1, 1))
 
 		mock.ExpectCommit()
 
 		writer := &mockFileWriter{}
-		header := &multipart.FileHeader{
-			Size:     123456,
-			Filename: "hello.pdf",
-		}
+		content := bytes.NewReader(make([]byte, 123456))
 		appId := "app_id"
 		values := map[string][]string{}
 
-		resourceID, err := s.HandleUpload(writer, header, appId, values)
+		resourceID, err := s.HandleUpload(writer, content, "hello.pdf", appId, values)
 
 		assert.NotEmpty(t, resourceID)
 		assert.Nil(t, err)
 		assert.Nil(t, mock.ExpectationsWereMet())
 	})
 
+	t.Run("Upload marked hidden", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		mock.ExpectBegin()
+		expectNoDuplicate(mock)
+		mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+			ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 5, 1, true, "", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location, storage)*").
+			ExpectExec().WithArgs("app_id", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectCommit()
+
+		resourceID, err := s.HandleUpload(&mockFileWriter{}, strings.NewReader("hello"), "hello.pdf", "app_id",
+			url.Values{"hidden": {"true"}})
+
+		assert.NotEmpty(t, resourceID)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Upload tagged", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		mock.ExpectBegin()
+		expectNoDuplicate(mock)
+		mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+			ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 5, 1, false, "", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location, storage)*").
+			ExpectExec().WithArgs("app_id", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		for _, tag := range []string{"invoice", "paid"} {
+			mock.ExpectExec(`^INSERT INTO tag_relations`).
+				WithArgs(sqlmock.AnyArg(), tag).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectCommit()
+
+		resourceID, err := s.HandleUpload(&mockFileWriter{}, strings.NewReader("hello"), "hello.pdf", "app_id",
+			url.Values{"tags": {"invoice, paid", "invoice"}})
+
+		assert.NotEmpty(t, resourceID)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Upload with a tag too long", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		_, err := s.HandleUpload(&mockFileWriter{}, strings.NewReader("hello"), "hello.pdf", "app_id",
+			url.Values{"tags": {strings.Repeat("a", MaxTagLength+1)}})
+
+		assert.Equal(t, ErrInvalidTag, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Upload with metadata", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		mock.ExpectBegin()
+		expectNoDuplicate(mock)
+		mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+			ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 5, 1, false, "", sqlmock.AnyArg(), sqlmock.AnyArg(), `{"pages":3,"project":"apollo"}`).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location, storage)*").
+			ExpectExec().WithArgs("app_id", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectCommit()
+
+		resourceID, err := s.HandleUpload(&mockFileWriter{}, strings.NewReader("hello"), "hello.pdf", "app_id",
+			url.Values{"metadata": {`{"project": "apollo", "pages": 3}`}})
+
+		assert.NotEmpty(t, resourceID)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Upload with malformed metadata", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		_, err := s.HandleUpload(&mockFileWriter{}, strings.NewReader("hello"), "hello.pdf", "app_id",
+			url.Values{"metadata": {`["apollo"]`}})
+
+		assert.Equal(t, metadata.ErrInvalidMetadata, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Upload compressed records the codec and the uncompressed size", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		mock.ExpectBegin()
+		expectNoDuplicate(mock)
+		mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+			ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "txt", 5000, 1, false, "zstd", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location, storage)*").
+			ExpectExec().WithArgs("app_id", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectCommit()
+
+		writer := &mockFileWriter{}
+		resourceID, err := s.HandleUpload(writer, strings.NewReader(strings.Repeat("hello", 1000)), "hello.txt", "app_id",
+			url.Values{"compress": {"zstd"}})
+
+		assert.NotEmpty(t, resourceID)
+		assert.Nil(t, err)
+		assert.Less(t, writer.written, int64(5000))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails with an unknown compression codec", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		resourceID, err := s.HandleUpload(&mockFileWriter{}, strings.NewReader("hello"), "hello.txt", "app_id",
+			url.Values{"compress": {"brotli"}})
+
+		assert.Equal(t, EmptyID, resourceID)
+		assert.Equal(t, compression.ErrUnknownCodec, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
 	t.Run("When saving upload information fails return error", func(t *testing.T) {
 		db, mock := getDbAndMock(t)
-		s := NewService(db)
+		s := getService(db)
 
 		mock.ExpectBegin()
-		mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, created_on)*").
+		expectNoDuplicate(mock)
+		mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
 			WillReturnError(errors.New("a random error"))
 
 		writer := &mockFileWriter{}
-		header := &multipart.FileHeader{
-			Size:     123456,
-			Filename: "hello.pdf",
-		}
+		content := bytes.NewReader(make([]byte, 123456))
 		appId := "app_id"
 		values := map[string][]string{}
 
-		resourceID, err := s.HandleUpload(writer, header, appId, values)
+		resourceID, err := s.HandleUpload(writer, content, "hello.pdf", appId, values)
 
 		assert.Empty(t, resourceID)
 		assert.Equal(t, ErrFileCouldNotBeUploaded, err)
@@ -83,18 +235,273 @@ func TestService_HandleUpload(t *testing.T) {
 	})
 }
 
+func TestService_HandleUploads(t *testing.T) {
+	parts := []Part{part("first.txt", "hello"), part("second.txt", "world")}
+
+	t.Run("Best effort persists the files that could be uploaded", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		mock.ExpectBegin()
+		expectNoDuplicate(mock)
+		mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+			ExpectExec().WithArgs(sqlmock.AnyArg(), "first", "txt", 5, 1, false, "", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location, storage)*").
+			ExpectExec().WithArgs("app_id", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectCommit()
+
+		results, err := s.HandleUploads(&mockFileWriter{failOn: "world"}, parts, "app_id", url.Values{"name": {"ignored"}})
+
+		assert.Nil(t, err)
+		assert.NotEmpty(t, results[0].FileID)
+		assert.Empty(t, results[0].Error)
+		assert.Equal(t, PartResult{Filename: "second.txt", Error: PartNotUploaded}, results[1])
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("All or nothing persists nothing when a file fails", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		results, err := s.HandleUploads(&mockFileWriter{failOn: "world"}, parts, "app_id", url.Values{"mode": {ModeAllOrNothing}})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []PartResult{
+			{Filename: "first.txt", Error: PartRolledBack},
+			{Filename: "second.txt", Error: PartNotUploaded},
+		}, results)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("All or nothing persists the files in a single transaction", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		mock.ExpectBegin()
+		for _, name := range []string{"first", "second"} {
+			expectNoDuplicate(mock)
+			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+				ExpectExec().WithArgs(sqlmock.AnyArg(), name, "txt", 5, 1, false, "", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
+				WillReturnResult(sqlmock.NewResult(-1, 1))
+			mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location, storage)*").
+				ExpectExec().WithArgs("app_id", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(-1, 1))
+		}
+		mock.ExpectCommit()
+
+		results, err := s.HandleUploads(&mockFileWriter{}, parts, "app_id", url.Values{"mode": {ModeAllOrNothing}})
+
+		assert.Nil(t, err)
+		assert.NotEmpty(t, results[0].FileID)
+		assert.NotEmpty(t, results[1].FileID)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("All or nothing reports every file when the transaction fails", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		mock.ExpectBegin()
+		expectNoDuplicate(mock)
+		mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+			ExpectExec().WithArgs(sqlmock.AnyArg(), "first", "txt", 5, 1, false, "", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
+			WillReturnError(errors.New("disk full"))
+		mock.ExpectRollback()
+
+		results, err := s.HandleUploads(&mockFileWriter{}, parts, "app_id", url.Values{"mode": {ModeAllOrNothing}})
+
+		assert.Nil(t, err)
+		assert.Equal(t, PartNotPersisted, results[0].Error)
+		assert.Equal(t, PartNotPersisted, results[1].Error)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails with an unknown mode", func(t *testing.T) {
+		db, _ := getDbAndMock(t)
+
+		_, err := getService(db).HandleUploads(&mockFileWriter{}, parts, "app_id", url.Values{"mode": {"some"}})
+
+		assert.Equal(t, ErrUnknownUploadMode, err)
+	})
+}
+
+func part(filename, content string) Part {
+	return Part{
+		Filename: filename,
+		Open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader(content)), nil
+		},
+	}
+}
+
+func TestContentLocation(t *testing.T) {
+	t.Run("Is the hash of the content", func(t *testing.T) {
+		assert.Equal(t, helloHash, contentLocation(helloHash, compression.None))
+	})
+
+	t.Run("Tells apart the compressed copies", func(t *testing.T) {
+		assert.Equal(t, helloHash+".zstd", contentLocation(helloHash, compression.Zstd))
+	})
+
+	t.Run("Receives the uploads within the upload directory", func(t *testing.T) {
+		defer func(dir string) { config.Config.FileUploadDir = dir }(config.Config.FileUploadDir)
+		config.Config.FileUploadDir = "uploads"
+
+		assert.Equal(t, "uploads", filepath.Dir(temporaryDestination()))
+	})
+}
+
+func TestService_Checksums(t *testing.T) {
+	t.Run("Stores the digests of the upload matching its checksums", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		mock.ExpectBegin()
+		expectNoDuplicate(mock)
+		mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+			ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "txt", 5, 1, false, "", helloHash, helloMD5, "{}").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location, storage)*").
+			ExpectExec().WithArgs("app_id", sqlmock.AnyArg(), helloHash, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectCommit()
+
+		resourceID, err := s.HandleUpload(&mockFileWriter{}, strings.NewReader("hello"), "hello.txt", "app_id",
+			url.Values{"checksum": {"sha256:" + helloHash, "MD5:" + strings.ToUpper(helloMD5)}})
+
+		assert.NotEmpty(t, resourceID)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rejects the upload not matching its checksum", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		resourceID, err := s.HandleUpload(&mockFileWriter{}, strings.NewReader("hullo"), "hello.txt", "app_id",
+			url.Values{"checksum": {"md5:" + helloMD5}})
+
+		assert.Equal(t, EmptyID, resourceID)
+		assert.Equal(t, ErrChecksumMismatch, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Fails with a malformed checksum", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		for _, checksum := range []string{helloMD5, "md5:xyz", "sha256:" + helloMD5, "crc32:3610a686"} {
+			_, err := s.HandleUpload(&mockFileWriter{}, strings.NewReader("hello"), "hello.txt", "app_id",
+				url.Values{"checksum": {checksum}})
+
+			assert.Equal(t, ErrInvalidChecksum, err, checksum)
+		}
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestParseTags(t *testing.T) {
+	tt := []struct {
+		Values   []string
+		Expected []string
+		Err      error
+	}{
+		{Values: nil, Expected: nil},
+		{Values: []string{" , "}, Expected: nil},
+		{Values: []string{"invoice, paid", "q3,invoice"}, Expected: []string{"invoice", "paid", "q3"}},
+		{Values: []string{"Invoice", "invoice"}, Expected: []string{"Invoice", "invoice"}},
+		{Values: []string{strings.Repeat("a", MaxTagLength)}, Expected: []string{strings.Repeat("a", MaxTagLength)}},
+		{Values: []string{strings.Repeat("a", MaxTagLength+1)}, Err: ErrInvalidTag},
+	}
+
+	for _, tc := range tt {
+		tags, err := ParseTags(tc.Values)
+		assert.Equal(t, tc.Expected, tags, tc.Values)
+		assert.Equal(t, tc.Err, err, tc.Values)
+	}
+}
+
+func TestParseDigest(t *testing.T) {
+	sha256Sum, _ := hex.DecodeString(helloHash)
+	md5Sum, _ := hex.DecodeString(helloMD5)
+
+	t.Run("Parses the Digest header", func(t *testing.T) {
+		checksums, err := ParseDigest("SHA-256=LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=, MD5=XUFAKrxLKna5cZ2REBfFkg==")
+
+		assert.Nil(t, err)
+		assert.Equal(t, []Checksum{{Algorithm: SHA256, Sum: sha256Sum}, {Algorithm: MD5, Sum: md5Sum}}, checksums)
+	})
+
+	t.Run("Parses the Repr-Digest header skipping the unsupported algorithms", func(t *testing.T) {
+		checksums, err := ParseDigest("sha-512=:AAAA:, sha-256=:LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=:")
+
+		assert.Nil(t, err)
+		assert.Equal(t, []Checksum{{Algorithm: SHA256, Sum: sha256Sum}}, checksums)
+	})
+
+	t.Run("Fails with a malformed digest", func(t *testing.T) {
+		_, err := ParseDigest("sha-256=:not base64:")
+
+		assert.Equal(t, ErrInvalidChecksum, err)
+	})
+
+	t.Run("Parses the Content-MD5 header", func(t *testing.T) {
+		checksum, err := ParseContentMD5("XUFAKrxLKna5cZ2REBfFkg==")
+
+		assert.Nil(t, err)
+		assert.Equal(t, Checksum{Algorithm: MD5, Sum: md5Sum}, checksum)
+		assert.Equal(t, "md5:"+helloMD5, checksum.String())
+	})
+}
+
+func TestService_HandleAssembledUpload(t *testing.T) {
+	t.Run("Moves the assembled file and persists it", func(t *testing.T) {
+		dir := useUploadDir(t)
+
+		part := filepath.Join(dir, "abc.part")
+		assert.Nil(t, ioutil.WriteFile(part, []byte("hello"), 0600))
+
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		mock.ExpectBegin()
+		expectNoDuplicate(mock)
+		mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+			ExpectExec().WithArgs(sqlmock.AnyArg(), "report", "txt", 5, 1, false, "", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location, storage)*").
+			ExpectExec().WithArgs("app_id", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectCommit()
+
+		resourceID, err := s.HandleAssembledUpload(part, 5, "app_id", url.Values{"filename": {"report.txt"}})
+
+		assert.Nil(t, err)
+		assert.NotEmpty(t, resourceID)
+		_, statErr := os.Stat(part)
+		assert.True(t, os.IsNotExist(statErr))
+		content, err := ioutil.ReadFile(filepath.Join(dir, helloHash))
+		assert.Nil(t, err)
+		assert.Equal(t, "hello", string(content))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
 func TestRepository_saveUploadedResourceInformation(t *testing.T) {
 	t.Run("Successfully persists the uploaded resource data", func(t *testing.T) {
 		db, mock := getDbAndMock(t)
 		r := &Repository{db}
 
 		mock.ExpectBegin()
-		mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, created_on)*").
-			ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456).
+		expectNoDuplicate(mock)
+		mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+			ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456, 1, false, "", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
 			WillReturnResult(sqlmock.NewResult(-1, 1))
 
-		mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location)*").
-			ExpectExec().WithArgs("admin", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location, storage)*").
+			ExpectExec().WithArgs("admin", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
 			WillReturnResult(sqlmock.NewResult(-1, 1))
 
 		mock.ExpectCommit()
@@ -107,7 +514,7 @@ func TestRepository_saveUploadedResourceInformation(t *testing.T) {
 			UploadDestination: "src/hello.pdf",
 		}
 
-		result := r.saveUploadedResourceInformation(params)
+		result := r.saveUploadedResourceInformation(params, noFiles)
 
 		assert.NotEmpty(t, result.ID)
 		assert.Nil(t, result.Err)
@@ -117,12 +524,13 @@ func TestRepository_saveUploadedResourceInformation(t *testing.T) {
 	t.Run("Committing fails when persisting the uploaded resource data", func(t *testing.T) {
 		runAndExpect(t, func(mock sqlmock.Sqlmock) {
 			mock.ExpectBegin()
-			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, created_on)*").
-				ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456).
+			expectNoDuplicate(mock)
+			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+				ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456, 1, false, "", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
 				WillReturnResult(sqlmock.NewResult(-1, 1))
 
-			mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location)*").
-				ExpectExec().WithArgs("admin", sqlmock.AnyArg(), sqlmock.AnyArg()).
+			mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location, storage)*").
+				ExpectExec().WithArgs("admin", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
 				WillReturnResult(sqlmock.NewResult(-1, 1))
 
 			mock.ExpectCommit().WillReturnError(errors.New("commit failure due to ninja turtles"))
@@ -132,8 +540,9 @@ func TestRepository_saveUploadedResourceInformation(t *testing.T) {
 	t.Run("More than one row of uploaded resource info saved should rollback", func(t *testing.T) {
 		runAndExpect(t, func(mock sqlmock.Sqlmock) {
 			mock.ExpectBegin()
-			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, created_on)*").
-				ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456).
+			expectNoDuplicate(mock)
+			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+				ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456, 1, false, "", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
 				WillReturnResult(sqlmock.NewResult(-1, 2))
 
 			mock.ExpectRollback()
@@ -143,8 +552,9 @@ func TestRepository_saveUploadedResourceInformation(t *testing.T) {
 	t.Run("More than one row of uploaded resource info saved should rollback and rollback fails", func(t *testing.T) {
 		runAndExpect(t, func(mock sqlmock.Sqlmock) {
 			mock.ExpectBegin()
-			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, created_on)*").
-				ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456).
+			expectNoDuplicate(mock)
+			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+				ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456, 1, false, "", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
 				WillReturnResult(sqlmock.NewResult(-1, 2))
 
 			mock.ExpectRollback().WillReturnError(errors.New("rollback failed"))
@@ -154,12 +564,13 @@ func TestRepository_saveUploadedResourceInformation(t *testing.T) {
 	t.Run("More than one row of uploaded resource relations info saved should rollback", func(t *testing.T) {
 		runAndExpect(t, func(mock sqlmock.Sqlmock) {
 			mock.ExpectBegin()
-			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, created_on)*").
-				ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456).
+			expectNoDuplicate(mock)
+			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+				ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456, 1, false, "", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
 				WillReturnResult(sqlmock.NewResult(-1, 1))
 
-			mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location)*").
-				ExpectExec().WithArgs("admin", sqlmock.AnyArg(), sqlmock.AnyArg()).
+			mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location, storage)*").
+				ExpectExec().WithArgs("admin", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
 				WillReturnResult(sqlmock.NewResult(-1, 2))
 
 			mock.ExpectRollback()
@@ -169,12 +580,13 @@ func TestRepository_saveUploadedResourceInformation(t *testing.T) {
 	t.Run("More than one row of uploaded resource relations info saved should rollback and rollback fails", func(t *testing.T) {
 		runAndExpect(t, func(mock sqlmock.Sqlmock) {
 			mock.ExpectBegin()
-			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, created_on)*").
-				ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456).
+			expectNoDuplicate(mock)
+			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+				ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456, 1, false, "", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
 				WillReturnResult(sqlmock.NewResult(-1, 1))
 
-			mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location)*").
-				ExpectExec().WithArgs("admin", sqlmock.AnyArg(), sqlmock.AnyArg()).
+			mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location, storage)*").
+				ExpectExec().WithArgs("admin", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
 				WillReturnResult(sqlmock.NewResult(-1, 2))
 
 			mock.ExpectRollback().WillReturnError(errors.New("rollback failed"))
@@ -184,11 +596,12 @@ func TestRepository_saveUploadedResourceInformation(t *testing.T) {
 	t.Run("Executing the resource relations insert fails", func(t *testing.T) {
 		runAndExpect(t, func(mock sqlmock.Sqlmock) {
 			mock.ExpectBegin()
-			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, created_on)*").
-				ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456).
+			expectNoDuplicate(mock)
+			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+				ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456, 1, false, "", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
 				WillReturnResult(sqlmock.NewResult(-1, 1))
 
-			mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location)*").
+			mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location, storage)*").
 				ExpectExec().WillReturnError(errors.New("exec could not be performed"))
 		})
 	})
@@ -196,11 +609,12 @@ func TestRepository_saveUploadedResourceInformation(t *testing.T) {
 	t.Run("Preparing the resource relations insert statement fails", func(t *testing.T) {
 		runAndExpect(t, func(mock sqlmock.Sqlmock) {
 			mock.ExpectBegin()
-			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, created_on)*").
-				ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456).
+			expectNoDuplicate(mock)
+			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
+				ExpectExec().WithArgs(sqlmock.AnyArg(), "hello", "pdf", 123456, 1, false, "", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
 				WillReturnResult(sqlmock.NewResult(-1, 1))
 
-			mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location)*").
+			mock.ExpectPrepare("^INSERT INTO resource_relations(app_id, resource_id, saved_location, storage)*").
 				WillReturnError(errors.New("prep init failed"))
 		})
 	})
@@ -208,7 +622,8 @@ func TestRepository_saveUploadedResourceInformation(t *testing.T) {
 	t.Run("Executing the upload resource insert fails", func(t *testing.T) {
 		runAndExpect(t, func(mock sqlmock.Sqlmock) {
 			mock.ExpectBegin()
-			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, created_on)*").
+			expectNoDuplicate(mock)
+			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
 				ExpectExec().WillReturnError(errors.New("exec could not be performed"))
 		})
 	})
@@ -216,7 +631,8 @@ func TestRepository_saveUploadedResourceInformation(t *testing.T) {
 	t.Run("Preparing the upload resource info insert statement fails", func(t *testing.T) {
 		runAndExpect(t, func(mock sqlmock.Sqlmock) {
 			mock.ExpectBegin()
-			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, created_on)*").
+			expectNoDuplicate(mock)
+			mock.ExpectPrepare("^INSERT INTO resources(id, name, extension, size, version, hidden, codec, hash, md5, metadata, created_on)*").
 				WillReturnError(errors.New("prep init failed"))
 		})
 	})
@@ -228,12 +644,373 @@ func TestRepository_saveUploadedResourceInformation(t *testing.T) {
 	})
 }
 
+func TestRepository_duplicateStrategies(t *testing.T) {
+	params := func(strategy int) *SaveUploadedResourceParameters {
+		return &SaveUploadedResourceParameters{
+			FileName:          "report",
+			FileExtension:     "pdf",
+			FileSize:          5,
+			AppID:             "admin",
+			UploadDestination: "report-new.pdf",
+			Storage:           storage.LocalDriver,
+			DuplicateStrategy: strategy,
+		}
+	}
+
+	t.Run("Version stores the upload as the next version", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		r := &Repository{db}
+
+		mock.ExpectBegin()
+		expectExisting(mock, "old-id", 2, "report-old.pdf")
+		mock.ExpectPrepare("^INSERT INTO resources*").
+			ExpectExec().WithArgs(sqlmock.AnyArg(), "report", "pdf", 5, 3, false, "", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectPrepare("^INSERT INTO resource_relations*").
+			ExpectExec().WithArgs("admin", sqlmock.AnyArg(), "report-new.pdf", storage.LocalDriver).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectCommit()
+
+		result := r.saveUploadedResourceInformation(params(DuplicateVersion), noFiles)
+
+		assert.Nil(t, result.Err)
+		assert.NotEqual(t, "old-id", result.ID)
+		assert.Empty(t, result.ReplacedLocation)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Reject rolls back", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		r := &Repository{db}
+
+		mock.ExpectBegin()
+		expectExisting(mock, "old-id", 1, "report-old.pdf")
+		mock.ExpectRollback()
+
+		result := r.saveUploadedResourceInformation(params(DuplicateReject), noFiles)
+
+		assert.Equal(t, ErrDuplicateResource, result.Err)
+		assert.Empty(t, result.ID)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Overwrite keeps the id and returns the replaced file", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		r := &Repository{db}
+
+		mock.ExpectBegin()
+		expectExisting(mock, "old-id", 1, "report-old.pdf")
+		expectOverwrite(mock, 0)
+		mock.ExpectCommit()
+
+		result := r.saveUploadedResourceInformation(params(DuplicateOverwrite), noFiles)
+
+		assert.Nil(t, result.Err)
+		assert.Equal(t, "old-id", result.ID)
+		assert.Equal(t, "report-old.pdf", result.ReplacedLocation)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Overwrite keeps the replaced file that other resources are stored in", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		r := &Repository{db}
+
+		mock.ExpectBegin()
+		expectExisting(mock, "old-id", 1, "report-old.pdf")
+		expectOverwrite(mock, 2)
+		mock.ExpectCommit()
+
+		result := r.saveUploadedResourceInformation(params(DuplicateOverwrite), noFiles)
+
+		assert.Nil(t, result.Err)
+		assert.Equal(t, "old-id", result.ID)
+		assert.Empty(t, result.ReplacedLocation)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rename picks the first free suffix", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		r := &Repository{db}
+
+		mock.ExpectBegin()
+		expectExisting(mock, "old-id", 1, "report-old.pdf")
+		mock.ExpectQuery(`^SELECT r.name FROM resources r`).
+			WithArgs("admin", "pdf", "report (%)").
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("report (1)").AddRow("report (3)"))
+		mock.ExpectExec(`^SELECT pg_advisory_xact_lock`).
+			WithArgs("admin/report (2).pdf").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectPrepare("^INSERT INTO resources*").
+			ExpectExec().WithArgs(sqlmock.AnyArg(), "report (2)", "pdf", 5, 1, false, "", sqlmock.AnyArg(), sqlmock.AnyArg(), "{}").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectPrepare("^INSERT INTO resource_relations*").
+			ExpectExec().WithArgs("admin", sqlmock.AnyArg(), "report-new.pdf", storage.LocalDriver).
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectCommit()
+
+		result := r.saveUploadedResourceInformation(params(DuplicateRename), noFiles)
+
+		assert.Nil(t, result.Err)
+		assert.NotEqual(t, "old-id", result.ID)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestService_DuplicateUploads(t *testing.T) {
+	t.Run("Fails with an unknown duplicate strategy", func(t *testing.T) {
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		resourceID, err := s.HandleUpload(&mockFileWriter{}, strings.NewReader("hello"), "report.pdf", "admin",
+			url.Values{"duplicate": {"ignore"}})
+
+		assert.Equal(t, EmptyID, resourceID)
+		assert.Equal(t, ErrUnknownDuplicateStrategy, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Overwriting removes the replaced file", func(t *testing.T) {
+		dir := useUploadDir(t)
+
+		old := filepath.Join(dir, "report-old.pdf")
+		assert.Nil(t, ioutil.WriteFile(old, []byte("old"), 0600))
+		part := filepath.Join(dir, "abc.part")
+		assert.Nil(t, ioutil.WriteFile(part, []byte("hello"), 0600))
+
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		mock.ExpectBegin()
+		expectExisting(mock, "old-id", 1, "report-old.pdf")
+		mock.ExpectExec(`^SELECT pg_advisory_xact_lock`).
+			WithArgs("location:local:report-old.pdf").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectPrepare(`^UPDATE resources SET size = \$2`).
+			ExpectExec().WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectPrepare(`^UPDATE resource_relations SET saved_location = \$2`).
+			ExpectExec().WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectQuery(`^SELECT count\(\*\) FROM resource_relations WHERE saved_location = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectCommit()
+		expectRelease(mock, "report-old.pdf", 0)
+
+		resourceID, err := s.HandleAssembledUpload(part, 5, "admin", url.Values{
+			"filename":  {"report.pdf"},
+			"duplicate": {"overwrite"},
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "old-id", resourceID)
+		_, statErr := os.Stat(old)
+		assert.True(t, os.IsNotExist(statErr))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Overwriting keeps the replaced file referenced meanwhile", func(t *testing.T) {
+		dir := useUploadDir(t)
+
+		old := filepath.Join(dir, "report-old.pdf")
+		assert.Nil(t, ioutil.WriteFile(old, []byte("old"), 0600))
+		part := filepath.Join(dir, "abc.part")
+		assert.Nil(t, ioutil.WriteFile(part, []byte("hello"), 0600))
+
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		mock.ExpectBegin()
+		expectExisting(mock, "old-id", 1, "report-old.pdf")
+		mock.ExpectExec(`^SELECT pg_advisory_xact_lock`).
+			WithArgs("location:local:report-old.pdf").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectPrepare(`^UPDATE resources SET size = \$2`).
+			ExpectExec().WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectPrepare(`^UPDATE resource_relations SET saved_location = \$2`).
+			ExpectExec().WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectQuery(`^SELECT count\(\*\) FROM resource_relations WHERE saved_location = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectCommit()
+		expectRelease(mock, "report-old.pdf", 1)
+
+		resourceID, err := s.HandleAssembledUpload(part, 5, "admin", url.Values{
+			"filename":  {"report.pdf"},
+			"duplicate": {"overwrite"},
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "old-id", resourceID)
+		_, statErr := os.Stat(old)
+		assert.Nil(t, statErr)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("A failed put keeps the overwritten resource and its file", func(t *testing.T) {
+		dir := useUploadDir(t)
+
+		old := filepath.Join(dir, "report-old.pdf")
+		assert.Nil(t, ioutil.WriteFile(old, []byte("old"), 0600))
+		part := filepath.Join(dir, "abc.part")
+		assert.Nil(t, ioutil.WriteFile(part, []byte("hello"), 0600))
+
+		db, mock := getDbAndMock(t)
+		drivers, _ := storage.NewRegistry(storage.MemoryDriver, failingDriver{storage.NewMemory()}, storage.NewLocal(dir))
+		s := NewService(db, drivers)
+
+		mock.ExpectBegin()
+		expectExisting(mock, "old-id", 1, "report-old.pdf")
+		mock.ExpectExec(`^SELECT pg_advisory_xact_lock`).
+			WithArgs("location:local:report-old.pdf").
+			WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectPrepare(`^UPDATE resources SET size = \$2`).
+			ExpectExec().WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectPrepare(`^UPDATE resource_relations SET saved_location = \$2`).
+			ExpectExec().WillReturnResult(sqlmock.NewResult(-1, 1))
+		mock.ExpectQuery(`^SELECT count\(\*\) FROM resource_relations WHERE saved_location = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectRollback()
+
+		resourceID, err := s.HandleAssembledUpload(part, 5, "admin", url.Values{
+			"filename":  {"report.pdf"},
+			"duplicate": {"overwrite"},
+		})
+
+		assert.Equal(t, EmptyID, resourceID)
+		assert.Equal(t, ErrFileCouldNotBeUploaded, err)
+		content, readErr := ioutil.ReadFile(old)
+		assert.Nil(t, readErr)
+		assert.Equal(t, "old", string(content))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rejecting removes the uploaded file", func(t *testing.T) {
+		dir := useUploadDir(t)
+
+		part := filepath.Join(dir, "abc.part")
+		assert.Nil(t, ioutil.WriteFile(part, []byte("hello"), 0600))
+
+		db, mock := getDbAndMock(t)
+		s := getService(db)
+
+		mock.ExpectBegin()
+		expectExisting(mock, "old-id", 1, "report-old.pdf")
+		mock.ExpectRollback()
+
+		resourceID, err := s.HandleAssembledUpload(part, 5, "admin", url.Values{
+			"filename":  {"report.pdf"},
+			"duplicate": {"reject"},
+		})
+
+		assert.Equal(t, EmptyID, resourceID)
+		assert.Equal(t, ErrDuplicateResource, err)
+		files, _ := ioutil.ReadDir(dir)
+		assert.Empty(t, files)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+// mockFileWriter discards the content, failing when it contains failOn
 type mockFileWriter struct {
-	err error
+	err     error
+	failOn  string
+	written int64
+}
+
+func (m *mockFileWriter) SaveFileTo(src io.Reader, dst string) (int64, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	content, err := ioutil.ReadAll(src)
+	if err != nil {
+		return 0, err
+	}
+	if m.failOn != "" && strings.Contains(string(content), m.failOn) {
+		return 0, errors.New("failure")
+	}
+	if err := ioutil.WriteFile(dst, content, 0600); err != nil {
+		return 0, err
+	}
+	m.written += int64(len(content))
+	return int64(len(content)), nil
+}
+
+// failingDriver cannot put any file
+type failingDriver struct {
+	*storage.Memory
+}
+
+func (failingDriver) Put(string, io.Reader, int64) error {
+	return errors.New("failure")
+}
+
+// expectNoDuplicate expects the name and the location to be locked and looked up without finding any resource
+func expectNoDuplicate(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`^SELECT pg_advisory_xact_lock`).
+		WillReturnResult(sqlmock.NewResult(-1, 1))
+	mock.ExpectExec(`^SELECT pg_advisory_xact_lock`).
+		WillReturnResult(sqlmock.NewResult(-1, 1))
+	mock.ExpectQuery(`^SELECT r.id, r.version, rr.saved_location, rr.storage FROM resources r`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version", "saved_location", "storage"}))
+}
+
+// expectExisting expects the name and the location to be locked and looked up, finding the given resource
+func expectExisting(mock sqlmock.Sqlmock, ID string, version int, savedLocation string) {
+	mock.ExpectExec(`^SELECT pg_advisory_xact_lock`).
+		WithArgs("admin/report.pdf").
+		WillReturnResult(sqlmock.NewResult(-1, 1))
+	mock.ExpectExec(`^SELECT pg_advisory_xact_lock`).
+		WillReturnResult(sqlmock.NewResult(-1, 1))
+	mock.ExpectQuery(`^SELECT r.id, r.version, rr.saved_location, rr.storage FROM resources r`).
+		WithArgs("admin", "report", "pdf").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version", "saved_location", "storage"}).AddRow(ID, version, savedLocation, storage.LocalDriver))
+}
+
+// expectOverwrite expects the existing resource to be pointed to the new file, the replaced one has the given references left
+func expectOverwrite(mock sqlmock.Sqlmock, references int) {
+	mock.ExpectExec(`^SELECT pg_advisory_xact_lock`).
+		WithArgs("location:local:report-old.pdf").
+		WillReturnResult(sqlmock.NewResult(-1, 1))
+	mock.ExpectPrepare(`^UPDATE resources SET size = \$2`).
+		ExpectExec().WithArgs("old-id", 5, "", sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(-1, 1))
+	mock.ExpectPrepare(`^UPDATE resource_relations SET saved_location = \$2`).
+		ExpectExec().WithArgs("old-id", "report-new.pdf", storage.LocalDriver).
+		WillReturnResult(sqlmock.NewResult(-1, 1))
+	mock.ExpectQuery(`^SELECT count\(\*\) FROM resource_relations WHERE saved_location = \$1`).
+		WithArgs("report-old.pdf", storage.LocalDriver).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(references))
+}
+
+// expectRelease expects the references to the replaced file to be counted again under its lock
+func expectRelease(mock sqlmock.Sqlmock, location string, references int) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`^SELECT pg_advisory_xact_lock`).
+		WithArgs("location:local:" + location).
+		WillReturnResult(sqlmock.NewResult(-1, 1))
+	mock.ExpectQuery(`^SELECT count\(\*\) FROM resource_relations WHERE saved_location = \$1`).
+		WithArgs(location, storage.LocalDriver).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(references))
+	mock.ExpectCommit()
+}
+
+// noFiles stands for the storage drivers of the repository tests
+var noFiles = storedFiles{
+	put:    func(*SaveUploadedResourceParameters) error { return nil },
+	remove: func(string, string) error { return nil },
+}
+
+// useUploadDir receives the uploads of the test in a directory of its own
+func useUploadDir(t *testing.T) string {
+	previous := config.Config.FileUploadDir
+	config.Config.FileUploadDir = t.TempDir()
+	t.Cleanup(func() {
+		config.Config.FileUploadDir = previous
+	})
+	return config.Config.FileUploadDir
 }
 
-func (m *mockFileWriter) SaveFileTo(file *multipart.FileHeader, dst string) error {
-	return m.err
+// getService puts the files to the upload directory, set it before creating the service
+func getService(db *sql.DB) *Service {
+	drivers, _ := storage.NewRegistry(storage.LocalDriver, storage.NewLocal(config.Config.FileUploadDir))
+	return NewService(db, drivers)
 }
 
 func getDbAndMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
@@ -256,7 +1033,7 @@ func runAndExpect(t *testing.T, mockExpectations func(mock sqlmock.Sqlmock)) {
 		UploadDestination: "src/hello.pdf",
 	}
 
-	result := r.saveUploadedResourceInformation(params)
+	result := r.saveUploadedResourceInformation(params, noFiles)
 
 	assert.Empty(t, result.ID)
 	assert.Equal(t, errCouldNotPersist, result.Err)
@@ -3,7 +3,9 @@ package upload
 import (
 	"database/sql"
 	"errors"
-	"mime/multipart"
+	"github.com/mensurowary/juno/resources/metadata"
+	"github.com/mensurowary/juno/resources/storage"
+	"io"
 )
 
 var (
@@ -13,14 +15,98 @@ var (
 
 var (
 	errCouldNotPersist = errors.New("could not persist the given data to database")
+	errCouldNotPlace   = errors.New("could not put the file to the storage")
+)
+
+var (
+	ErrUnknownUploadMode        = errors.New("unknown upload mode, must be either best_effort or all_or_nothing")
+	ErrUnknownDuplicateStrategy = errors.New("unknown duplicate strategy, must be one of version, reject, overwrite or rename")
+	ErrDuplicateResource        = errors.New("a resource with the same name and extension already exists")
+	ErrInvalidChecksum          = errors.New("malformed checksum, must be an md5 or sha256 digest")
+	ErrChecksumMismatch         = errors.New("checksum of the file does not match")
+	ErrInvalidTag               = errors.New("invalid tag, must be at most 64 characters")
+)
+
+// MaxTagLength is the longest tag a resource can have
+const MaxTagLength = 64
+
+// the algorithms the uploads can be verified with
+const (
+	MD5    = "md5"
+	SHA256 = "sha256"
+)
+
+// Checksum is a digest the client expects the content of the upload to have
+type Checksum struct {
+	Algorithm string
+	Sum       []byte
+}
+
+// the behaviours when the application already owns a resource with the same name and extension
+const (
+	// DuplicateVersion keeps the existing resource and stores the upload as its next version
+	DuplicateVersion = iota
+	// DuplicateReject fails the upload
+	DuplicateReject
+	// DuplicateOverwrite replaces the content of the existing resource, its id stays the same
+	DuplicateOverwrite
+	// DuplicateRename keeps both, the upload is named "name (1)", "name (2)", ...
+	DuplicateRename
+)
+
+var duplicateStrategies = map[string]int{
+	"version":   DuplicateVersion,
+	"reject":    DuplicateReject,
+	"overwrite": DuplicateOverwrite,
+	"rename":    DuplicateRename,
+}
+
+const (
+	// ModeBestEffort persists every file that could be uploaded
+	ModeBestEffort = "best_effort"
+	// ModeAllOrNothing persists the files only if all of them could be uploaded
+	ModeAllOrNothing = "all_or_nothing"
+)
+
+// the error codes of the files of a multi-file upload
+const (
+	PartNotUploaded  = "not_uploaded"
+	PartNotPersisted = "not_persisted"
+	// PartDuplicate is a file rejected since a resource with the same name and extension exists
+	PartDuplicate = "duplicate"
+	// PartRolledBack is a file that was uploaded but discarded since another file failed
+	PartRolledBack = "rolled_back"
 )
 
 type repository interface {
-	saveUploadedResourceInformation(params *SaveUploadedResourceParameters) *InsertResult
+	saveUploadedResourceInformation(params *SaveUploadedResourceParameters, files storedFiles) *InsertResult
+	saveUploadedResourcesInformation(params []*SaveUploadedResourceParameters, files storedFiles) ([]*InsertResult, error)
+	releaseLocation(storage, location string, remove func() error) error
 }
 
+// storedFiles puts the received files to the storage drivers and removes the stored ones,
+// the repository puts the file of a resource before committing it
+type storedFiles struct {
+	put    func(params *SaveUploadedResourceParameters) error
+	remove func(storage, location string) error
+}
+
+// FileWriter streams the content of an upload to its destination and returns the number of bytes written
 type FileWriter interface {
-	SaveFileTo(file *multipart.FileHeader, dst string) error
+	SaveFileTo(src io.Reader, dst string) (int64, error)
+}
+
+// Part is a single file of a multi-file upload
+type Part struct {
+	Filename string
+	Open     func() (io.ReadCloser, error)
+}
+
+// PartResult is the outcome of a single file of a multi-file upload, either the id or the error code is set
+type PartResult struct {
+	Filename string `json:"filename"`
+	FileID   string `json:"resourceId,omitempty"`
+	Error    string `json:"error,omitempty"`
 }
 
 type SaveUploadedResourceParameters struct {
@@ -29,11 +115,36 @@ type SaveUploadedResourceParameters struct {
 	FileExtension     string
 	UploadDestination string
 	AppID             string
+	DuplicateStrategy int
+	Version           int
+	Hidden            bool
+	Codec             string
+	// Hash is the hex encoded SHA-256 of the content, the file is stored under it
+	Hash string
+	// MD5 is the hex encoded MD5 of the content
+	MD5 string
+	// TemporaryLocation is where the file is received until it is persisted
+	TemporaryLocation string
+	// Storage is the name of the driver the file is put to
+	Storage  string
+	Tags     []string
+	Metadata metadata.Metadata
 }
 
 type InsertResult struct {
 	ID  string
 	Err error
+	// ReplacedLocation is the file of the overwritten resource, to be removed from the ReplacedStorage driver once the new one is persisted
+	ReplacedLocation string
+	ReplacedStorage  string
+}
+
+// existingResource is the latest version of a resource with the same name and extension
+type existingResource struct {
+	ID            string
+	Version       int
+	SavedLocation string
+	Storage       string
 }
 
 type Repository struct {
@@ -41,21 +152,29 @@ type Repository struct {
 }
 
 type FileUploadParameters struct {
-	Hidden, Compress  bool
+	Hidden bool
+	// Codec is the compression codec the file is stored with, empty when it is stored as it is
+	Codec             string
 	Name              string
 	Extension         string
 	DuplicateStrategy int
 	AppID             string
+	// Checksums are verified once the file is received
+	Checksums []Checksum
+	Tags      []string
+	Metadata  metadata.Metadata
 }
 
 type Service struct {
-	r repository
+	r       repository
+	drivers *storage.Registry
 }
 
-func NewService(db *sql.DB) *Service {
+func NewService(db *sql.DB, drivers *storage.Registry) *Service {
 	return &Service{
 		r: &Repository{
 			db: db,
 		},
+		drivers: drivers,
 	}
 }
@@ -3,9 +3,12 @@ package resources
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/mensurowary/juno/resources/download"
+	"github.com/mensurowary/juno/resources/interactions"
+	"github.com/mensurowary/juno/resources/metadata"
+	"github.com/mensurowary/juno/resources/tus"
 	"github.com/mensurowary/juno/resources/upload"
 	"github.com/mensurowary/juno/util"
-	"mime/multipart"
+	"io"
 	"net/url"
 )
 
@@ -18,6 +21,14 @@ func Upload(handler uploadHandler) func(*gin.Context) {
 	}
 }
 
+// StreamUpload uploads the raw body of the request, streamed straight to the disk
+func StreamUpload(handler uploadHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		StreamUploadHandler(wc, handler)
+	}
+}
+
 // GetAppResourcesInformation retrieves the resources information
 func GetAppResourcesInformation(handler resourcesHandler) func(*gin.Context) {
 	return func(c *gin.Context) {
@@ -26,6 +37,14 @@ func GetAppResourcesInformation(handler resourcesHandler) func(*gin.Context) {
 	}
 }
 
+// SearchResources handles the search of the resources
+func SearchResources(handler resourcesHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		SearchResourcesHandler(wc, handler)
+	}
+}
+
 // DownloadSingleAppResource handles single resource information retrieval/file download
 func DownloadSingleAppResource(handler resourcesHandler) func(*gin.Context) {
 	return func(c *gin.Context) {
@@ -42,20 +61,131 @@ func DeleteSingleAppResource(handler resourceInteractionHandler) func(*gin.Conte
 	}
 }
 
+// UpdateSingleAppResource handles the changes of a resource
+func UpdateSingleAppResource(handler resourceInteractionHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		UpdateSingleAppResourceHandler(wc, handler)
+	}
+}
+
+// AddResourceTags handles the tagging of a resource
+func AddResourceTags(handler resourceInteractionHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		AddResourceTagsHandler(wc, handler)
+	}
+}
+
+// RemoveResourceTags handles the removal of the tags of a resource
+func RemoveResourceTags(handler resourceInteractionHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		RemoveResourceTagsHandler(wc, handler)
+	}
+}
+
+// UpdateResourceMetadata handles the changes of the metadata of a resource
+func UpdateResourceMetadata(handler resourceInteractionHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		UpdateResourceMetadataHandler(wc, handler)
+	}
+}
+
+// TusOptions advertises the capabilities of the resumable uploads
+func TusOptions() func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		TusOptionsHandler(wc)
+	}
+}
+
+// CreateUpload creates a resumable upload, the tus creation extension
+func CreateUpload(handler tusHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		CreateUploadHandler(wc, handler)
+	}
+}
+
+// GetUpload reports the offset of a resumable upload
+func GetUpload(handler tusHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		GetUploadHandler(wc, handler)
+	}
+}
+
+// WriteUploadChunk appends a chunk to a resumable upload
+func WriteUploadChunk(handler tusHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		WriteUploadChunkHandler(wc, handler)
+	}
+}
+
+// TerminateUpload deletes a resumable upload, the tus termination extension
+func TerminateUpload(handler tusHandler) func(*gin.Context) {
+	return func(c *gin.Context) {
+		wc := util.NewWebContext(c)
+		TerminateUploadHandler(wc, handler)
+	}
+}
+
 type uploadHandler interface {
-	HandleUpload(writer upload.FileWriter, fileHeader *multipart.FileHeader, appID string, values url.Values) (string, error)
+	HandleUpload(writer upload.FileWriter, src io.Reader, filename string, appID string, values url.Values) (string, error)
+	HandleUploads(writer upload.FileWriter, parts []upload.Part, appID string, values url.Values) ([]upload.PartResult, error)
 }
 
 type resourcesHandler interface {
-	GetAppResourcesInformation(appID string) download.ResourceInformation
+	GetAppResourcesInformation(params download.ResourcesRequestParams) download.ResourceInformation
 	GetSingleResource(params download.SingleResourceRequestParams) download.SingleResourceResult
+	SearchResources(params download.SearchRequestParams) download.SearchInformation
 }
 
 type resourceInteractionHandler interface {
 	DeleteSingleResourceByID(resourceID, appID string) error
+	UpdateResource(params interactions.UpdateResourceParameters) (download.Resource, error)
+	AddResourceTags(resourceID, appID string, tags []string, revisions []int) (download.Resource, error)
+	RemoveResourceTags(resourceID, appID string, tags []string, revisions []int) (download.Resource, error)
+	UpdateResourceMetadata(resourceID, appID string, patch metadata.Metadata, revisions []int) (download.Resource, error)
 }
 
 // UploadResult represents the result of the file upload
 type UploadResult struct {
 	FileID string `json:"resourceId"`
 }
+
+// UpdateResourceRequest holds the changes of a resource, the missing ones are left as they are
+type UpdateResourceRequest struct {
+	Name      *string `json:"name"`
+	Extension *string `json:"extension"`
+	MimeType  *string `json:"mime_type"`
+	Hidden    *bool   `json:"hidden"`
+}
+
+// ResourcePage is a page of the listing along with the cursors of the pages around it
+type ResourcePage struct {
+	Resources []download.Resource `json:"resources"`
+	Next      string              `json:"next,omitempty"`
+	Prev      string              `json:"prev,omitempty"`
+	Total     int                 `json:"total"`
+}
+
+// TagsRequest holds the tags added to or removed from a resource
+type TagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// MultiUploadResult represents the results of the files uploaded at once
+type MultiUploadResult struct {
+	Files []upload.PartResult `json:"files"`
+}
+
+type tusHandler interface {
+	CreateUpload(appID string, length int64, metadata map[string]string) (*tus.Upload, error)
+	GetUpload(uploadID, appID string) (*tus.Upload, error)
+	WriteChunk(uploadID, appID string, offset int64, chunk io.Reader, checksum *tus.Checksum) (*tus.Upload, error)
+	TerminateUpload(uploadID, appID string) error
+}
@@ -4,12 +4,19 @@ import (
 	"database/sql"
 	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
+	"github.com/mensurowary/juno/admin"
+	"github.com/mensurowary/juno/admin/applications"
 	"github.com/mensurowary/juno/auth"
+	"github.com/mensurowary/juno/auth/apikeys"
+	"github.com/mensurowary/juno/auth/lockout"
+	"github.com/mensurowary/juno/auth/oidc"
 	"github.com/mensurowary/juno/commons"
 	"github.com/mensurowary/juno/config"
 	"github.com/mensurowary/juno/resources"
 	"github.com/mensurowary/juno/resources/download"
 	"github.com/mensurowary/juno/resources/interactions"
+	"github.com/mensurowary/juno/resources/storage"
+	"github.com/mensurowary/juno/resources/tus"
 	"github.com/mensurowary/juno/resources/upload"
 	"github.com/sirupsen/logrus"
 	"net/http"
@@ -19,38 +26,148 @@ func Initialize(db *sql.DB) *gin.Engine {
 	engine := gin.Default()
 
 	// dependencies init
-	us := upload.NewService(db)
+	drivers := storage.FromConfig()
+
+	us := upload.NewService(db, drivers)
 
 	dr := download.NewRepository(db)
-	ds := download.NewService(dr)
+	ds := download.NewService(dr, drivers)
 
 	ir := interactions.NewRepository(db)
-	is := interactions.NewService(ir, ds)
+	is := interactions.NewService(ir, ds, drivers)
+
+	tr := tus.NewRepository(db)
+	ts := tus.NewService(tr, us)
+
+	ar := auth.NewRepository(db)
+
+	akr := apikeys.NewRepository(db)
+	aks := apikeys.NewService(akr)
+
+	apr := applications.NewRepository(db)
+	aps := applications.NewService(apr, drivers)
 	// dependencies init end
 
-	authMiddleware := auth.JwtMiddleware()
+	keys := auth.KeysFromConfig()
+	limiter := lockout.FromConfig(db)
+	authMiddleware := auth.JwtMiddleware(ar, keys, limiter)
+	certs, err := auth.NewCertificateResolver(ar, config.Config.TlsClientIdentity)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	authenticated := auth.Middleware(authMiddleware, aks, certs)
 
 	engine.NoRoute(authMiddleware.MiddlewareFunc(), NoRouteHandler())
 
+	engine.GET("/.well-known/jwks.json", auth.JWKSHandler(keys))
+
 	versioning := engine.Group(config.Config.ApiVersion)
 	{
 		versioning.POST("/auth/login", authMiddleware.LoginHandler)
-		versioning.POST("/auth/refresh_token", authMiddleware.RefreshHandler)
-		versioning.POST("/auth/logout", authMiddleware.LogoutHandler)
+		if provider := oidc.FromConfig(); provider != nil {
+			versioning.POST("/auth/oidc/login", auth.OIDCLoginHandler(authMiddleware, provider, ar))
+		}
+		versioning.POST("/auth/refresh_token", auth.RefreshHandler(authMiddleware, ar))
+		versioning.POST("/auth/logout", authMiddleware.MiddlewareFunc(), auth.LogoutHandler(authMiddleware, ar))
+
+		apiKeysGroup := versioning.Group("/auth/api_keys")
+		apiKeysGroup.Use(authMiddleware.MiddlewareFunc())
+		{
+			apiKeysGroup.Handle(http.MethodGet, "", apikeys.GetAPIKeys(aks))
+			apiKeysGroup.Handle(http.MethodPost, "", apikeys.CreateAPIKey(aks))
+			apiKeysGroup.Handle(http.MethodDelete, "/:id", apikeys.RevokeAPIKey(aks))
+		}
+
+		// the tus clients discover the capabilities before authenticating
+		versioning.OPTIONS("/resources/uploads", resources.TusOptions())
 
 		resourcesGroup := versioning.Group("/resources")
-		resourcesGroup.Use(authMiddleware.MiddlewareFunc())
+		resourcesGroup.Use(authenticated)
+		{
+			read := auth.RequireScopes(auth.ScopeResourcesRead)
+			write := auth.RequireScopes(auth.ScopeResourcesWrite)
+			remove := auth.RequireScopes(auth.ScopeResourcesDelete)
+			uploads := UploadsRoute()
+
+			resourcesGroup.Handle(http.MethodGet, "", read, resources.GetAppResourcesInformation(ds))
+			resourcesGroup.Handle(http.MethodPost, "/upload", write, resources.Upload(us))
+			resourcesGroup.Handle(http.MethodPut, "/upload/:name", write, resources.StreamUpload(us))
+			resourcesGroup.Handle(http.MethodGet, "/:id", read, StaticRoute(resources.DownloadSingleAppResource(ds), map[string]gin.HandlerFunc{
+				"search": resources.SearchResources(ds),
+			}))
+			resourcesGroup.Handle(http.MethodDelete, "/:id", remove, resources.DeleteSingleAppResource(is))
+			resourcesGroup.Handle(http.MethodPatch, "/:id", write, resources.UpdateSingleAppResource(is))
+
+			resourcesGroup.Handle(http.MethodPost, "/uploads", write, resources.CreateUpload(ts))
+			resourcesGroup.Handle(http.MethodHead, "/:id/:upload_id", uploads, write, resources.GetUpload(ts))
+			resourcesGroup.Handle(http.MethodPatch, "/:id/:upload_id", write, SubResourceRoute(resources.WriteUploadChunk(ts), map[string]gin.HandlerFunc{
+				"tags":     resources.AddResourceTags(is),
+				"metadata": resources.UpdateResourceMetadata(is),
+			}))
+			resourcesGroup.Handle(http.MethodDelete, "/:id/:upload_id", write, SubResourceRoute(resources.TerminateUpload(ts), map[string]gin.HandlerFunc{
+				"tags": resources.RemoveResourceTags(is),
+			}))
+		}
+
+		adminGroup := versioning.Group("/admin")
+		adminGroup.Use(authenticated, auth.RequireScopes(auth.ScopeAdmin))
 		{
-			resourcesGroup.Handle(http.MethodGet, "", resources.GetAppResourcesInformation(ds))
-			resourcesGroup.Handle(http.MethodPost, "/upload", resources.Upload(us))
-			resourcesGroup.Handle(http.MethodGet, "/:id", resources.DownloadSingleAppResource(ds))
-			resourcesGroup.Handle(http.MethodDelete, "/:id", resources.DeleteSingleAppResource(is))
+			adminGroup.Handle(http.MethodGet, "/applications", admin.GetApplications(aps))
+			adminGroup.Handle(http.MethodPost, "/applications", admin.CreateApplication(aps))
+			adminGroup.Handle(http.MethodGet, "/applications/:id", admin.GetApplication(aps))
+			adminGroup.Handle(http.MethodPatch, "/applications/:id", admin.UpdateApplication(aps))
+			adminGroup.Handle(http.MethodPut, "/applications/:id/password", admin.ResetApplicationPassword(aps))
+			adminGroup.Handle(http.MethodPost, "/applications/:id/revoke_tokens", admin.RevokeApplicationTokens(aps))
+			adminGroup.Handle(http.MethodDelete, "/applications/:id", admin.DeleteApplication(aps))
+			adminGroup.Handle(http.MethodGet, "/lockouts", admin.GetLockouts(limiter))
+			adminGroup.Handle(http.MethodDelete, "/lockouts/:key", admin.ResetLockout(limiter))
 		}
 	}
 
 	return engine
 }
 
+// UploadsRoute lets only the /uploads/:upload_id paths through, gin does not allow a static
+// segment beside the :id wildcard of the resources so the resumable uploads share it
+func UploadsRoute() func(c *gin.Context) {
+	notFound := NoRouteHandler()
+	return func(c *gin.Context) {
+		if c.Param("id") != "uploads" {
+			notFound(c)
+			c.Abort()
+		}
+	}
+}
+
+// StaticRoute dispatches the /:id paths, gin does not allow a static segment beside the :id wildcard
+// so the static paths, e.g. /search, share it with the resources
+func StaticRoute(resource gin.HandlerFunc, static map[string]gin.HandlerFunc) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if handler, ok := static[c.Param("id")]; ok {
+			handler(c)
+			return
+		}
+		resource(c)
+	}
+}
+
+// SubResourceRoute dispatches the /:id/:upload_id paths shared by the resumable uploads and the sub-resources of
+// the resources, e.g. /:id/tags. The /uploads/:upload_id paths go to the upload handler, the others by their last segment.
+func SubResourceRoute(upload gin.HandlerFunc, subResources map[string]gin.HandlerFunc) func(c *gin.Context) {
+	notFound := NoRouteHandler()
+	return func(c *gin.Context) {
+		if c.Param("id") == "uploads" {
+			upload(c)
+			return
+		}
+		if handler, ok := subResources[c.Param("upload_id")]; ok {
+			handler(c)
+			return
+		}
+		notFound(c)
+	}
+}
+
 func NoRouteHandler() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		claims := jwt.ExtractClaims(c)
@@ -1,16 +1,21 @@
 package util
 
 import (
-	"bytes"
-	"compress/gzip"
-	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/mensurowary/juno/auth"
-	"io/ioutil"
+	"github.com/mensurowary/juno/resources/compression"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type WebContext struct {
@@ -25,50 +30,48 @@ func (w *WebContext) GetAppID() string {
 	return auth.GetAppID(w.c)
 }
 
-func (w *WebContext) GetResourceID() string {
-	return w.Param("id")
+func (w *WebContext) GetApplication() *auth.Application {
+	app, _ := auth.GetApplication(w.c)
+	return app
 }
 
-func (w *WebContext) SaveFileTo(file *multipart.FileHeader, dst string) error {
-	return w.c.SaveUploadedFile(file, dst)
+func (w *WebContext) GetResourceID() string {
+	return w.Param("id")
 }
 
-// for future
-func (w *WebContext) Compress(header *multipart.FileHeader) error {
-	file, err := header.Open()
+// SaveFileTo streams the source to the destination file, the partially written file is removed on failure
+func (w *WebContext) SaveFileTo(src io.Reader, dst string) (int64, error) {
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
 	if err != nil {
-		return errors.New("could not open the file header")
+		return 0, err
 	}
 
-	buff := make([]byte, header.Size)
-	if _, err = file.Read(buff); err != nil {
-		return errors.New("could not read from the file")
+	written, err := io.Copy(out, src)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
 	}
-
-	var b bytes.Buffer
-	writer := gzip.NewWriter(&b)
-
-	writer.Name = "Demo.zip"
-
-	if _, err = writer.Write(buff); err != nil {
-		return errors.New("could not write to the file")
-	}
-	err = writer.Close()
 	if err != nil {
-		return errors.New("could not write to the file")
+		_ = os.Remove(dst)
+		return 0, err
 	}
+	return written, nil
+}
 
-	err = ioutil.WriteFile("./__uploads__/zipped.gz", buff, os.ModePerm)
+func (w *WebContext) FormFile() (*multipart.FileHeader, error) {
+	return w.c.FormFile("file")
+}
 
+// FormFiles returns all the file parts of the form
+func (w *WebContext) FormFiles() ([]*multipart.FileHeader, error) {
+	form, err := w.c.MultipartForm()
 	if err != nil {
-		return errors.New("could not write to the file")
+		return nil, err
 	}
-
-	return nil
+	return form.File["file"], nil
 }
 
-func (w *WebContext) FormFile() (*multipart.FileHeader, error) {
-	return w.c.FormFile("file")
+func (w *WebContext) BindJSON(obj interface{}) error {
+	return w.c.ShouldBindJSON(obj)
 }
 
 func (w *WebContext) Form() url.Values {
@@ -91,10 +94,36 @@ func (w *WebContext) Param(key string) string {
 	return w.c.Param(key)
 }
 
+func (w *WebContext) Header(key string) string {
+	return w.c.GetHeader(key)
+}
+
+// Headers are all the headers of the request
+func (w *WebContext) Headers() http.Header {
+	return w.c.Request.Header
+}
+
+func (w *WebContext) SetHeader(key, value string) {
+	w.c.Header(key, value)
+}
+
+// Body is the raw body of the request, it is not buffered
+func (w *WebContext) Body() io.Reader {
+	return w.c.Request.Body
+}
+
 func (w *WebContext) Ok(data interface{}) {
 	w.Respond(http.StatusOK, data)
 }
 
+func (w *WebContext) BadRequest(data interface{}) {
+	w.Respond(http.StatusBadRequest, data)
+}
+
+func (w *WebContext) Forbidden(data interface{}) {
+	w.Respond(http.StatusForbidden, data)
+}
+
 func (w *WebContext) NotFound(data interface{}) {
 	w.Respond(http.StatusNotFound, data)
 }
@@ -103,6 +132,10 @@ func (w *WebContext) UnprocessableEntity(data interface{}) {
 	w.Respond(http.StatusUnprocessableEntity, data)
 }
 
+func (w *WebContext) Conflict(data interface{}) {
+	w.Respond(http.StatusConflict, data)
+}
+
 func (w *WebContext) InternalServerError(data interface{}) {
 	w.Respond(http.StatusInternalServerError, data)
 }
@@ -111,6 +144,62 @@ func (w *WebContext) Respond(status int, data interface{}) {
 	w.c.JSON(status, data)
 }
 
-func (w *WebContext) RespondWithFile(filePath, filename string) {
-	w.c.FileAttachment(filePath, filename)
+// Status responds without a body, e.g. to the HEAD requests
+func (w *WebContext) Status(status int) {
+	w.c.Status(status)
+}
+
+// RespondWithContent sends the content as an attachment, the ranges and the conditional requests are served from it
+func (w *WebContext) RespondWithContent(content io.ReadSeeker, filename string, modTime time.Time) {
+	w.c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	http.ServeContent(w.c.Writer, w.c.Request, filename, modTime, content)
+}
+
+// AcceptsEncoding tells whether the Accept-Encoding header of the request lists the content encoding
+func (w *WebContext) AcceptsEncoding(encoding string) bool {
+	for _, item := range strings.Split(w.Header("Accept-Encoding"), ",") {
+		params := strings.Split(item, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), encoding) {
+			continue
+		}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); strings.HasPrefix(param, "q=") && err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// RespondWithEncodedContent sends the compressed content as it is, the client decompresses it
+func (w *WebContext) RespondWithEncodedContent(content io.ReadSeeker, filename string, modTime time.Time, encoding string) {
+	w.c.Header("Content-Encoding", encoding)
+	w.c.Header("Vary", "Accept-Encoding")
+	w.RespondWithContent(content, filename, modTime)
+}
+
+// RespondWithDecodedContent decompresses the content on the fly, size is the length of the decompressed content
+func (w *WebContext) RespondWithDecodedContent(content io.Reader, filename, codec string, size int64) {
+	reader, err := compression.NewReader(codec, content)
+	if err != nil {
+		log.Errorf("Could not decompress the file %s : %v", filename, err)
+		w.c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	defer reader.Close()
+
+	// the content type set beforehand wins over the one told by the extension
+	contentType := w.c.Writer.Header().Get("Content-Type")
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.c.DataFromReader(http.StatusOK, size, contentType, reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=\"%s\"", filename),
+		"Vary":                "Accept-Encoding",
+	})
 }